@@ -0,0 +1,224 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/bench"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPaths []string
+	instance  string
+	service   string
+	streams   int
+	duration  time.Duration
+	direction string
+	local     bool
+	modes     []string
+	loss      float64
+	delay     time.Duration
+	jitter    time.Duration
+	rate      float64
+)
+
+func init() {
+	Cmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
+	Cmd.Flags().StringVar(&instance, "instance", "", "Instance to use when the configuration lists several.")
+	Cmd.Flags().StringVar(&service, "service", "bench", "Name of the server's bench service.")
+	Cmd.Flags().IntVarP(&streams, "streams", "n", 4, "Parallel streams per direction.")
+	Cmd.Flags().DurationVarP(&duration, "duration", "d", 10*time.Second, "How long to measure each direction.")
+	Cmd.Flags().StringVar(&direction, "direction", "both", "Direction to measure: upload, download or both.")
+	Cmd.Flags().BoolVar(&local, "local", false, "Run client and server in this process over an in-memory link.")
+	Cmd.Flags().StringSliceVar(&modes, "mode", nil, "KCP modes to compare with --local, e.g. fast,fast2,fast3 (default: the configured mode).")
+	Cmd.Flags().Float64Var(&loss, "loss", 0, "Packet loss in percent on the --local link, each way.")
+	Cmd.Flags().DurationVar(&delay, "delay", 0, "One-way delay on the --local link.")
+	Cmd.Flags().DurationVar(&jitter, "jitter", 0, "Random extra one-way delay on the --local link.")
+	Cmd.Flags().Float64Var(&rate, "rate", 0, "Bandwidth of the --local link in Mbit/s, each way (0 for unlimited).")
+}
+
+var Cmd = &cobra.Command{
+	Use:          "bench",
+	Short:        "Measures tunnel throughput, latency and retransmissions.",
+	Long:         `The 'bench' command opens parallel streams to a service of type bench on the server, which must list one under services, or with --local to one in this process over an impaired in-memory link.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var dirs []string
+		switch direction {
+		case "both":
+			dirs = []string{bench.Upload, bench.Download}
+		case bench.Upload, bench.Download:
+			dirs = []string{direction}
+		default:
+			return fmt.Errorf("direction must be upload, download or both")
+		}
+		if streams < 1 || duration <= 0 {
+			return fmt.Errorf("streams and duration must be positive")
+		}
+		if loss < 0 || loss > 100 {
+			return fmt.Errorf("loss must be between 0 and 100")
+		}
+
+		cfg, err := conf.Load(confPaths...)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if cfg, err = cfg.Tunnel(instance); err != nil {
+			return err
+		}
+		flog.SetLevel(int(flog.Warn))
+		opts := bench.Options{Streams: streams, Duration: duration, Probe: 50 * time.Millisecond}
+
+		var rows []row
+		if local {
+			rows, err = runLocal(cfg, dirs, opts)
+		} else {
+			if len(modes) > 0 {
+				return fmt.Errorf("--mode requires --local; edit transport.kcp.mode to change it for a real server")
+			}
+			rows, err = runRemote(cfg, dirs, opts)
+		}
+		if err != nil {
+			return err
+		}
+		render(rows)
+		return nil
+	},
+}
+
+type row struct {
+	mode string
+	res  *bench.Result
+}
+
+func runRemote(cfg *conf.Conf, dirs []string, opts bench.Options) ([]row, error) {
+	if cfg.Role != "client" {
+		return nil, fmt.Errorf("bench requires a client configuration unless --local is set")
+	}
+	buffer.Initialize(cfg.Transport.TCPBuf, cfg.Transport.UDPBuf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := client.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+	open := func(mode string) (io.ReadWriteCloser, error) {
+		strm, err := c.Bench(ctx, service, mode)
+		if err != nil {
+			return nil, fmt.Errorf("%w; the server must list a '%s' service of type bench", err, service)
+		}
+		return strm, nil
+	}
+
+	var rows []row
+	for _, dir := range dirs {
+		fmt.Fprintf(os.Stderr, "measuring %s to %s for %s...\n", dir, cfg.Server.Addr, opts.Duration)
+		res, err := bench.Run(open, dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row{transportMode(&cfg.Transport), res})
+	}
+	return rows, nil
+}
+
+func runLocal(cfg *conf.Conf, dirs []string, opts bench.Options) ([]row, error) {
+	link := bench.LinkOptions{
+		Loss:   loss / 100,
+		Delay:  delay,
+		Jitter: jitter,
+		Rate:   int64(rate * 1e6),
+	}
+	if cfg.Transport.Protocol != "kcp" {
+		if len(modes) > 0 {
+			return nil, fmt.Errorf("--mode compares KCP modes but the transport is %s", cfg.Transport.Protocol)
+		}
+		return benchLocal(&cfg.Transport, link, dirs, opts)
+	}
+	if len(modes) == 0 {
+		modes = []string{cfg.Transport.KCP.Mode}
+	}
+	valid := []string{"normal", "fast", "fast2", "fast3", "manual"}
+	for _, m := range modes {
+		if !slices.Contains(valid, m) {
+			return nil, fmt.Errorf("invalid mode '%s': must be one of %s", m, strings.Join(valid, ", "))
+		}
+	}
+
+	var rows []row
+	for _, m := range modes {
+		t := cfg.Transport
+		kcfg := *t.KCP
+		kcfg.Mode = m
+		t.KCP = &kcfg
+		r, err := benchLocal(&t, link, dirs, opts)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r...)
+	}
+	return rows, nil
+}
+
+func benchLocal(t *conf.Transport, link bench.LinkOptions, dirs []string, opts bench.Options) ([]row, error) {
+	l, err := bench.NewLocal(t, link)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	mode := transportMode(t)
+	var rows []row
+	for _, dir := range dirs {
+		fmt.Fprintf(os.Stderr, "measuring %s with mode %s for %s...\n", dir, mode, opts.Duration)
+		res, err := bench.Run(l.Open, dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row{mode, res})
+	}
+	return rows, nil
+}
+
+// transportMode labels results with the KCP mode, or the protocol for
+// transports without modes.
+func transportMode(t *conf.Transport) string {
+	if t.Protocol == "kcp" {
+		return t.KCP.Mode
+	}
+	return t.Protocol
+}
+
+func render(rows []row) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODE\tDIRECTION\tTHROUGHPUT\tRTT P50\tRTT P90\tRTT P99\tRETRANS\tCPU")
+	for _, r := range rows {
+		cpu := "n/a"
+		if r.res.CPU >= 0 {
+			cpu = fmt.Sprintf("%.0f%%", r.res.CPU*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.2f Mbit/s\t%s\t%s\t%s\t%.2f%%\t%s\n",
+			r.mode, r.res.Direction, r.res.Throughput()/1e6,
+			ms(r.res.Percentile(0.5)), ms(r.res.Percentile(0.9)), ms(r.res.Percentile(0.99)),
+			r.res.Retrans*100, cpu)
+	}
+	w.Flush()
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPaths []string
+	instance  string
+)
+
+func init() {
+	validateCmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
+	showCmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
+	showCmd.Flags().StringVarP(&format, "format", "f", "yaml", "Output format: yaml or json.")
+
+	exportCmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to the server configuration file or directory; repeat to merge several.")
+	exportCmd.Flags().StringVar(&instance, "instance", "", "Server instance to export when the configuration lists several.")
+
+	Cmd.AddCommand(initCmd, validateCmd, showCmd, exportCmd, importCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "config",
+	Short: "Generates and inspects configuration files.",
+}
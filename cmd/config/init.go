@@ -0,0 +1,640 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/cmd/secret"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/pkg/netinfo"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gopacket/gopacket/pcap"
+	"github.com/spf13/cobra"
+)
+
+var initOpts struct {
+	role    string
+	output  string
+	iface   string
+	carrier string
+	server  string
+	port    int
+	key     string
+	socks5  string
+	forward []string
+	yes     bool
+	force   bool
+	service bool
+}
+
+func init() {
+	f := initCmd.Flags()
+	f.StringVar(&initOpts.role, "role", "", "Role to generate a configuration for: client or server.")
+	f.StringVar(&initOpts.server, "server", "", "Server address host:port (client only).")
+	f.IntVar(&initOpts.port, "port", 0, "Listen port (server only, default 9999).")
+	f.StringVar(&initOpts.key, "key", "", "KCP key shared with the peer, or env:NAME or file:path (default: a newly generated one).")
+	addGenerateFlags(initCmd)
+}
+
+// addGenerateFlags registers the flags shared by the commands that write a
+// configuration.
+func addGenerateFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVarP(&initOpts.output, "output", "o", "", "Where to write the configuration (default <role>.yaml).")
+	f.StringVarP(&initOpts.iface, "interface", "i", "", "Network interface to use (default: the one with the default route).")
+	f.StringVar(&initOpts.carrier, "carrier", "", "Packet carrier: pcap-raw, udp or tcp-stream (default pcap-raw).")
+	f.StringVar(&initOpts.socks5, "socks5", "", "SOCKS5 listen address, or 'none' (client only, default 127.0.0.1:1080).")
+	f.StringArrayVar(&initOpts.forward, "forward", nil, "Port forward as listen=target[/udp] (client only, repeatable).")
+	f.BoolVarP(&initOpts.yes, "yes", "y", false, "Accept detected defaults instead of prompting.")
+	f.BoolVar(&initOpts.force, "force", false, "Overwrite the output file if it exists.")
+	f.BoolVar(&initOpts.service, "service", false, "Install and start a systemd unit for the generated configuration (linux).")
+}
+
+var initCmd = &cobra.Command{
+	Use:          "init [flags]",
+	Short:        "Interactively generates a client or server configuration.",
+	Long:         `The 'init' command detects the interface, addresses and gateway MACs, generates a key and asks for the remaining settings. It writes a validated configuration and prints the snippet the peer needs.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout, yes: initOpts.yes}
+		return runInit(p, &params{})
+	},
+}
+
+type addrParams struct {
+	Addr      string
+	RouterMAC string
+}
+
+type forwardParams struct {
+	Listen   string
+	Target   string
+	Protocol string
+}
+
+type params struct {
+	Role      string
+	Carrier   string
+	Interface string
+	GUID      string
+	IPv4      *addrParams
+	IPv6      *addrParams
+	Port      int
+	Server    string
+	KCP       *conf.KCP
+	QUIC      *conf.QUIC
+	TCP       *conf.TCP
+	SOCKS5    string
+	Forward   []forwardParams
+}
+
+// confTemplate quotes every string with q, since keys, addresses and paths
+// come from the user and may hold quotes or backslashes.
+var confTemplate = template.Must(template.New("conf").Funcs(template.FuncMap{"q": strconv.Quote}).Parse(`role: {{q .Role}}
+
+log:
+  level: "info"
+{{- if eq .Role "server"}}
+
+listen:
+  addr: ":{{.Port}}"
+{{- end}}
+{{- if .SOCKS5}}
+
+socks5:
+  - listen: {{q .SOCKS5}}
+{{- end}}
+{{- if .Forward}}
+
+forward:
+{{- range .Forward}}
+  - listen: {{q .Listen}}
+    target: {{q .Target}}
+    protocol: {{q .Protocol}}
+{{- end}}
+{{- end}}
+
+network:
+{{- if .Carrier}}
+  carrier: {{q .Carrier}}
+{{- end}}
+{{- if .Interface}}
+  interface: {{q .Interface}}
+{{- end}}
+{{- if .GUID}}
+  guid: {{q .GUID}}
+{{- end}}
+{{- with .IPv4}}
+  ipv4:
+    addr: {{q .Addr}}
+    router_mac: {{q .RouterMAC}}
+{{- end}}
+{{- with .IPv6}}
+  ipv6:
+    addr: {{q .Addr}}
+    router_mac: {{q .RouterMAC}}
+{{- end}}
+{{- with .TCP}}
+  tcp:
+    local_flag: [{{range $i, $f := .LF_}}{{if $i}}, {{end}}{{q $f}}{{end}}]
+    remote_flag: [{{range $i, $f := .RF_}}{{if $i}}, {{end}}{{q $f}}{{end}}]
+{{- end}}
+{{- if eq .Role "client"}}
+
+server:
+  addr: {{q .Server}}
+{{- end}}
+
+transport:
+{{- with .QUIC}}
+  protocol: "quic"
+  quic:
+{{- if .ALPN}}
+    alpn: {{q .ALPN}}
+{{- end}}
+{{- if .Datagram}}
+    datagram: true
+{{- end}}
+    key: {{q .Key}}
+{{- else}}
+  protocol: "kcp"
+{{- end}}
+{{- with .KCP}}
+  kcp:
+    mode: {{q .Mode}}
+{{- if eq .Mode "manual"}}
+    nodelay: {{.NoDelay}}
+    interval: {{.Interval}}
+    resend: {{.Resend}}
+    nocongestion: {{.NoCongestion}}
+{{- end}}
+{{- if .MTU}}
+    mtu: {{.MTU}}
+{{- end}}
+{{- if or .Dshard .Pshard}}
+    dshard: {{.Dshard}}
+    pshard: {{.Pshard}}
+{{- end}}
+{{- if .Datagram}}
+    datagram: true
+{{- end}}
+    block: {{q .Block_}}
+    key: {{q .Key}}
+{{- end}}
+`))
+
+// runInit completes pr by detection and prompting, then writes it out.
+func runInit(p *prompter, pr *params) error {
+	var err error
+	if pr.KCP == nil && pr.QUIC == nil {
+		pr.KCP = &conf.KCP{Mode: "fast", Block_: "aes"}
+	}
+
+	pr.Role, err = p.ask(initOpts.role, "Role (client/server)", "client", func(s string) error {
+		if s != "client" && s != "server" {
+			return fmt.Errorf("role must be 'client' or 'server'")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if initOpts.carrier != "" {
+		pr.Carrier = initOpts.carrier
+	}
+	// Only raw packets need the interface, addresses and gateways.
+	raw := pr.Carrier == "" || pr.Carrier == "pcap-raw"
+	if !raw && pr.Carrier != "udp" && pr.Carrier != "tcp-stream" {
+		return fmt.Errorf("carrier must be pcap-raw, udp or tcp-stream")
+	}
+	var iface *net.Interface
+	var v4, v6 net.IP
+	if raw {
+		if iface, err = selectInterface(p); err != nil {
+			return err
+		}
+		pr.Interface = iface.Name
+		v4, v6 = interfaceAddrs(iface)
+	} else {
+		pr.TCP = nil
+	}
+
+	var serverIP net.IP
+	if pr.Role == "server" {
+		preset := ""
+		if initOpts.port != 0 {
+			preset = strconv.Itoa(initOpts.port)
+		}
+		port, err := p.ask(preset, "Listen port", "9999", checkListenPort)
+		if err != nil {
+			return err
+		}
+		pr.Port, _ = strconv.Atoi(port)
+	} else {
+		pr.Server, err = p.ask(initOpts.server, "Server address (host:port)", "", func(s string) error {
+			addr, err := net.ResolveUDPAddr("udp", s)
+			if err != nil {
+				return err
+			}
+			if addr.Port == 0 {
+				return fmt.Errorf("server port is required")
+			}
+			serverIP = addr.IP
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if raw {
+		if err := rawParams(p, pr, iface, v4, v6, serverIP); err != nil {
+			return err
+		}
+	}
+
+	if pr.KCP != nil && pr.KCP.Key == "" {
+		key, err := secret.Generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		if pr.KCP.Key, err = p.ask(initOpts.key, "KCP key", key, nil); err != nil {
+			return err
+		}
+	}
+
+	if pr.Role == "client" {
+		if err := askInbounds(p, pr); err != nil {
+			return err
+		}
+	}
+
+	output, err := p.ask(initOpts.output, "Output file", pr.Role+".yaml", nil)
+	if err != nil {
+		return err
+	}
+	cfg, err := writeConfig(p, output, pr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "\nwrote %s\n", output)
+
+	printPeer(p, cfg, v4, v6)
+	if pr.Role == "server" && raw {
+		if err := firewall(p, pr.Port); err != nil {
+			return err
+		}
+	}
+	if initOpts.service {
+		return installService(p, pr.Role, output)
+	}
+	return nil
+}
+
+// rawParams asks for the addresses and gateways raw packets are sent with.
+// The family the peer is reached over must be configured; the other one is
+// added when it can be detected completely.
+func rawParams(p *prompter, pr *params, iface *net.Interface, v4, v6, serverIP net.IP) error {
+	var err error
+	needV6 := serverIP != nil && serverIP.To4() == nil || pr.Role == "server" && v4 == nil
+	needV4 := !needV6 && (pr.Role == "client" || v4 != nil)
+	if pr.IPv4, err = familyParams(p, iface, v4, false, needV4, pr.Port); err != nil {
+		return err
+	}
+	if pr.IPv6, err = familyParams(p, iface, v6, true, needV6, pr.Port); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		if pr.GUID, err = p.ask("", "Npcap device for "+iface.Name, npcapDevice(v4, v6), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectInterface offers the interfaces that are up and carry an address,
+// defaulting to the one holding the default route.
+func selectInterface(p *prompter) (*net.Interface, error) {
+	if initOpts.iface != "" {
+		return net.InterfaceByName(initOpts.iface)
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []net.Interface
+	var options []string
+	def, routed := 0, false
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		v4, v6 := interfaceAddrs(&iface)
+		if v4 == nil && v6 == nil {
+			continue
+		}
+		var ips []string
+		for _, ip := range []net.IP{v4, v6} {
+			if ip != nil {
+				ips = append(ips, ip.String())
+			}
+		}
+		if gw, _ := netinfo.Gateway(iface.Name, false); gw != nil && !routed {
+			def, routed = len(candidates), true
+		}
+		candidates = append(candidates, iface)
+		options = append(options, fmt.Sprintf("%s (%s)", iface.Name, strings.Join(ips, ", ")))
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no interface is up with an address; pass --interface")
+	}
+	i, err := p.choose("Network interfaces:", options, def)
+	if err != nil {
+		return nil, err
+	}
+	return &candidates[i], nil
+}
+
+// interfaceAddrs returns the first IPv4 and global IPv6 address of iface.
+func interfaceAddrs(iface *net.Interface) (v4, v6 net.IP) {
+	addrs, _ := iface.Addrs()
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if n.IP.To4() != nil && v4 == nil {
+			v4 = n.IP
+		} else if n.IP.To4() == nil && n.IP.IsGlobalUnicast() && v6 == nil {
+			v6 = n.IP
+		}
+	}
+	return v4, v6
+}
+
+func familyParams(p *prompter, iface *net.Interface, ip net.IP, ipv6, required bool, port int) (*addrParams, error) {
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	if ip == nil && !required {
+		return nil, nil
+	}
+
+	gw, mac, lookupErr := netinfo.Router(iface.Name, ipv6)
+	if mac == nil && !required {
+		fmt.Fprintf(p.out, "skipping %s: could not find the gateway MAC address\n", family)
+		return nil, nil
+	}
+
+	def := ""
+	if ip != nil {
+		def = ip.String()
+	}
+	addr, err := p.ask("", family+" address of "+iface.Name, def, func(s string) error {
+		if parsed := net.ParseIP(s); parsed == nil || (parsed.To4() == nil) != ipv6 {
+			return fmt.Errorf("not an %s address", family)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	def = ""
+	if mac != nil {
+		def = mac.String()
+		fmt.Fprintf(p.out, "%s gateway %s is at %s\n", family, gw, mac)
+	} else if gw != nil {
+		fmt.Fprintf(p.out, "%s gateway %s did not answer neighbour discovery\n", family, gw)
+	} else if lookupErr != nil {
+		fmt.Fprintf(p.out, "could not detect the %s gateway: %v\n", family, lookupErr)
+	}
+	routerMAC, err := p.ask("", family+" router MAC", def, func(s string) error {
+		_, err := net.ParseMAC(s)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &addrParams{Addr: net.JoinHostPort(addr, strconv.Itoa(port)), RouterMAC: routerMAC}, nil
+}
+
+// npcapDevice finds the NPF device name carrying one of the addresses.
+func npcapDevice(ips ...net.IP) string {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		return ""
+	}
+	for _, d := range devs {
+		for _, a := range d.Addresses {
+			for _, ip := range ips {
+				if ip != nil && a.IP.Equal(ip) {
+					return d.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func checkListenPort(s string) error {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("enter a port between 1 and 65535")
+	}
+	l, err := net.Listen("tcp", ":"+s)
+	if err != nil {
+		return fmt.Errorf("port %d is already in use", port)
+	}
+	l.Close()
+	return nil
+}
+
+func askInbounds(p *prompter, pr *params) error {
+	socks, err := p.ask(initOpts.socks5, "SOCKS5 listen address ('none' to skip)", "127.0.0.1:1080", func(s string) error {
+		if s == "none" {
+			return nil
+		}
+		_, err := net.ResolveUDPAddr("udp", s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if socks != "none" {
+		pr.SOCKS5 = socks
+	}
+
+	rules := initOpts.forward
+	if len(rules) == 0 && !p.yes {
+		for {
+			rule, err := p.line("Port forward as listen=target[/udp] (empty to finish): ")
+			if err != nil {
+				return err
+			}
+			if rule == "" {
+				break
+			}
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range rules {
+		f, err := parseForward(rule)
+		if err != nil {
+			return err
+		}
+		pr.Forward = append(pr.Forward, f)
+	}
+	return nil
+}
+
+func parseForward(rule string) (forwardParams, error) {
+	listen, target, found := strings.Cut(rule, "=")
+	if !found {
+		return forwardParams{}, fmt.Errorf("forward %q: expected listen=target[/udp]", rule)
+	}
+	proto := "tcp"
+	if t, p, found := strings.Cut(target, "/"); found {
+		target, proto = t, p
+	}
+	if proto != "tcp" && proto != "udp" {
+		return forwardParams{}, fmt.Errorf("forward %q: protocol must be tcp or udp", rule)
+	}
+	return forwardParams{Listen: listen, Target: target, Protocol: proto}, nil
+}
+
+// writeConfig renders the configuration and only moves it into place once
+// conf accepts it.
+func writeConfig(p *prompter, output string, pr *params) (*conf.Conf, error) {
+	if _, err := os.Stat(output); err == nil && !initOpts.force {
+		overwrite, err := p.confirm(output+" exists, overwrite?", false)
+		if err != nil {
+			return nil, err
+		}
+		if !overwrite {
+			return nil, fmt.Errorf("%s exists; pass --force to overwrite", output)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := confTemplate.Execute(&buf, pr); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".paqet-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	cfg, err := conf.LoadFromFile(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("generated configuration is invalid: %w", err)
+	}
+	return cfg, os.Rename(tmp.Name(), output)
+}
+
+// printPeer prints what the other side needs to match this configuration.
+func printPeer(p *prompter, cfg *conf.Conf, v4, v6 net.IP) {
+	var key, transport string
+	var datagram bool
+	if k := cfg.Transport.KCP; k != nil {
+		key, datagram = k.Key, k.Datagram
+		transport = fmt.Sprintf("transport:\n  protocol: %q\n  kcp:\n    mode: %q\n    block: %q\n    key: %q\n", cfg.Transport.Protocol, k.Mode, k.Block_, k.Key)
+	} else {
+		key, datagram = cfg.Transport.QUIC.Key, cfg.Transport.QUIC.Datagram
+		transport = fmt.Sprintf("transport:\n  protocol: %q\n  quic:\n    key: %q\n", cfg.Transport.Protocol, key)
+	}
+	if datagram {
+		transport += "    datagram: true\n"
+	}
+	carrier := ""
+	if c := cfg.Network.Carrier; c != "pcap-raw" {
+		transport = fmt.Sprintf("network:\n  carrier: %q\n\n", c) + transport
+		carrier = " --carrier " + c
+	}
+	if cfg.Role == "server" {
+		host := "<server-ip>"
+		if v4 != nil {
+			host = v4.String()
+		} else if v6 != nil {
+			host = v6.String()
+		}
+		u, err := cfg.URI(host, "")
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(p.out, "\nclient configuration (use the public address if the server is behind NAT):\n\n")
+		fmt.Fprintf(p.out, "server:\n  addr: %q\n\n%s", u.Server, transport)
+		fmt.Fprintf(p.out, "\nor import it on the client:\n\n  paqet config import-uri '%s'\n", u)
+		return
+	}
+
+	_, port, _ := net.SplitHostPort(cfg.Server.Addr_)
+	fmt.Fprintf(p.out, "\nserver configuration:\n\n")
+	fmt.Fprintf(p.out, "listen:\n  addr: \":%s\"\n\n%s", port, transport)
+	if cfg.Transport.Protocol == "kcp" {
+		// The key stays out of the command line, where shell history and ps
+		// would keep it.
+		fmt.Fprintf(p.out, "\nor save the key in /etc/paqet/key on the server and run:\n\n  paqet config init --role server --port %s --key file:/etc/paqet/key%s\n", port, carrier)
+	}
+}
+
+// firewall keeps the server kernel from tracking and resetting the raw
+// flow.
+func firewall(p *prompter, port int) error {
+	if runtime.GOOS != "linux" {
+		fmt.Fprintf(p.out, "\nmake sure the kernel does not answer TCP port %d with RSTs\n", port)
+		return nil
+	}
+	rules := firewallRules(port)
+	fmt.Fprintf(p.out, "\nthe server needs these firewall rules:\n\n")
+	for _, r := range rules {
+		fmt.Fprintf(p.out, "  %s\n", strings.Join(r, " "))
+	}
+	if _, err := exec.LookPath("iptables"); err != nil {
+		fmt.Fprintln(p.out, "\niptables is not installed; add the equivalent nftables rules before starting the server")
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(p.out, "\nrun them as root before starting the server")
+		return nil
+	}
+	apply, err := p.confirm("\nApply them now?", true)
+	if err != nil || !apply {
+		return err
+	}
+	var errs []error
+	for _, r := range rules {
+		if out, err := runCmd(r[0], r[1:]...); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v %s", strings.Join(r, " "), err, out))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func firewallRules(port int) [][]string {
+	p := strconv.Itoa(port)
+	return [][]string{
+		{"iptables", "-t", "raw", "-A", "PREROUTING", "-p", "tcp", "--dport", p, "-j", "NOTRACK"},
+		{"iptables", "-t", "raw", "-A", "OUTPUT", "-p", "tcp", "--sport", p, "-j", "NOTRACK"},
+		{"iptables", "-t", "mangle", "-A", "OUTPUT", "-p", "tcp", "--sport", p, "--tcp-flags", "RST", "RST", "-j", "DROP"},
+	}
+}
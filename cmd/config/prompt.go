@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// yes accepts every default without asking.
+	yes bool
+}
+
+func (p *prompter) line(label string) (string, error) {
+	fmt.Fprint(p.out, label)
+	s, err := p.in.ReadString('\n')
+	if err != nil && s == "" {
+		return "", fmt.Errorf("no answer for %q: %w", strings.TrimSpace(strings.TrimSuffix(label, ": ")), err)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// ask returns preset when it is non-empty, otherwise prompts with def as the
+// default answer until check accepts one.
+func (p *prompter) ask(preset, label, def string, check func(string) error) (string, error) {
+	if check == nil {
+		check = func(string) error { return nil }
+	}
+	if preset != "" {
+		if err := check(preset); err != nil {
+			return "", fmt.Errorf("%s: %v", label, err)
+		}
+		return preset, nil
+	}
+	if p.yes {
+		if def == "" {
+			return "", fmt.Errorf("%s is required", label)
+		}
+		if err := check(def); err != nil {
+			return "", fmt.Errorf("%s: %v", label, err)
+		}
+		return def, nil
+	}
+
+	prompt := label + ": "
+	if def != "" {
+		prompt = fmt.Sprintf("%s [%s]: ", label, def)
+	}
+	for {
+		v, err := p.line(prompt)
+		if err != nil {
+			return "", err
+		}
+		if v == "" {
+			v = def
+		}
+		if v == "" {
+			fmt.Fprintln(p.out, "  a value is required")
+			continue
+		}
+		if err := check(v); err != nil {
+			fmt.Fprintf(p.out, "  %v\n", err)
+			continue
+		}
+		return v, nil
+	}
+}
+
+func (p *prompter) confirm(label string, def bool) (bool, error) {
+	if p.yes {
+		return def, nil
+	}
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		v, err := p.line(fmt.Sprintf("%s [%s]: ", label, hint))
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(v) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// choose lists options and returns the index picked, def when accepted.
+func (p *prompter) choose(label string, options []string, def int) (int, error) {
+	if p.yes {
+		return def, nil
+	}
+	fmt.Fprintln(p.out, label)
+	for i, o := range options {
+		fmt.Fprintf(p.out, "  [%d] %s\n", i+1, o)
+	}
+	v, err := p.ask("", "Select", strconv.Itoa(def+1), func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > len(options) {
+			return fmt.Errorf("enter a number between 1 and %d", len(options))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, _ := strconv.Atoi(v)
+	return n - 1, nil
+}
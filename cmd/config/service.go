@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const unitTemplate = `[Unit]
+Description=paqet %s (%s)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%s run -c %s
+Restart=always
+RestartSec=5
+LimitNOFILE=1048576
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// installService writes a systemd unit running the generated configuration
+// and starts it.
+func installService(p *prompter, role, output string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("--service is only supported on linux")
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cfgPath, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	name := "paqet-" + role + "-" + strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+	unit := filepath.Join("/etc/systemd/system", name+".service")
+	if err := os.WriteFile(unit, fmt.Appendf(nil, unitTemplate, role, cfgPath, bin, cfgPath), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", unit, err)
+	}
+	if out, err := runCmd("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl daemon-reload: %v %s", err, out)
+	}
+	if out, err := runCmd("systemctl", "enable", "--now", name); err != nil {
+		return fmt.Errorf("systemctl enable %s: %v %s", name, err, out)
+	}
+	fmt.Fprintf(p.out, "\nstarted %s; follow it with: journalctl -u %s -f\n", name, name)
+	return nil
+}
+
+func runCmd(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var format string
+
+var validateCmd = &cobra.Command{
+	Use:          "validate [flags] [file...]",
+	Short:        "Checks configuration files without starting anything.",
+	Long:         `The 'validate' command loads each configuration file, or the one given with -c, and lists every validation error. It exits nonzero if any file is invalid.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Each argument is a configuration of its own; without any, the
+		// -c paths are merged into one.
+		sets := [][]string{confPaths}
+		if len(args) > 0 {
+			sets = nil
+			for _, path := range args {
+				sets = append(sets, []string{path})
+			}
+		}
+		flog.SetLevel(int(flog.None))
+		failed := 0
+		for _, paths := range sets {
+			name := strings.Join(paths, ", ")
+			cfg, err := conf.Load(paths...)
+			if err != nil {
+				fmt.Printf("%s: %v\n", name, err)
+				failed++
+				continue
+			}
+			var roles []string
+			for _, t := range cfg.Tunnels() {
+				roles = append(roles, strings.TrimSpace(t.Role+" "+t.Name))
+			}
+			fmt.Printf("%s: ok (%s)\n", name, strings.Join(roles, ", "))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d configurations are invalid", failed, len(sets))
+		}
+		return nil
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:          "show [flags]",
+	Short:        "Prints the effective configuration with defaults filled in.",
+	Long:         `The 'show' command loads the configuration, applies every default and prints the result as yaml or json. Keys and passwords are masked.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if format != "yaml" && format != "json" {
+			return fmt.Errorf("format must be yaml or json")
+		}
+		flog.SetLevel(int(flog.None))
+		cfg, err := conf.Load(confPaths...)
+		if err != nil {
+			return err
+		}
+		data, err := cfg.Dump(format)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rsc.io/qr"
+)
+
+var exportOpts struct {
+	host string
+	name string
+	qr   bool
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportOpts.host, "host", "", "Address clients reach the server at (default: the configured interface address).")
+	exportCmd.Flags().StringVar(&exportOpts.name, "name", "", "Label stored in the URI fragment.")
+	exportCmd.Flags().BoolVar(&exportOpts.qr, "qr", false, "Also print the URI as a QR code.")
+	addGenerateFlags(importCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:          "export-uri [flags]",
+	Short:        "Prints a paqet:// URI that clients can import.",
+	Long:         `The 'export-uri' command encodes the server address, transport settings, key and TCP flags of a server configuration into a paqet:// URI for 'paqet config import-uri'.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flog.SetLevel(int(flog.None))
+		cfg, err := conf.Load(confPaths...)
+		if err != nil {
+			return err
+		}
+		if cfg, err = cfg.Tunnel(instance); err != nil {
+			return err
+		}
+		host := exportOpts.host
+		if host == "" && cfg.Network.IPv4.Addr == nil && cfg.Network.IPv6.Addr == nil {
+			return fmt.Errorf("pass --host with the address clients reach the server at")
+		}
+		if host == "" {
+			if a := cfg.Network.IPv4.Addr; a != nil {
+				host = a.IP.String()
+			} else {
+				host = cfg.Network.IPv6.Addr.IP.String()
+			}
+		}
+		u, err := cfg.URI(host, exportOpts.name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(u)
+		if exportOpts.qr {
+			return printQR(os.Stdout, u.String())
+		}
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:          "import-uri [flags] <uri>",
+	Short:        "Generates a client configuration from a paqet:// URI.",
+	Long:         `The 'import-uri' command takes the server and transport settings from a URI made by 'paqet config export-uri', detects the local network settings and asks for inbounds like 'paqet config init'. Pass '-' to read the URI from stdin.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := bufio.NewReader(os.Stdin)
+		s := args[0]
+		if s == "-" {
+			line, err := in.ReadString('\n')
+			if err != nil && line == "" {
+				return err
+			}
+			s = line
+		}
+		u, err := conf.ParseURI(s)
+		if err != nil {
+			return err
+		}
+		if u.Name != "" {
+			fmt.Printf("importing %s (%s)\n", u.Name, u.Server)
+		}
+
+		initOpts.role = "client"
+		initOpts.server = u.Server
+		tcp := u.TCP
+		pr := &params{Carrier: u.Carrier, KCP: u.Transport.KCP, QUIC: u.Transport.QUIC}
+		if len(tcp.LF_) > 0 || len(tcp.RF_) > 0 {
+			pr.TCP = &tcp
+		}
+		p := &prompter{in: in, out: os.Stdout, yes: initOpts.yes}
+		return runInit(p, pr)
+	},
+}
+
+// printQR draws the code with half blocks, two modules per character, light
+// on dark as terminals usually are.
+func printQR(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return err
+	}
+	const quiet = 2
+	dark := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return false
+		}
+		return code.Black(x, y)
+	}
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			switch top, bottom := !dark(x, y), !dark(x, y+1); {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteByte('\n')
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,120 @@
+package ctl
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/control"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPaths []string
+	addr      string
+	token     string
+	instance  string
+	timeout   time.Duration
+)
+
+func init() {
+	Cmd.PersistentFlags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to the configuration of the running instance; repeat to merge several.")
+	Cmd.PersistentFlags().StringVar(&addr, "addr", "", "Control API address (unix:/path or 127.0.0.1:port), overrides the config.")
+	Cmd.PersistentFlags().StringVar(&token, "token", "", "Control API token, or env:NAME or file:path; defaults to the configured one.")
+	Cmd.PersistentFlags().StringVar(&instance, "instance", "", "Instance whose connections to act on when several are running.")
+	drainCmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Recycle the connection after this long even if streams remain.")
+
+	Cmd.AddCommand(killCmd, closeCmd, drainCmd, reconnectCmd, logLevelCmd, reloadCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:          "ctl",
+	Short:        "Administers a running instance through its control API.",
+	SilenceUsage: true,
+}
+
+var killCmd = &cobra.Command{
+	Use:   "kill <stream-id>",
+	Short: "Closes a stream or UDP session listed by 'paqet status'.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid stream id '%s'", args[0])
+		}
+		return run(func(c *control.Client) (string, error) { return c.KillStream(id) })
+	},
+}
+
+var closeCmd = &cobra.Command{
+	Use:   "close <conn-id>",
+	Short: "Closes a transport connection; on the server this drops a client session.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid connection id '%s'", args[0])
+		}
+		return run(func(c *control.Client) (string, error) { return c.CloseConn(id) })
+	},
+}
+
+var drainCmd = &cobra.Command{
+	Use:   "drain <conn-id>",
+	Short: "Stops opening streams on a client connection and recycles it once idle.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid connection id '%s'", args[0])
+		}
+		return run(func(c *control.Client) (string, error) { return c.DrainConn(id, timeout) })
+	},
+}
+
+var reconnectCmd = &cobra.Command{
+	Use:   "reconnect",
+	Short: "Re-establishes all client connections.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(func(c *control.Client) (string, error) { return c.Reconnect() })
+	},
+}
+
+var logLevelCmd = &cobra.Command{
+	Use:   "log-level <none|debug|info|warn|error|fatal>",
+	Short: "Changes the log level without a restart.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(func(c *control.Client) (string, error) { return c.SetLogLevel(args[0]) })
+	},
+}
+
+func run(fn func(c *control.Client) (string, error)) error {
+	c, err := control.Connect(addr, token, confPaths...)
+	if err != nil {
+		return err
+	}
+	c.SetInstance(instance)
+	res, err := fn(c)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
+	return nil
+}
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Re-reads the configuration file of the running instance.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(func(c *control.Client) (string, error) {
+			res, err := c.Reload()
+			if err != nil {
+				return "", err
+			}
+			return res.String(), nil
+		})
+	},
+}
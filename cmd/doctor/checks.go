@@ -0,0 +1,268 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/cmd/version"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/pkg/netinfo"
+	"github.com/starco76/paqet/internal/socket"
+	"net"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gopacket/gopacket/pcap"
+)
+
+// addrs returns the configured local addresses, IPv4 first.
+func (d *doctor) addrs() []*net.UDPAddr {
+	var addrs []*net.UDPAddr
+	if a := d.cfg.Network.IPv4.Addr; a != nil {
+		addrs = append(addrs, a)
+	}
+	if a := d.cfg.Network.IPv6.Addr; a != nil {
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
+
+func (d *doctor) checkInterface() result {
+	iface := d.cfg.Network.Interface
+	if iface.Flags&net.FlagUp == 0 {
+		return fail(fmt.Sprintf("interface %s is down", iface.Name), fmt.Sprintf("bring it up (ip link set %s up) or set network.interface to the uplink", iface.Name))
+	}
+
+	ifAddrs, err := iface.Addrs()
+	if err != nil {
+		return warn(fmt.Sprintf("could not list addresses on %s: %v", iface.Name, err), "")
+	}
+	var have []string
+	for _, a := range ifAddrs {
+		if n, ok := a.(*net.IPNet); ok {
+			have = append(have, n.IP.String())
+		}
+	}
+	for _, a := range d.addrs() {
+		if a.IP.IsUnspecified() {
+			return fail(fmt.Sprintf("%s is not a usable source address", a.IP), fmt.Sprintf("set network.ipv4/ipv6 addr to the address of %s: %s", iface.Name, strings.Join(have, ", ")))
+		}
+		assigned := false
+		for _, h := range have {
+			if h == a.IP.String() {
+				assigned = true
+			}
+		}
+		if !assigned {
+			return fail(fmt.Sprintf("%s is not assigned to %s", a.IP, iface.Name), fmt.Sprintf("use one of %s's addresses: %s", iface.Name, strings.Join(have, ", ")))
+		}
+	}
+	return ok("%s is up (mtu %d, %s)", iface.Name, iface.MTU, iface.HardwareAddr)
+}
+
+func (d *doctor) checkPcap() result {
+	netCfg := d.cfg.Network
+	netCfg.Port = d.port
+	rh, err := socket.NewRecvHandle(&netCfg)
+	if err != nil {
+		return fail(err.Error(), pcapFix(err))
+	}
+	rh.Close()
+	sh, err := socket.NewSendHandle(&netCfg)
+	if err != nil {
+		return fail(err.Error(), pcapFix(err))
+	}
+	sh.Close()
+	d.pcap = true
+	return ok("opened capture and inject handles on %s", socket.Device(&netCfg))
+}
+
+func pcapFix(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "permission") || strings.Contains(msg, "not permitted"):
+		return "run as root or grant the binary raw socket access: setcap cap_net_raw,cap_net_admin+ep $(which paqet)"
+	case runtime.GOOS == "windows":
+		return "install Npcap and check that network.guid matches the adapter (see 'paqet iface')"
+	default:
+		return "check network.interface against 'paqet iface' and that libpcap is installed"
+	}
+}
+
+// checkRouter compares the configured router MACs with the neighbour
+// entries of the default gateways on the interface.
+func (d *doctor) checkRouter() []result {
+	var results []result
+	name := d.cfg.Network.Interface.Name
+	for _, a := range []struct {
+		family string
+		addr   conf.Addr
+	}{{"ipv4", d.cfg.Network.IPv4}, {"ipv6", d.cfg.Network.IPv6}} {
+		if a.addr.Addr == nil {
+			continue
+		}
+		gw, mac, err := netinfo.Router(name, a.family == "ipv6")
+		if err != nil {
+			results = append(results, skip("could not look up the %s gateway: %v; compare router_mac with 'arp -a' or 'ip neigh'", a.family, err))
+			continue
+		}
+		results = append(results, compareRouter(a.family, a.addr.Router, gw, mac))
+	}
+	return results
+}
+
+func compareRouter(family string, want net.HardwareAddr, gw net.IP, have net.HardwareAddr) result {
+	switch {
+	case gw == nil:
+		return warn(fmt.Sprintf("no default %s route on this interface; router_mac %s not verified", family, want),
+			fmt.Sprintf("make sure network.%s.router_mac is the next hop towards the peer", family))
+	case have == nil:
+		return warn(fmt.Sprintf("gateway %s did not answer neighbour discovery", gw),
+			fmt.Sprintf("check that %s is reachable, then run doctor again", gw))
+	case !bytes.Equal(have, want):
+		return fail(fmt.Sprintf("%s router_mac is %s but gateway %s is at %s", family, want, gw, have),
+			fmt.Sprintf("set network.%s.router_mac: \"%s\"", family, have))
+	}
+	return ok("%s router_mac %s matches gateway %s", family, want, gw)
+}
+
+// checkLoopback injects a marked packet addressed to ourselves and waits for
+// it to show up in a capture on the same interface.
+func (d *doctor) checkLoopback() result {
+	if !d.pcap {
+		return skip("pcap handle unavailable")
+	}
+	netCfg := d.cfg.Network
+	netCfg.Port = d.port
+	dst := *d.addrs()[0]
+	dst.Port = d.port
+
+	handle, err := pcap.OpenLive(socket.Device(&netCfg), 65536, false, 100*time.Millisecond)
+	if err != nil {
+		return fail(fmt.Sprintf("could not open capture: %v", err), pcapFix(err))
+	}
+	defer handle.Close()
+	if err := handle.SetBPFFilter(fmt.Sprintf("tcp and src port %d and dst port %d", d.port, d.port)); err != nil {
+		return fail(fmt.Sprintf("could not set capture filter: %v", err), "")
+	}
+
+	sh, err := socket.NewSendHandle(&netCfg)
+	if err != nil {
+		return fail(err.Error(), pcapFix(err))
+	}
+	defer sh.Close()
+	marker := make([]byte, 16)
+	rand.Read(marker)
+	start := time.Now()
+	if err := sh.Write(marker, &dst); err != nil {
+		return fail(fmt.Sprintf("could not inject a packet: %v", err), "check network.interface and that the interface accepts injected frames")
+	}
+
+	for time.Since(start) < 2*time.Second {
+		data, _, err := handle.ReadPacketData()
+		if err != nil {
+			if errors.Is(err, pcap.NextErrorTimeoutExpired) {
+				continue
+			}
+			return fail(fmt.Sprintf("capture failed: %v", err), "")
+		}
+		if bytes.Contains(data, marker) {
+			return ok("injected packet seen on %s after %s", netCfg.Interface.Name, time.Since(start).Round(time.Microsecond))
+		}
+	}
+	return fail("injected packet was not seen on the interface", "check that network.interface is the interface carrying network.ipv4/ipv6 addr and that no filter drops outgoing frames")
+}
+
+// checkPort looks for a kernel socket bound to the paqet port: the kernel
+// would then answer peers itself and tear down the fake TCP flow.
+func (d *doctor) checkPort() result {
+	if d.cfg.Network.Port == 0 {
+		return skip("client uses a random port")
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", d.port))
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fail(fmt.Sprintf("TCP port %d is in use by another process", d.port), fmt.Sprintf("stop it (ss -ltnp 'sport = :%d') or choose another port", d.port))
+		}
+		return warn(fmt.Sprintf("could not probe TCP port %d: %v", d.port, err), "")
+	}
+	l.Close()
+	return ok("no kernel socket bound to TCP port %d", d.port)
+}
+
+// checkCarrier opens the kernel socket a udp or tcp-stream carrier uses.
+func (d *doctor) checkCarrier() result {
+	netCfg := d.cfg.Network
+	open := socket.Open
+	if d.cfg.Role == "server" {
+		open = socket.Listen
+	}
+	conn, err := open(context.Background(), &netCfg)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fail(fmt.Sprintf("port %d is in use by another process", netCfg.Port), "stop it or choose another port")
+		}
+		return fail(fmt.Sprintf("could not open the %s socket: %v", netCfg.Carrier, err), "check network.ipv4/ipv6 addr against the addresses of this host")
+	}
+	conn.Close()
+	if netCfg.Port == 0 {
+		return ok("%s socket opens on a random port", netCfg.Carrier)
+	}
+	return ok("%s socket opens on port %d", netCfg.Carrier, netCfg.Port)
+}
+
+// checkMTU makes sure a full KCP packet wrapped in IP and our largest TCP
+// header still fits the interface MTU.
+func (d *doctor) checkMTU() result {
+	kcp := d.cfg.Transport.KCP
+	if kcp == nil || d.cfg.Transport.Protocol != "kcp" {
+		return skip("no KCP transport configured")
+	}
+	overhead := 20 + 40 // IPv4 + TCP with SYN options
+	if d.cfg.Network.IPv6.Addr != nil {
+		overhead = 40 + 40
+	}
+	mtu := d.cfg.Network.Interface.MTU
+	if kcp.MTU+overhead > mtu {
+		return fail(fmt.Sprintf("transport.kcp.mtu %d plus %d bytes of headers exceeds %s mtu %d", kcp.MTU, overhead, d.cfg.Network.Interface.Name, mtu),
+			fmt.Sprintf("set transport.kcp.mtu to %d or less", mtu-overhead))
+	}
+	return ok("%d + %d header bytes fit %s mtu %d", kcp.MTU, overhead, d.cfg.Network.Interface.Name, mtu)
+}
+
+// clockFloor stands in for the build time when the binary does not record
+// one; no correct clock reads earlier.
+var clockFloor = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// buildTime is when this binary was built, from the release build flags or
+// the VCS stamp, falling back to clockFloor.
+func buildTime() time.Time {
+	if t, err := time.Parse("2006-01-02 15:04:05 MST", version.BuildTime); err == nil {
+		return t
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key != "vcs.time" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				return t
+			}
+		}
+	}
+	return clockFloor
+}
+
+// checkWallClock catches clocks that were never set, which make log and
+// access log timestamps useless. A clock earlier than the build can't be right.
+func checkWallClock() (result, bool) {
+	if now, built := time.Now(), buildTime(); now.Before(built) {
+		return fail(fmt.Sprintf("system clock reads %s, before this binary was built on %s", now.Format(time.RFC3339), built.Format(time.DateOnly)), "set the clock and enable time sync (NTP)"), false
+	}
+	return result{}, true
+}
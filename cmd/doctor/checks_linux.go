@@ -0,0 +1,141 @@
+package doctor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const capNetRaw = 13
+
+func checkPermissions() result {
+	if os.Geteuid() == 0 {
+		return ok("running as root")
+	}
+	if capEff()&(1<<capNetRaw) != 0 {
+		return ok("running with CAP_NET_RAW")
+	}
+	return fail("not root and no CAP_NET_RAW", "run with sudo or: setcap cap_net_raw,cap_net_admin+ep $(which paqet)")
+}
+
+// capEff reads the effective capability set of this process.
+func capEff() uint64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, found := strings.CutPrefix(s.Text(), "CapEff:"); found {
+			caps, _ := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+			return caps
+		}
+	}
+	return 0
+}
+
+// checkRST looks for the firewall rules that keep the server kernel from
+// answering paqet's packets with resets, as 'paqet config init' installs them.
+func (d *doctor) checkRST() result {
+	if d.cfg.Role != "server" {
+		return skip("only the server needs RST suppression")
+	}
+	port := d.port
+	fixes := []string{
+		fmt.Sprintf("iptables -t raw -A PREROUTING -p tcp --dport %d -j NOTRACK", port),
+		fmt.Sprintf("iptables -t raw -A OUTPUT -p tcp --sport %d -j NOTRACK", port),
+		fmt.Sprintf("iptables -t mangle -A OUTPUT -p tcp --sport %d --tcp-flags RST RST -j DROP", port),
+	}
+
+	nftFix := "make sure nftables does the equivalent of: " + strings.Join(fixes, "; ")
+	raw, err := exec.Command("iptables", "-t", "raw", "-S").Output()
+	if err == nil {
+		var mangle []byte
+		if mangle, err = exec.Command("iptables", "-t", "mangle", "-S").Output(); err == nil {
+			r := rstRules(port, raw, mangle, fixes)
+			if r.level != lvlOK && nftHasPort(port) {
+				return unknown(fmt.Sprintf("port %d has nftables rules, which doctor cannot check", port), nftFix)
+			}
+			return r
+		}
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		if _, err := exec.LookPath("nft"); err == nil {
+			return unknown("iptables is not installed and doctor cannot check nftables rules", nftFix)
+		}
+		return warn("neither iptables nor nft is installed; cannot tell whether the kernel sends RSTs", "install iptables and add: "+strings.Join(fixes, "; "))
+	}
+	return warn(fmt.Sprintf("could not read iptables rules: %v", err), "run doctor as root, or check by hand that these rules exist: "+strings.Join(fixes, "; "))
+}
+
+func rstRules(port int, raw, mangle []byte, fixes []string) result {
+	have := []bool{
+		hasRule(raw, "-A PREROUTING", fmt.Sprintf("--dport %d", port), "NOTRACK"),
+		hasRule(raw, "-A OUTPUT", fmt.Sprintf("--sport %d", port), "NOTRACK"),
+		hasRule(mangle, "-A OUTPUT", fmt.Sprintf("--sport %d", port), "RST RST", "-j DROP"),
+	}
+	var missing []string
+	for i, present := range have {
+		if !present {
+			missing = append(missing, fixes[i])
+		}
+	}
+	if len(missing) == 0 {
+		return ok("kernel RSTs on port %d are dropped and the flow is untracked", port)
+	}
+	if !have[2] {
+		return fail(fmt.Sprintf("the kernel will send RSTs for port %d and reset the connection", port), strings.Join(missing, "; "))
+	}
+	return warn(fmt.Sprintf("conntrack is not bypassed for port %d", port), strings.Join(missing, "; "))
+}
+
+// nftHasPort reports whether the nftables ruleset matches on port, which
+// suggests the RST rules were written for nft rather than iptables.
+func nftHasPort(port int) bool {
+	out, err := exec.Command("nft", "list", "ruleset").Output()
+	if err != nil {
+		return false
+	}
+	s := string(out)
+	return strings.Contains(s, fmt.Sprintf("dport %d", port)) || strings.Contains(s, fmt.Sprintf("sport %d", port))
+}
+
+func hasRule(rules []byte, parts ...string) bool {
+	for _, line := range strings.Split(string(rules), "\n") {
+		found := true
+		for _, p := range parts {
+			if !strings.Contains(line, p) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// timeError is the adjtimex state reported while the clock is unsynchronised.
+const timeError = 5
+
+func checkClock() result {
+	if r, sane := checkWallClock(); !sane {
+		return r
+	}
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return skip("could not query clock state: %v", err)
+	}
+	if state == timeError {
+		return warn("system clock is not synchronised", "enable time sync: timedatectl set-ntp true (or run chronyd/ntpd)")
+	}
+	return ok("system clock is synchronised")
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package doctor
+
+import (
+	"os"
+	"runtime"
+)
+
+func checkPermissions() result {
+	if runtime.GOOS == "windows" {
+		return skip("run from an Administrator prompt with Npcap installed")
+	}
+	if os.Geteuid() == 0 {
+		return ok("running as root")
+	}
+	return fail("not running as root", "run with sudo so pcap can open the interface")
+}
+
+func (d *doctor) checkRST() result {
+	if d.cfg.Role != "server" {
+		return skip("only the server needs RST suppression")
+	}
+	return skip("firewall inspection is only implemented on linux; make sure the kernel does not answer port %d with RSTs", d.port)
+}
+
+func checkClock() result {
+	if r, sane := checkWallClock(); !sane {
+		return r
+	}
+	return ok("system clock looks sane")
+}
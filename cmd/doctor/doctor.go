@@ -0,0 +1,138 @@
+package doctor
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"math/rand"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPaths []string
+	instance  string
+)
+
+func init() {
+	Cmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
+	Cmd.Flags().StringVar(&instance, "instance", "", "Instance to use when the configuration lists several.")
+}
+
+var Cmd = &cobra.Command{
+	Use:          "doctor [flags]",
+	Short:        "Checks the host and configuration for common setup problems.",
+	Long:         `The 'doctor' command loads the configuration and checks permissions, the pcap handle, the router MAC, raw packet injection, kernel RST suppression, the clock and the MTU, printing a fix for each problem it finds. With a udp or tcp-stream carrier it only checks that the socket opens and the clock.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flog.SetLevel(int(flog.None))
+		d := &doctor{}
+		cfg, err := conf.Load(confPaths...)
+		if err == nil {
+			cfg, err = cfg.Tunnel(instance)
+		}
+		if err != nil {
+			d.report("config", fail(err.Error(), "fix the configuration errors above and run doctor again"))
+			return d.summary()
+		}
+		d.report("config", ok("loaded %s (%s)", strings.Join(confPaths, ", "), strings.TrimSpace(cfg.Role+" "+cfg.Name)))
+		d.cfg = cfg
+		d.run()
+		return d.summary()
+	},
+}
+
+type level int
+
+const (
+	lvlOK level = iota
+	lvlSkip
+	lvlUnknown
+	lvlWarn
+	lvlFail
+)
+
+var labels = map[level]string{lvlOK: " ok ", lvlSkip: "skip", lvlUnknown: " ?? ", lvlWarn: "warn", lvlFail: "FAIL"}
+
+type result struct {
+	level level
+	msg   string
+	fix   string
+}
+
+func ok(format string, args ...any) result {
+	return result{level: lvlOK, msg: fmt.Sprintf(format, args...)}
+}
+
+func skip(format string, args ...any) result {
+	return result{level: lvlSkip, msg: fmt.Sprintf(format, args...)}
+}
+
+// unknown reports a check that could not tell either way, such as rules kept
+// in a firewall doctor cannot read.
+func unknown(msg, fix string) result {
+	return result{level: lvlUnknown, msg: msg, fix: fix}
+}
+
+func warn(msg, fix string) result {
+	return result{level: lvlWarn, msg: msg, fix: fix}
+}
+
+func fail(msg, fix string) result {
+	return result{level: lvlFail, msg: msg, fix: fix}
+}
+
+type doctor struct {
+	cfg    *conf.Conf
+	port   int
+	counts map[level]int
+	// pcap is false once the interface could not be opened, so checks that
+	// need a handle are skipped rather than failing a second time.
+	pcap bool
+}
+
+func (d *doctor) run() {
+	// A client without a fixed port picks one at random, as socket.New does.
+	d.port = d.cfg.Network.Port
+	if d.port == 0 {
+		d.port = 32768 + rand.Intn(32768)
+	}
+
+	// Kernel socket carriers need none of the raw packet setup.
+	if d.cfg.Network.Carrier != "pcap-raw" {
+		d.report("carrier", d.checkCarrier())
+		d.report("clock", checkClock())
+		return
+	}
+	d.report("permissions", checkPermissions())
+	d.report("interface", d.checkInterface())
+	d.report("pcap", d.checkPcap())
+	for _, r := range d.checkRouter() {
+		d.report("router", r)
+	}
+	d.report("loopback", d.checkLoopback())
+	d.report("port", d.checkPort())
+	d.report("rst", d.checkRST())
+	d.report("clock", checkClock())
+	d.report("mtu", d.checkMTU())
+}
+
+func (d *doctor) report(name string, r result) {
+	if d.counts == nil {
+		d.counts = make(map[level]int)
+	}
+	d.counts[r.level]++
+	fmt.Printf("[%s] %-11s %s\n", labels[r.level], name, r.msg)
+	if r.fix != "" {
+		fmt.Printf("       %-11s fix: %s\n", "", r.fix)
+	}
+}
+
+func (d *doctor) summary() error {
+	fmt.Printf("\n%d ok, %d warnings, %d failed, %d unknown, %d skipped\n", d.counts[lvlOK], d.counts[lvlWarn], d.counts[lvlFail], d.counts[lvlUnknown], d.counts[lvlSkip])
+	if n := d.counts[lvlFail]; n > 0 {
+		return fmt.Errorf("%d checks failed", n)
+	}
+	return nil
+}
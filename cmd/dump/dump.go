@@ -3,9 +3,9 @@ package dump
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/starco76/paqet/internal/flog"
 	"os"
 	"os/signal"
-	"paqet/internal/flog"
 	"strings"
 	"time"
 
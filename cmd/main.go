@@ -1,14 +1,19 @@
 package main
 
 import (
+	"github.com/starco76/paqet/cmd/bench"
+	"github.com/starco76/paqet/cmd/config"
+	"github.com/starco76/paqet/cmd/ctl"
+	"github.com/starco76/paqet/cmd/doctor"
+	"github.com/starco76/paqet/cmd/dump"
+	"github.com/starco76/paqet/cmd/iface"
+	"github.com/starco76/paqet/cmd/ping"
+	"github.com/starco76/paqet/cmd/run"
+	"github.com/starco76/paqet/cmd/secret"
+	"github.com/starco76/paqet/cmd/status"
+	"github.com/starco76/paqet/cmd/version"
+	"github.com/starco76/paqet/internal/flog"
 	"os"
-	"paqet/cmd/dump"
-	"paqet/cmd/iface"
-	"paqet/cmd/ping"
-	"paqet/cmd/run"
-	"paqet/cmd/secret"
-	"paqet/cmd/version"
-	"paqet/internal/flog"
 
 	"github.com/spf13/cobra"
 )
@@ -23,8 +28,13 @@ func main() {
 	rootCmd.AddCommand(run.Cmd)
 	rootCmd.AddCommand(dump.Cmd)
 	rootCmd.AddCommand(ping.Cmd)
+	rootCmd.AddCommand(bench.Cmd)
+	rootCmd.AddCommand(doctor.Cmd)
 	rootCmd.AddCommand(secret.Cmd)
 	rootCmd.AddCommand(iface.Cmd)
+	rootCmd.AddCommand(status.Cmd)
+	rootCmd.AddCommand(ctl.Cmd)
+	rootCmd.AddCommand(config.Cmd)
 	rootCmd.AddCommand(version.Cmd)
 
 	if err := rootCmd.Execute(); err != nil {
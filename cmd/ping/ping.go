@@ -1,51 +1,225 @@
 package ping
 
 import (
-	"log"
-	"paqet/internal/conf"
-	"paqet/internal/socket"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/socket"
+	"github.com/starco76/paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet/transport"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	gokcp "github.com/xtaci/kcp-go/v5"
 )
 
 var (
-	confPath string
-	payload  string
+	confPaths []string
+	instance  string
+	count     int
+	interval  time.Duration
+	timeout   time.Duration
 )
 
 func init() {
-	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file.")
-	Cmd.Flags().StringVar(&payload, "payload", "PING", "The string payload to send in the packet")
+	Cmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
+	Cmd.Flags().StringVar(&instance, "instance", "", "Instance to use when the configuration lists several.")
+	Cmd.Flags().IntVarP(&count, "count", "n", 5, "Number of probes to send (0 to run until interrupted).")
+	Cmd.Flags().DurationVarP(&interval, "interval", "i", time.Second, "Time between probes.")
+	Cmd.Flags().DurationVarP(&timeout, "timeout", "W", 3*time.Second, "How long to wait for each reply.")
 }
 
 var Cmd = &cobra.Command{
-	Use:   "ping [flags]",
-	Short: "Sends a single raw TCP packet with a custom payload.",
-	Run: func(cmd *cobra.Command, args []string) {
-		sendPacket()
+	Use:          "ping [flags]",
+	Short:        "Checks the server end to end with ping/pong exchanges over a transport session.",
+	Long:         `The 'ping' command opens a transport session (KCP or QUIC) to the configured server and times repeated ping/pong exchanges, reporting which stage fails when no reply comes back.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := conf.Load(confPaths...)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if cfg, err = cfg.Tunnel(instance); err != nil {
+			return err
+		}
+		if cfg.Role != "client" {
+			return fmt.Errorf("ping command requires client configuration")
+		}
+		flog.SetLevel(int(flog.None))
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		return run(ctx, cfg)
 	},
 }
 
-func sendPacket() {
-	cfg, err := conf.LoadFromFile(confPath)
+func run(ctx context.Context, cfg *conf.Conf) error {
+	netCfg := cfg.Network
+	via := netCfg.Carrier
+	if netCfg.Interface != nil {
+		via = netCfg.Interface.Name
+	}
+	pConn, err := socket.Open(ctx, &netCfg)
+	if err != nil {
+		return fmt.Errorf("%s send: could not open a socket on %s: %w", netCfg.Carrier, via, err)
+	}
+	proto := cfg.Transport.Protocol
+	conn, err := transport.Dial(cfg.Server.Addr, &cfg.Transport, pConn)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		pConn.Close()
+		return fmt.Errorf("%s handshake: %w", proto, err)
+	}
+	defer conn.Close()
+	// Tell the server which TCP flags to answer with, as the client does.
+	if strm, err := conn.OpenStrm(); err == nil {
+		(&protocol.Proto{Type: protocol.PTCPF, TCPF: cfg.Network.TCP.RF}).Write(strm)
+		strm.Close()
+	}
+
+	if k := cfg.Transport.KCP; proto == "kcp" {
+		fmt.Printf("PING %s via %s (kcp %s, %s)\n", cfg.Server.Addr, via, k.Mode, k.Block_)
+	} else {
+		fmt.Printf("PING %s via %s (%s)\n", cfg.Server.Addr, via, proto)
+	}
+	var st stats
+	prev := snapshot(pConn)
+	next := time.Now()
+probes:
+	for seq := 1; count == 0 || seq <= count; seq++ {
+		select {
+		case <-ctx.Done():
+			break probes
+		case <-time.After(time.Until(next)):
+		}
+		next = time.Now().Add(interval)
+
+		rtt, err := probe(conn, timeout)
+		cur := snapshot(pConn)
+		st.sent++
+		if err == nil {
+			st.add(rtt)
+			fmt.Printf("reply from %s: seq=%d time=%.1f ms\n", cfg.Server.Addr, seq, ms(rtt))
+		} else {
+			fmt.Printf("seq=%d %s\n", seq, diagnose(proto, prev, cur, st.received > 0, err))
+		}
+		prev = cur
+	}
+	if st.sent == 0 {
+		return nil
 	}
 
-	if cfg.Role != "client" {
-		log.Fatalf("Ping command requires client configuration")
+	fmt.Printf("\n--- %s ping statistics ---\n", cfg.Server.Addr)
+	fmt.Printf("%d probes sent, %d received, %.0f%% loss\n", st.sent, st.received, 100*float64(st.sent-st.received)/float64(st.sent))
+	if st.received > 0 {
+		fmt.Printf("rtt min/avg/max/jitter = %.1f/%.1f/%.1f/%.1f ms\n", ms(st.min), ms(st.sum/time.Duration(st.received)), ms(st.max), ms(st.jitter()))
+		return nil
 	}
-	sendHandle, err := socket.NewSendHandle(&cfg.Network)
+	return fmt.Errorf("no replies from %s", cfg.Server.Addr)
+}
+
+// probe times one ping/pong exchange on a fresh stream.
+func probe(conn tnet.Conn, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	strm, err := conn.OpenStrm()
 	if err != nil {
-		log.Fatalf("Failed to create raw socket: %v", err)
+		return 0, err
 	}
-	defer sendHandle.Close()
+	defer strm.Close()
+	strm.SetDeadline(start.Add(timeout))
 
-	log.Printf("Sending packet from IPv4:%s IPv6:%s to %s via %s...", cfg.Network.IPv4.Addr, cfg.Network.IPv6.Addr, cfg.Server.Addr.String(), cfg.Network.Interface.Name)
-	log.Printf("Payload: \"%s\" (%d bytes)", payload, len(payload))
+	p := protocol.Proto{Type: protocol.PPING}
+	if err := p.Write(strm); err != nil {
+		return 0, err
+	}
+	if err := p.Read(strm); err != nil {
+		return 0, err
+	}
+	if p.Type != protocol.PPONG {
+		return 0, fmt.Errorf("unexpected reply type %d", p.Type)
+	}
+	return time.Since(start), nil
+}
 
-	if err := sendHandle.Write([]byte(payload), cfg.Server.Addr); err != nil {
-		log.Fatalf("Failed to send packet: %v", err)
+type counters struct {
+	raw                bool
+	out, outErrors, in uint64 // raw packets
+	csumErrors, segs   uint64 // KCP
+}
+
+// snapshot only has packet counters for a raw socket; kernel socket
+// carriers do not count them.
+func snapshot(pConn net.PacketConn) counters {
+	snmp := gokcp.DefaultSnmp.Copy()
+	c := counters{csumErrors: snmp.InCsumErrors, segs: snmp.InSegs}
+	if raw, ok := pConn.(*socket.PacketConn); ok {
+		s := raw.Stats()
+		c.raw, c.out, c.outErrors, c.in = true, s.OutPackets, s.OutErrors, s.InPackets
+	}
+	return c
+}
+
+// diagnose names the stage that failed from what moved during the probe.
+// The KCP counters tell nothing about other transports.
+func diagnose(proto string, prev, cur counters, replied bool, err error) string {
+	kcp := proto == "kcp"
+	switch {
+	case cur.raw && cur.outErrors > prev.outErrors && cur.out == prev.out:
+		return "raw send failed: packets could not be written; check network.interface and router_mac"
+	case cur.raw && cur.in == prev.in && !replied:
+		return proto + " handshake failed: no packets from the server; it is unreachable, filtered or not running"
+	case cur.raw && cur.in == prev.in:
+		return "timeout: no packets from the server"
+	case !cur.raw && kcp && cur.segs == prev.segs && cur.csumErrors == prev.csumErrors && !replied:
+		return "kcp handshake failed: nothing from the server; it is unreachable, filtered or not running"
+	case kcp && cur.csumErrors > prev.csumErrors && cur.segs == prev.segs:
+		return "decrypt/auth failed: server packets fail the integrity check; transport.kcp.key or block differs from the server"
+	case kcp && cur.segs == prev.segs:
+		return "kcp handshake failed: packets arrive but carry no KCP segments for this session"
+	case !kcp && errors.Is(err, os.ErrDeadlineExceeded):
+		return "stream failed: QUIC is up but the ping stream got no answer"
+	case !kcp:
+		return fmt.Sprintf("stream failed: %v", err)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "smux failed: KCP is up but the ping stream got no answer"
+	default:
+		return fmt.Sprintf("smux failed: %v", err)
 	}
-	log.Printf("Packet sent successfully!")
+}
+
+type stats struct {
+	sent, received int
+	min, max, sum  time.Duration
+	last, diffs    time.Duration
+}
+
+func (s *stats) add(rtt time.Duration) {
+	if s.received == 0 || rtt < s.min {
+		s.min = rtt
+	}
+	s.max = max(s.max, rtt)
+	if s.received > 0 {
+		s.diffs += time.Duration(math.Abs(float64(rtt - s.last)))
+	}
+	s.last = rtt
+	s.sum += rtt
+	s.received++
+}
+
+// jitter is the mean difference between consecutive round-trip times.
+func (s *stats) jitter() time.Duration {
+	if s.received < 2 {
+		return 0
+	}
+	return s.diffs / time.Duration(s.received-1)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
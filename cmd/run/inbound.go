@@ -0,0 +1,129 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/forward"
+	"github.com/starco76/paqet/internal/socks"
+	"sync"
+)
+
+// inbounds keeps the client's SOCKS5 and forward listeners keyed by their
+// settings so a reload only restarts the ones that changed. set records the
+// listeners wanted and sync starts and stops them to match.
+type inbounds struct {
+	ctx      context.Context
+	client   *client.Client
+	mu       sync.Mutex
+	socks5   []conf.SOCKS5
+	forwards []conf.Forward
+	running  map[string]*inbound
+}
+
+type inbound struct {
+	name   string
+	cancel context.CancelFunc
+	wait   func()
+}
+
+type inboundSpec struct {
+	key   string
+	name  string
+	start func(ctx context.Context) (wait func(), err error)
+}
+
+func newInbounds(ctx context.Context, client *client.Client) *inbounds {
+	return &inbounds{ctx: ctx, client: client, running: make(map[string]*inbound)}
+}
+
+func (m *inbounds) set(socks5 []conf.SOCKS5, forwards []conf.Forward) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.socks5, m.forwards = socks5, forwards
+}
+
+// sync waits for removed listeners to close before starting the new ones,
+// which may reuse their addresses. It always applies the latest set, so
+// concurrent syncs end in the same state.
+func (m *inbounds) sync() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	socks5, forwards := m.socks5, m.forwards
+
+	var specs []inboundSpec
+	for _, ss := range socks5 {
+		specs = append(specs, inboundSpec{
+			key:  fmt.Sprintf("socks5 %s %s %s", ss.Listen, ss.Username, ss.Password),
+			name: "SOCKS5 " + ss.Listen.String(),
+			start: func(ctx context.Context) (func(), error) {
+				s, err := socks.New(m.client)
+				if err != nil {
+					return nil, err
+				}
+				if err := s.Start(ctx, ss); err != nil {
+					return nil, err
+				}
+				return s.Wait, nil
+			},
+		})
+	}
+	for _, ff := range forwards {
+		target := "service:" + ff.Service
+		if ff.Service == "" {
+			target = ff.Target.String()
+		}
+		specs = append(specs, inboundSpec{
+			key:  fmt.Sprintf("forward %s %s %s", ff.Protocol, ff.Listen, target),
+			name: fmt.Sprintf("%s forward %s -> %s", ff.Protocol, ff.Listen, target),
+			start: func(ctx context.Context) (func(), error) {
+				var f *forward.Forward
+				var err error
+				if ff.Service != "" {
+					f, err = forward.NewService(m.client, ff.Listen.String(), ff.Service)
+				} else {
+					f, err = forward.New(m.client, ff.Listen.String(), target)
+				}
+				if err != nil {
+					return nil, err
+				}
+				if err := f.Start(ctx, ff.Protocol); err != nil {
+					return nil, err
+				}
+				return f.Wait, nil
+			},
+		})
+	}
+
+	want := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		want[spec.key] = true
+	}
+	for key, in := range m.running {
+		if want[key] {
+			continue
+		}
+		in.cancel()
+		in.wait()
+		delete(m.running, key)
+		flog.Infof("stopped %s", in.name)
+	}
+	var errs []error
+	for _, spec := range specs {
+		if _, ok := m.running[spec.key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		wait, err := spec.start(ctx)
+		if err != nil {
+			cancel()
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", spec.name, err))
+			continue
+		}
+		m.running[spec.key] = &inbound{name: spec.name, cancel: cancel, wait: wait}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,171 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/control"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/server"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// reloader re-reads the configuration file and applies the sections that can
+// change while running. running mirrors what is actually in effect, so a
+// section that needs a restart keeps being reported until it gets one.
+type reloader struct {
+	paths   []string
+	running conf.Conf
+	tunnels map[string]*tunnel
+	mu      sync.Mutex
+}
+
+// tunnel is one running client or server, keyed in the reloader by its
+// instance name, and the configuration in effect for it.
+type tunnel struct {
+	running  conf.Conf
+	server   *server.Server
+	inbounds *inbounds
+}
+
+func newReloader(paths []string, cfg *conf.Conf) *reloader {
+	return &reloader{paths: paths, running: *cfg, tunnels: make(map[string]*tunnel)}
+}
+
+func (r *reloader) reload() (*control.Reload, error) {
+	res, resync, err := r.update()
+	if err != nil {
+		return nil, err
+	}
+	// Outside the lock: stopping a listener waits for it to close.
+	for _, in := range resync {
+		if err := in.sync(); err != nil {
+			flog.Errorf("%v", err)
+		}
+	}
+	return res, nil
+}
+
+// update loads the configuration and applies what changed, returning the
+// inbounds whose listeners still have to be synced.
+func (r *reloader) update() (*control.Reload, []*inbounds, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := conf.Load(r.paths...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(next.Instances) == 0 && len(r.running.Instances) == 0 && next.Role != r.running.Role {
+		return nil, nil, fmt.Errorf("role changed from %s to %s, restart required", r.running.Role, next.Role)
+	}
+
+	res := &control.Reload{}
+	record := func(section string, applied bool) {
+		if applied {
+			res.Applied = append(res.Applied, section)
+		} else {
+			res.Restart = append(res.Restart, section)
+		}
+	}
+	for _, section := range r.running.Diff(next) {
+		if conf.Shared(section) {
+			record(section, r.apply(section, next))
+		}
+	}
+	// Starting or stopping instances needs a restart; the ones that keep
+	// running get their own sections applied.
+	added := false
+	var resync []*inbounds
+	for _, cfg := range next.Tunnels() {
+		t, ok := r.tunnels[cfg.Name]
+		if !ok {
+			added = true
+			continue
+		}
+		for _, section := range t.running.Diff(cfg) {
+			if !conf.Shared(section) && section != "instances" {
+				applied := t.apply(section, cfg)
+				record(cfg.Label(section), applied)
+				if applied && (section == "socks5" || section == "forward") && !slices.Contains(resync, t.inbounds) {
+					resync = append(resync, t.inbounds)
+				}
+			}
+		}
+	}
+	if added || len(next.Tunnels()) != len(r.tunnels) {
+		record("instances", false)
+	}
+	flog.Infof("configuration reloaded from %s: %s", strings.Join(r.paths, ", "), res)
+	for _, section := range res.Restart {
+		flog.Warnf("configuration section '%s' changed but needs a restart to take effect", section)
+	}
+	return res, resync, nil
+}
+
+func (r *reloader) apply(section string, next *conf.Conf) bool {
+	switch section {
+	case "log":
+		if err := setupLog(&next.Log); err != nil {
+			flog.Errorf("failed to apply log configuration: %v", err)
+			return false
+		}
+		r.running.Log = next.Log
+	default:
+		return false
+	}
+	return true
+}
+
+func (t *tunnel) apply(section string, next *conf.Conf) bool {
+	switch section {
+	case "acl":
+		if t.server == nil {
+			return false
+		}
+		t.server.SetACL(&next.ACL)
+		t.running.ACL = next.ACL
+	case "limits":
+		if t.server == nil {
+			return false
+		}
+		t.server.SetLimits(&next.Limits)
+		t.running.Limits = next.Limits
+	case "socks5":
+		if t.inbounds == nil {
+			return false
+		}
+		t.inbounds.set(next.SOCKS5, t.running.Forward)
+		t.running.SOCKS5 = next.SOCKS5
+	case "forward":
+		if t.inbounds == nil {
+			return false
+		}
+		t.inbounds.set(t.running.SOCKS5, next.Forward)
+		t.running.Forward = next.Forward
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *reloader) watch(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-sig:
+			if _, err := r.reload(); err != nil {
+				flog.Errorf("configuration reload failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,45 +1,123 @@
 package run
 
 import (
+	"context"
+	"github.com/starco76/paqet/internal/accesslog"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/control"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/buffer"
 	"log"
-	"paqet/internal/conf"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var confPath string
+var confPaths []string
 
 func init() {
-	Cmd.Flags().StringVarP(&confPath, "config", "c", "config.yaml", "Path to the configuration file.")
+	Cmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to a configuration file or directory; repeat to merge several.")
 }
 
 var Cmd = &cobra.Command{
 	Use:   "run",
-	Short: "Runs the client or server based on the config file.",
+	Short: "Runs the client or server based on the config file, or every instance it lists.",
 	Long:  `The 'run' command reads the specified YAML configuration file.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := conf.LoadFromFile(confPath)
+		cfg, err := conf.Load(confPaths...)
 		if err != nil {
 			log.Fatalf("Failed to load configuration: %v", err)
 		}
 		initialize(cfg)
+		start(cfg)
+	},
+}
 
-		switch cfg.Role {
-		case "client":
-			startClient(cfg)
-			return
-		case "server":
-			startServer(cfg)
-			return
+// start runs every client and server of cfg until a shutdown signal.
+func start(cfg *conf.Conf) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	r := newReloader(confPaths, cfg)
+	ctl := control.New()
+	ctl.SetReload(r.reload)
+	var wg sync.WaitGroup
+	for _, t := range cfg.Tunnels() {
+		if t.Role == "client" {
+			r.tunnels[t.Name] = startClient(ctx, t, ctl)
+		} else {
+			r.tunnels[t.Name] = startServer(ctx, t, ctl, &wg)
 		}
+	}
+	serveControl(ctx, cfg, ctl)
+	go r.watch(ctx)
 
-		log.Fatalf("Failed to load configuration")
-	},
+	<-ctx.Done()
+	flog.Infof("Shutdown signal received, initiating graceful shutdown...")
+	wg.Wait()
+}
+
+func describe(cfg *conf.Conf) string {
+	if cfg.Name == "" {
+		return cfg.Role
+	}
+	return cfg.Role + " " + cfg.Name
+}
+
+func serveControl(ctx context.Context, cfg *conf.Conf, srv *control.Server) {
+	if cfg.Control.Listen == "" {
+		return
+	}
+	go func() {
+		if err := srv.Serve(ctx, &cfg.Control); err != nil {
+			flog.Errorf("control API failed: %v", err)
+		}
+	}()
 }
 
 func initialize(cfg *conf.Conf) {
-	flog.SetLevel(cfg.Log.Level)
-	buffer.Initialize(cfg.Transport.TCPBuf, cfg.Transport.UDPBuf)
+	if err := setupLog(&cfg.Log); err != nil {
+		log.Fatalf("Failed to open log file: %v", err)
+	}
+	if cfg.AccessLog.File != "" {
+		al, err := accesslog.Open(&cfg.AccessLog)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		metrics.OnStreamClose(al.Log)
+	}
+	// The buffer pools are process-wide, so they fit the largest instance.
+	var tcpBuf, udpBuf int
+	for _, t := range cfg.Tunnels() {
+		tcpBuf, udpBuf = max(tcpBuf, t.Transport.TCPBuf), max(udpBuf, t.Transport.UDPBuf)
+	}
+	buffer.Initialize(tcpBuf, udpBuf)
+	if cfg.Metrics.Listen != nil {
+		go func() {
+			if err := metrics.Serve(context.Background(), cfg.Metrics.Listen.String(), cfg.Metrics.Path); err != nil {
+				flog.Errorf("metrics listener failed: %v", err)
+			}
+		}()
+	}
+}
+
+func setupLog(cfg *conf.Log) error {
+	if cfg.File == "" {
+		flog.SetOutput(os.Stdout)
+	} else {
+		f, err := flog.OpenFile(cfg.File, int64(cfg.MaxSize)<<20, time.Duration(cfg.MaxAge)*time.Hour, cfg.MaxBackups)
+		if err != nil {
+			return err
+		}
+		flog.SetOutput(f)
+	}
+	flog.SetJSON(cfg.Format == "json")
+	flog.SetLevels(cfg.Levels)
+	flog.SetLevel(cfg.Level)
+	return nil
 }
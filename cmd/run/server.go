@@ -1,19 +1,25 @@
 package run
 
 import (
-	"paqet/internal/conf"
-	"paqet/internal/flog"
-	"paqet/internal/server"
+	"context"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/control"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/server"
+	"sync"
 )
 
-func startServer(cfg *conf.Conf) {
-	flog.Infof("Starting server...")
-
+func startServer(ctx context.Context, cfg *conf.Conf, ctl *control.Server, wg *sync.WaitGroup) *tunnel {
+	flog.Infof("Starting %s...", describe(cfg))
 	server, err := server.New(cfg)
 	if err != nil {
 		flog.Fatalf("Failed to initialize server: %v", err)
 	}
-	if err := server.Start(); err != nil {
-		flog.Fatalf("Server encountered an error: %v", err)
-	}
+	ctl.Add(cfg.Name, cfg.Role, server)
+	wg.Go(func() {
+		if err := server.Start(ctx); err != nil {
+			flog.Fatalf("Server encountered an error: %v", err)
+		}
+	})
+	return &tunnel{running: *cfg, server: server}
 }
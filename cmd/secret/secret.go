@@ -3,7 +3,7 @@ package secret
 import (
 	"crypto/rand"
 	"fmt"
-	"paqet/internal/flog"
+	"github.com/starco76/paqet/internal/flog"
 
 	"github.com/spf13/cobra"
 )
@@ -13,11 +13,19 @@ var Cmd = &cobra.Command{
 	Short: "Generates a secure, random 32-byte secret key.",
 	Long:  `This command generates a cryptographically secure 32-byte (256-bit) key and prints it. Use this key for the 'encryption.key' field in your config.yaml.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		length := 32
-		key := make([]byte, length)
-		if _, err := rand.Read(key); err != nil {
+		key, err := Generate()
+		if err != nil {
 			flog.Fatalf("Failed to generate random key: %v", err)
 		}
-		fmt.Printf("%x\n", key)
+		fmt.Println(key)
 	},
 }
+
+// Generate returns a random 32-byte key, hex encoded.
+func Generate() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", key), nil
+}
@@ -0,0 +1,129 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/starco76/paqet/internal/control"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confPaths []string
+	addr      string
+	token     string
+	asJSON    bool
+)
+
+func init() {
+	Cmd.Flags().StringSliceVarP(&confPaths, "config", "c", []string{"config.yaml"}, "Path to the configuration of the running instance; repeat to merge several.")
+	Cmd.Flags().StringVar(&addr, "addr", "", "Control API address (unix:/path or 127.0.0.1:port), overrides the config.")
+	Cmd.Flags().StringVar(&token, "token", "", "Control API token, or env:NAME or file:path; defaults to the configured one.")
+	Cmd.Flags().BoolVar(&asJSON, "json", false, "Print the raw JSON status.")
+}
+
+var Cmd = &cobra.Command{
+	Use:          "status",
+	Short:        "Shows connections, streams and counters of a running instance.",
+	Long:         `The 'status' command queries the control API of a running paqet instance.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := control.Connect(addr, token, confPaths...)
+		if err != nil {
+			return err
+		}
+		st, err := c.Status()
+		if err != nil {
+			return fmt.Errorf("failed to query status: %w", err)
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(st)
+		}
+		render(st)
+		return nil
+	},
+}
+
+func render(st *control.Status) {
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(st.Instances) == 0 {
+		fmt.Printf("Role: %s  Uptime: %s  Log level: %s\n\n", st.Role, now.Sub(st.Started).Round(time.Second), st.LogLevel)
+		renderConns(w, st.Conns)
+	} else {
+		fmt.Printf("Instances: %d  Uptime: %s  Log level: %s\n\n", len(st.Instances), now.Sub(st.Started).Round(time.Second), st.LogLevel)
+		for _, in := range st.Instances {
+			fmt.Printf("Instance %s (%s)\n", in.Name, in.Role)
+			renderConns(w, in.Conns)
+			if in.Role == "client" {
+				fmt.Println()
+				renderUDP(w, in.UDP)
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Printf("KCP: retransmits %d (fast %d), lost %d, FEC recovered %d, segments in %d out %d\n\n",
+		st.KCP.Retransmits, st.KCP.FastRetransmits, st.KCP.LostSegments, st.KCP.FECRecovered, st.KCP.InSegments, st.KCP.OutSegments)
+
+	if len(st.Inbounds) > 0 {
+		fmt.Fprintln(w, "INBOUND\tOPENED\tACTIVE\tERRORS\tUP\tDOWN")
+		for _, in := range st.Inbounds {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", in.Name, in.Opened, in.Active, in.Errors, bytes(in.Up), bytes(in.Down))
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	fmt.Fprintln(w, "ID\tINBOUND\tNET\tSID\tSOURCE\tTARGET\tAGE\tUP\tDOWN")
+	for _, s := range st.Streams {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			s.ID, s.Inbound, s.Network, s.SID, s.Source, s.Target, now.Sub(s.Started).Round(time.Second), bytes(s.Up), bytes(s.Down))
+	}
+	w.Flush()
+
+	if st.Role == "client" {
+		fmt.Println()
+		renderUDP(w, st.UDP)
+	}
+}
+
+func renderConns(w *tabwriter.Writer, conns []control.Conn) {
+	fmt.Fprintln(w, "CONN\tLOCAL\tREMOTE\tRTT\tRTTVAR\tRTO\tSNDWND\tRCVWND\tSTREAMS\tSTATE")
+	for _, c := range conns {
+		state := "active"
+		if c.Draining {
+			state = "draining"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%.0fms\t%.0fms\t%.0fms\t%d\t%d\t%d\t%s\n",
+			c.ID, c.Local, c.Remote, c.RTT, c.RTTVar, c.RTO, c.SendWindow, c.RecvWindow, c.Streams, state)
+	}
+	w.Flush()
+}
+
+func renderUDP(w *tabwriter.Writer, sessions []control.UDPSession) {
+	now := time.Now()
+	fmt.Fprintln(w, "UDP SESSION\tSID\tSOURCE\tTARGET\tAGE")
+	for _, u := range sessions {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", u.Key, u.SID, u.Source, u.Target, now.Sub(u.Started).Round(time.Second))
+	}
+	w.Flush()
+}
+
+func bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
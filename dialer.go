@@ -0,0 +1,95 @@
+package paqet
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Dialer opens connections through a paqet server.
+type Dialer struct {
+	client *client.Client
+	cancel context.CancelFunc
+	seq    atomic.Uint64
+}
+
+// NewDialer connects to opts.Server. The connections to it stay open until
+// ctx is done or Close is called.
+func NewDialer(ctx context.Context, opts Options) (*Dialer, error) {
+	cfg, err := opts.conf("client")
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if err := c.Start(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Dialer{client: c, cancel: cancel}, nil
+}
+
+// Dial is DialContext without a context.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext has the server connect to addr over tcp or udp and returns a
+// stream relaying to it. A udp conn keeps message boundaries for writes up
+// to the stream frame size.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	return conn, nil
+}
+
+// DialService opens a stream to the service the server registered as name.
+func (d *Dialer) DialService(ctx context.Context, name string) (net.Conn, error) {
+	return d.DialContext(ctx, "service", name)
+}
+
+func (d *Dialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return d.client.TCP(ctx, addr)
+	case "udp", "udp4", "udp6":
+		// Every call gets a session of its own; the source only has to be
+		// unique.
+		src := fmt.Sprintf("dialer/%d", d.seq.Add(1))
+		strm, _, key, err := d.client.UDP(ctx, src, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &udpConn{Strm: strm, close: func() { d.client.CloseUDP(key) }}, nil
+	case "service":
+		return d.client.Service(ctx, addr)
+	}
+	return nil, net.UnknownNetworkError(network)
+}
+
+// Close closes the connections to the server and every stream on them.
+func (d *Dialer) Close() error {
+	d.cancel()
+	return nil
+}
+
+// udpConn returns its session to the client when closed.
+type udpConn struct {
+	tnet.Strm
+	once  sync.Once
+	close func()
+}
+
+func (c *udpConn) Close() error {
+	c.once.Do(c.close)
+	return nil
+}
@@ -0,0 +1,96 @@
+package accesslog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Record describes one relayed TCP connection or UDP session once it closes.
+// CSV lines carry the fields in declaration order, without a header.
+type Record struct {
+	Time     time.Time `json:"time"`
+	ID       uint64    `json:"id"`
+	Inbound  string    `json:"inbound"`
+	Network  string    `json:"network"`
+	Client   string    `json:"client"`
+	Target   string    `json:"target"`
+	Resolved string    `json:"resolved"`
+	Up       int64     `json:"up"`
+	Down     int64     `json:"down"`
+	Duration int64     `json:"duration_ms"`
+	Reason   string    `json:"reason"`
+}
+
+type Logger struct {
+	w   io.WriteCloser
+	csv bool
+	mu  sync.Mutex
+}
+
+func Open(cfg *conf.AccessLog) (*Logger, error) {
+	f, err := flog.OpenFile(cfg.File, int64(cfg.MaxSize)<<20, time.Duration(cfg.MaxAge)*time.Hour, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{w: f, csv: cfg.Format == "csv"}, nil
+}
+
+func NewRecord(s *metrics.Stream) Record {
+	info := s.Info()
+	now := time.Now()
+	return Record{
+		Time:     now,
+		ID:       info.ID,
+		Inbound:  info.Inbound,
+		Network:  info.Network,
+		Client:   info.Source,
+		Target:   info.Target,
+		Resolved: info.Resolved,
+		Up:       info.Up,
+		Down:     info.Down,
+		Duration: now.Sub(info.Started).Milliseconds(),
+		Reason:   s.Reason(),
+	}
+}
+
+// Log writes the record for s; it is meant for metrics.OnStreamClose.
+func (l *Logger) Log(s *metrics.Stream) {
+	if err := l.Write(NewRecord(s)); err != nil {
+		flog.Errorf("failed to write access log: %v", err)
+	}
+}
+
+func (l *Logger) Write(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.csv {
+		w := csv.NewWriter(l.w)
+		w.Write([]string{
+			r.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(r.ID, 10),
+			r.Inbound,
+			r.Network,
+			r.Client,
+			r.Target,
+			r.Resolved,
+			strconv.FormatInt(r.Up, 10),
+			strconv.FormatInt(r.Down, 10),
+			strconv.FormatInt(r.Duration, 10),
+			r.Reason,
+		})
+		w.Flush()
+		return w.Error()
+	}
+	return json.NewEncoder(l.w).Encode(r)
+}
+
+func (l *Logger) Close() error {
+	return l.w.Close()
+}
@@ -0,0 +1,84 @@
+package accesslog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/metrics"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"json": filepath.Join(dir, "access.json"), "csv": filepath.Join(dir, "access.csv")}
+	for format, file := range files {
+		l, err := Open(&conf.AccessLog{File: file, Format: format, MaxSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		metrics.OnStreamClose(l.Log)
+	}
+
+	in := metrics.NewInbound("socks5/127.0.0.1:1080")
+	s := in.Open("tcp", "127.0.0.1:5000", "example.com:443", 3, nil)
+	s.SetResolved("192.0.2.10:443")
+	io.Copy(io.Discard, s.Up(strings.NewReader("request")))
+	io.Copy(io.Discard, s.Down(strings.NewReader("a longer response")))
+	time.Sleep(10 * time.Millisecond)
+	s.End(io.EOF)
+	s.Close()
+	want := Record{
+		ID:       s.ID,
+		Inbound:  "socks5/127.0.0.1:1080",
+		Network:  "tcp",
+		Client:   "127.0.0.1:5000",
+		Target:   "example.com:443",
+		Resolved: "192.0.2.10:443",
+		Up:       7,
+		Down:     17,
+		Reason:   "closed",
+	}
+
+	data, err := os.ReadFile(files["json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Record
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json line %q: %v", data, err)
+	}
+	if got.Duration < 10 || time.Since(got.Time) > time.Minute {
+		t.Errorf("json record time %s, duration %dms", got.Time, got.Duration)
+	}
+	got.Time, got.Duration = time.Time{}, 0
+	if got != want {
+		t.Errorf("json record = %+v, want %+v", got, want)
+	}
+
+	f, err := os.Open(files["csv"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("csv has %d rows, want 1", len(rows))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, rows[0][0]); err != nil {
+		t.Errorf("csv time: %v", err)
+	}
+	wantRow := fmt.Sprintf("%d,socks5/127.0.0.1:1080,tcp,127.0.0.1:5000,example.com:443,192.0.2.10:443,7,17,closed", s.ID)
+	if row := strings.Join(append(rows[0][1:9], rows[0][10]), ","); row != wantRow {
+		t.Errorf("csv row = %s", row)
+	}
+}
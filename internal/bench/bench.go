@@ -0,0 +1,246 @@
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+const (
+	Upload   = "upload"
+	Download = "download"
+)
+
+type Options struct {
+	Streams  int
+	Duration time.Duration
+	Probe    time.Duration // interval between latency probes
+}
+
+type Result struct {
+	Direction string
+	Bytes     int64
+	Elapsed   time.Duration
+	RTT       []time.Duration // sorted
+	Retrans   float64         // share of sent KCP segments that were retransmissions
+	CPU       float64         // process CPU time per wall-clock second, 1 is one core; -1 if unknown
+}
+
+// Throughput is in bits per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * 8 / r.Elapsed.Seconds()
+}
+
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.RTT) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(r.RTT)))) - 1
+	return r.RTT[max(i, 0)]
+}
+
+// Opener opens a benchmark stream served in the given mode.
+type Opener func(mode string) (io.ReadWriteCloser, error)
+
+// Run measures one direction with opts.Streams parallel streams while a
+// separate echo stream samples the round-trip time under that load.
+func Run(open Opener, direction string, opts Options) (*Result, error) {
+	if direction != Upload && direction != Download {
+		return nil, fmt.Errorf("unknown direction '%s'", direction)
+	}
+	snmp := kcp.DefaultSnmp.Copy()
+	cpu, cpuOK := cpuTime()
+	wall := time.Now()
+
+	echo, err := open(Echo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open echo stream: %w", err)
+	}
+	p := startProbe(echo, opts.Probe)
+
+	res := &Result{Direction: direction}
+	if direction == Upload {
+		res.Bytes, res.Elapsed, err = upload(open, opts)
+	} else {
+		res.Bytes, res.Elapsed, err = download(open, opts)
+	}
+	res.RTT = p.stop()
+	if err != nil {
+		return nil, err
+	}
+
+	res.CPU = -1
+	if used, ok := cpuTime(); ok && cpuOK {
+		res.CPU = (used - cpu).Seconds() / time.Since(wall).Seconds()
+	}
+	after := kcp.DefaultSnmp.Copy()
+	if out := after.OutSegs - snmp.OutSegs; out > 0 {
+		res.Retrans = float64(after.RetransSegs-snmp.RetransSegs) / float64(out)
+	}
+	return res, nil
+}
+
+func openAll(open Opener, mode string, n int) ([]io.ReadWriteCloser, error) {
+	strms := make([]io.ReadWriteCloser, 0, n)
+	for range n {
+		s, err := open(mode)
+		if err != nil {
+			closeAll(strms)
+			return nil, fmt.Errorf("failed to open %s stream: %w", mode, err)
+		}
+		strms = append(strms, s)
+	}
+	return strms, nil
+}
+
+func closeAll(strms []io.ReadWriteCloser) {
+	for _, s := range strms {
+		s.Close()
+	}
+}
+
+// upload writes until the deadline and then counts what the server reports
+// as received, waiting for data still in flight to arrive.
+func upload(open Opener, opts Options) (int64, time.Duration, error) {
+	strms, err := openAll(open, Sink, opts.Streams)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeAll(strms)
+
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+	totals := make([]atomic.Int64, len(strms))
+	var last atomic.Int64
+	last.Store(start.UnixNano())
+	var wg sync.WaitGroup
+	for i, s := range strms {
+		wg.Go(func() {
+			buf := make([]byte, chunkSize)
+			for time.Now().Before(deadline) {
+				if _, err := s.Write(buf); err != nil {
+					return
+				}
+			}
+		})
+		go func() {
+			var b [8]byte
+			for {
+				if _, err := io.ReadFull(s, b[:]); err != nil {
+					return
+				}
+				if n := int64(binary.BigEndian.Uint64(b[:])); n > totals[i].Load() {
+					totals[i].Store(n)
+					last.Store(time.Now().UnixNano())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	sum := func() int64 {
+		var n int64
+		for i := range totals {
+			n += totals[i].Load()
+		}
+		return n
+	}
+	for settle := time.Now().Add(10 * time.Second); time.Now().Before(settle); {
+		prev := sum()
+		time.Sleep(3 * reportInterval)
+		if sum() == prev {
+			break
+		}
+	}
+	return sum(), time.Unix(0, last.Load()).Sub(start), nil
+}
+
+func download(open Opener, opts Options) (int64, time.Duration, error) {
+	// Each stream is drained as soon as it opens: an unread source stream
+	// would fill the session buffer and stall opening the next one.
+	var total atomic.Int64
+	strms := make([]io.ReadWriteCloser, 0, opts.Streams)
+	defer func() { closeAll(strms) }()
+	for range opts.Streams {
+		s, err := open(Source)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to open %s stream: %w", Source, err)
+		}
+		strms = append(strms, s)
+		go func() {
+			buf := make([]byte, chunkSize)
+			for {
+				n, err := s.Read(buf)
+				total.Add(int64(n))
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	start, base := time.Now(), total.Load()
+	time.Sleep(opts.Duration)
+	return total.Load() - base, time.Since(start), nil
+}
+
+type probe struct {
+	strm io.ReadWriteCloser
+	rtt  []time.Duration
+	mu   sync.Mutex
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startProbe writes a timestamp to the echo stream every interval and
+// records how long each takes to come back.
+func startProbe(strm io.ReadWriteCloser, interval time.Duration) *probe {
+	p := &probe{strm: strm, done: make(chan struct{})}
+	p.wg.Go(func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		var b [8]byte
+		for {
+			select {
+			case <-t.C:
+				binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+				if _, err := strm.Write(b[:]); err != nil {
+					return
+				}
+			case <-p.done:
+				return
+			}
+		}
+	})
+	p.wg.Go(func() {
+		var b [8]byte
+		for {
+			if _, err := io.ReadFull(strm, b[:]); err != nil {
+				return
+			}
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(b[:])))
+			p.mu.Lock()
+			p.rtt = append(p.rtt, time.Since(sent))
+			p.mu.Unlock()
+		}
+	})
+	return p
+}
+
+func (p *probe) stop() []time.Duration {
+	close(p.done)
+	p.strm.Close()
+	p.wg.Wait()
+	slices.Sort(p.rtt)
+	return p.rtt
+}
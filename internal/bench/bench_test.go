@@ -0,0 +1,177 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLink(t *testing.T) {
+	a, b := NewLink(LinkOptions{Delay: 50 * time.Millisecond})
+	defer a.Close()
+	defer b.Close()
+	start := time.Now()
+	if _, err := a.WriteTo([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, from, err := b.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "hello" || from.String() != a.LocalAddr().String() {
+		t.Fatalf("ReadFrom = %q from %v, %v", buf[:n], from, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("packet arrived after %s, want at least the 50ms delay", d)
+	}
+
+	lossy, sink := NewLink(LinkOptions{Loss: 1})
+	defer lossy.Close()
+	lossy.WriteTo([]byte("lost"), sink.LocalAddr())
+	sink.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := sink.ReadFrom(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadFrom on a lossy link = %v, want deadline exceeded", err)
+	}
+	sink.SetReadDeadline(time.Time{})
+	sink.Close()
+	if _, _, err := sink.ReadFrom(buf); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("ReadFrom after Close = %v, want net.ErrClosed", err)
+	}
+}
+
+// serve runs ServeStream on one end of a pipe after sending mode on the
+// other, which it returns.
+func serve(t *testing.T, mode string) (net.Conn, chan error) {
+	t.Helper()
+	c, s := net.Pipe()
+	t.Cleanup(func() { c.Close() })
+	done := make(chan error, 1)
+	go func() {
+		defer s.Close()
+		done <- ServeStream(s)
+	}()
+	if err := WriteMode(c, mode); err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	return c, done
+}
+
+func TestServe(t *testing.T) {
+	c, _ := serve(t, Echo)
+	msg := []byte("echo this")
+	go c.Write(msg)
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, buf); err != nil || !bytes.Equal(buf, msg) {
+		t.Errorf("echo returned %q, %v", buf, err)
+	}
+
+	c, _ = serve(t, Source)
+	if n, err := io.ReadFull(c, make([]byte, 3*chunkSize)); err != nil {
+		t.Errorf("source sent %d bytes: %v", n, err)
+	}
+
+	// The sink reports the running total of what it has read.
+	c, _ = serve(t, Sink)
+	if _, err := c.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	var b [8]byte
+	for {
+		if _, err := io.ReadFull(c, b[:]); err != nil {
+			t.Fatal(err)
+		}
+		if n := binary.BigEndian.Uint64(b[:]); n == 1000 {
+			break
+		} else if n > 1000 {
+			t.Fatalf("sink reports %d bytes, want 1000", n)
+		}
+	}
+
+	c, done := serve(t, "upside-down")
+	c.Close()
+	if err := <-done; err == nil {
+		t.Errorf("unknown mode was served")
+	}
+	c, s := net.Pipe()
+	go c.Write([]byte("a mode that is far too long\n"))
+	if err := ServeStream(s); err == nil {
+		t.Errorf("an overlong mode was served")
+	}
+	c.Close()
+}
+
+func TestPercentile(t *testing.T) {
+	r := &Result{Bytes: 1 << 20, Elapsed: 2 * time.Second}
+	if r.Percentile(0.5) != 0 {
+		t.Errorf("Percentile without samples = %s", r.Percentile(0.5))
+	}
+	for i := 1; i <= 100; i++ {
+		r.RTT = append(r.RTT, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{0: time.Millisecond, 0.5: 50 * time.Millisecond, 0.99: 99 * time.Millisecond, 1: 100 * time.Millisecond} {
+		if got := r.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %s, want %s", p, got, want)
+		}
+	}
+	if got := r.Throughput(); got != 4194304 {
+		t.Errorf("Throughput() = %v, want 4194304", got)
+	}
+}
+
+func transportConf(t *testing.T, protocol string) *conf.Transport {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "paqet.yaml")
+	yaml := fmt.Sprintf(`role: "client"
+network:
+  carrier: "udp"
+server:
+  addr: "127.0.0.1:9999"
+transport:
+  protocol: %q
+  %s:
+    key: "secret"
+`, protocol, protocol)
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := conf.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cfg.Transport
+}
+
+func TestLocal(t *testing.T) {
+	for _, protocol := range []string{"kcp", "quic"} {
+		t.Run(protocol, func(t *testing.T) {
+			l, err := NewLocal(transportConf(t, protocol), LinkOptions{Delay: 5 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			opts := Options{Streams: 2, Duration: 300 * time.Millisecond, Probe: 20 * time.Millisecond}
+			for _, dir := range []string{Upload, Download} {
+				res, err := Run(l.Open, dir, opts)
+				if err != nil {
+					t.Fatalf("Run(%s): %v", dir, err)
+				}
+				if res.Bytes == 0 || res.Elapsed <= 0 {
+					t.Errorf("%s moved %d bytes in %s", dir, res.Bytes, res.Elapsed)
+				}
+				if len(res.RTT) == 0 || res.Percentile(0) < 10*time.Millisecond {
+					t.Errorf("%s sampled %d round trips, fastest %s; want some of at least 10ms", dir, len(res.RTT), res.Percentile(0))
+				}
+			}
+			if _, err := Run(l.Open, "sideways", opts); err == nil {
+				t.Errorf("Run accepted an unknown direction")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package bench
+
+import (
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// LinkOptions describes the impairments applied to each direction of an
+// in-memory link.
+type LinkOptions struct {
+	Loss   float64       // probability of dropping a packet, 0 to 1
+	Delay  time.Duration // one-way delay
+	Jitter time.Duration // random extra delay, which also reorders packets
+	Rate   int64         // bits per second, 0 for unlimited
+}
+
+// maxQueue bounds how long a packet may wait for a rate-limited link
+// before it is dropped, like a router buffer.
+const maxQueue = 200 * time.Millisecond
+
+// pipe is one end of an in-memory packet link.
+type pipe struct {
+	addr *net.UDPAddr
+	peer *pipe
+	opts LinkOptions
+	in   chan []byte
+
+	mu       sync.Mutex
+	busy     time.Time
+	deadline time.Time
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewLink returns the two ends of a link; a packet written to one end is
+// read from the other after the impairments in opts.
+func NewLink(opts LinkOptions) (net.PacketConn, net.PacketConn) {
+	a := &pipe{addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, opts: opts}
+	b := &pipe{addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}, opts: opts}
+	for _, p := range []*pipe{a, b} {
+		p.in = make(chan []byte, 4096)
+		p.closed = make(chan struct{})
+	}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (p *pipe) ReadFrom(b []byte) (int, net.Addr, error) {
+	p.mu.Lock()
+	deadline := p.deadline
+	p.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case pkt := <-p.in:
+		return copy(b, pkt), p.peer.addr, nil
+	case <-p.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (p *pipe) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if p.opts.Loss > 0 && rand.Float64() < p.opts.Loss {
+		return len(b), nil
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	sent := now
+	if p.busy.After(now) {
+		sent = p.busy
+	}
+	if p.opts.Rate > 0 {
+		sent = sent.Add(time.Duration(int64(len(b)) * 8 * int64(time.Second) / p.opts.Rate))
+	}
+	if sent.Sub(now) > maxQueue {
+		p.mu.Unlock()
+		return len(b), nil
+	}
+	p.busy = sent
+	p.mu.Unlock()
+
+	arrive := sent.Add(p.opts.Delay)
+	if p.opts.Jitter > 0 {
+		arrive = arrive.Add(rand.N(p.opts.Jitter))
+	}
+	pkt := append([]byte(nil), b...)
+	if d := arrive.Sub(now); d > 0 {
+		time.AfterFunc(d, func() { p.peer.deliver(pkt) })
+	} else {
+		p.peer.deliver(pkt)
+	}
+	return len(b), nil
+}
+
+func (p *pipe) deliver(pkt []byte) {
+	select {
+	case p.in <- pkt:
+	default:
+	}
+}
+
+func (p *pipe) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipe) LocalAddr() net.Addr { return p.addr }
+
+func (p *pipe) SetDeadline(t time.Time) error {
+	return p.SetReadDeadline(t)
+}
+
+func (p *pipe) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	p.deadline = t
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *pipe) SetWriteDeadline(t time.Time) error { return nil }
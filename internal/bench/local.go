@@ -0,0 +1,96 @@
+package bench
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet/transport"
+	"io"
+	"net"
+)
+
+// Local runs a client and a benchmark server in one process, connected by
+// an in-memory link, so transport settings can be compared without a
+// remote server or raw sockets.
+type Local struct {
+	conn     tnet.Conn
+	listener tnet.Listener
+}
+
+func NewLocal(cfg *conf.Transport, link LinkOptions) (*Local, error) {
+	client, server := NewLink(link)
+	l, err := transport.Listen(cfg, server)
+	if err != nil {
+		client.Close()
+		server.Close()
+		return nil, err
+	}
+	go serveLocal(l)
+
+	conn, err := transport.Dial(server.LocalAddr().(*net.UDPAddr), cfg, client)
+	if err != nil {
+		l.Close()
+		client.Close()
+		return nil, err
+	}
+	return &Local{conn: conn, listener: l}, nil
+}
+
+func serveLocal(l tnet.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for {
+				strm, err := conn.AcceptStrm()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer strm.Close()
+					var p protocol.Proto
+					if err := p.Read(strm); err != nil || p.Type != protocol.PSVC {
+						return
+					}
+					if err := (&protocol.Proto{Type: protocol.POK}).Write(strm); err != nil {
+						return
+					}
+					ServeStream(strm)
+				}()
+			}
+		}()
+	}
+}
+
+func (l *Local) Open(mode string) (io.ReadWriteCloser, error) {
+	strm, err := l.conn.OpenStrm()
+	if err != nil {
+		return nil, err
+	}
+	p := protocol.Proto{Type: protocol.PSVC, Msg: "bench"}
+	if err := p.Write(strm); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	if err := p.Read(strm); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	if p.Type != protocol.POK {
+		strm.Close()
+		return nil, fmt.Errorf("benchmark stream rejected: %s", p.Msg)
+	}
+	if err := WriteMode(strm, mode); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	return strm, nil
+}
+
+func (l *Local) Close() error {
+	l.conn.Close()
+	return l.listener.Close()
+}
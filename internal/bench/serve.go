@@ -0,0 +1,120 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Sink   = "sink"   // the client uploads; the server reports how much arrived
+	Source = "source" // the server sends until the stream is closed
+	Echo   = "echo"   // the server writes back whatever it reads
+)
+
+const (
+	chunkSize      = 32 << 10
+	reportInterval = 100 * time.Millisecond
+)
+
+// Valid reports whether mode is one Serve understands.
+func Valid(mode string) bool {
+	return mode == Sink || mode == Source || mode == Echo
+}
+
+// ServeStream serves a benchmark service stream, which starts with the mode
+// on a line of its own.
+func ServeStream(rw io.ReadWriter) error {
+	mode, err := readMode(rw)
+	if err != nil {
+		return err
+	}
+	return Serve(rw, mode)
+}
+
+// WriteMode starts a benchmark service stream in mode.
+func WriteMode(w io.Writer, mode string) error {
+	_, err := io.WriteString(w, mode+"\n")
+	return err
+}
+
+// readMode reads the mode line a byte at a time so none of the benchmark
+// data behind it is consumed.
+func readMode(r io.Reader) (string, error) {
+	var b [1]byte
+	var mode []byte
+	for len(mode) < 16 {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(mode), nil
+		}
+		mode = append(mode, b[0])
+	}
+	return "", fmt.Errorf("benchmark mode is too long")
+}
+
+// Serve is the server side of a benchmark stream.
+func Serve(rw io.ReadWriter, mode string) error {
+	var err error
+	switch mode {
+	case Sink:
+		err = serveSink(rw)
+	case Source:
+		err = serveSource(rw)
+	case Echo:
+		_, err = io.Copy(rw, rw)
+	default:
+		return fmt.Errorf("unknown benchmark mode '%s'", mode)
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// serveSink discards what it reads and writes the running total as a
+// big-endian uint64 every reportInterval.
+func serveSink(rw io.ReadWriter) error {
+	var total atomic.Int64
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(reportInterval)
+		defer t.Stop()
+		var b [8]byte
+		for {
+			select {
+			case <-t.C:
+				binary.BigEndian.PutUint64(b[:], uint64(total.Load()))
+				if _, err := rw.Write(b[:]); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := rw.Read(buf)
+		total.Add(int64(n))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func serveSource(w io.Writer) error {
+	buf := make([]byte, chunkSize)
+	for {
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// next returns the next connection in rotation, skipping draining ones
+// unless every connection is draining.
+func (c *Client) next() *timedConn {
+	for range c.iter.Items {
+		if tc := c.iter.Next(); !tc.drain.Load() {
+			return tc
+		}
+	}
+	return c.iter.Next()
+}
+
+func (c *Client) find(id int) (*timedConn, error) {
+	for _, tc := range c.iter.Items {
+		if tc.index == id {
+			return tc, nil
+		}
+	}
+	return nil, fmt.Errorf("connection %d not found", id)
+}
+
+func (c *Client) CloseConn(id int) error {
+	tc, err := c.find(id)
+	if err != nil {
+		return err
+	}
+	log.Infof("closing connection %d on control request", id)
+	return tc.current().Close()
+}
+
+// DrainConn stops handing out new streams on the connection and recycles it
+// once its streams are gone or timeout has passed.
+func (c *Client) DrainConn(id int, timeout time.Duration) error {
+	tc, err := c.find(id)
+	if err != nil {
+		return err
+	}
+	if !tc.drain.CompareAndSwap(false, true) {
+		return fmt.Errorf("connection %d is already draining", id)
+	}
+	log.Infof("draining connection %d (timeout %s)", id, timeout)
+
+	go func() {
+		defer tc.drain.Store(false)
+		deadline := time.Now().Add(timeout)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for tc.current().Stats().Streams > 0 && time.Now().Before(deadline) {
+			select {
+			case <-ticker.C:
+			case <-tc.ctx.Done():
+				return
+			}
+		}
+
+		c.mu.Lock()
+		tc.reconnect()
+		c.mu.Unlock()
+		log.Infof("connection %d drained and re-established", id)
+	}()
+	return nil
+}
+
+func (c *Client) Reconnect() error {
+	log.Infof("reconnecting %d connections on control request", len(c.iter.Items))
+	go func() {
+		for _, tc := range c.iter.Items {
+			c.mu.Lock()
+			tc.reconnect()
+			c.mu.Unlock()
+		}
+	}()
+	return nil
+}
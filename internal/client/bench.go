@@ -0,0 +1,20 @@
+package client
+
+import (
+	"context"
+	"github.com/starco76/paqet/internal/bench"
+	"github.com/starco76/paqet/internal/tnet"
+)
+
+// Bench opens a stream in mode to the server's benchmark service name.
+func (c *Client) Bench(ctx context.Context, name, mode string) (tnet.Strm, error) {
+	strm, err := c.Service(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := bench.WriteMode(strm, mode); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	return strm, nil
+}
@@ -2,47 +2,63 @@ package client
 
 import (
 	"context"
-	"paqet/internal/conf"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/iterator"
-	"paqet/internal/tnet"
+	"crypto/rand"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/iterator"
 	"sync"
+	"sync/atomic"
 )
 
+var log = flog.New("client")
+
 type Client struct {
 	cfg     *conf.Conf
+	id      string
 	iter    *iterator.Iterator[*timedConn]
 	udpPool *udpPool
 	mu      sync.Mutex
+
+	// sessions and conns were last added to the shared gauges.
+	sessions atomic.Int64
+	conns    atomic.Int64
 }
 
 func New(cfg *conf.Conf) (*Client, error) {
 	c := &Client{
 		cfg:     cfg,
+		id:      rand.Text(),
 		iter:    &iterator.Iterator[*timedConn]{},
-		udpPool: &udpPool{strms: make(map[uint64]tnet.Strm)},
+		udpPool: &udpPool{strms: make(map[uint64]*udpSession)},
 	}
 	return c, nil
 }
 
 func (c *Client) Start(ctx context.Context) error {
 	for i := range c.cfg.Transport.Conn {
-		tc, err := newTimedConn(ctx, c.cfg)
+		tc, err := newTimedConn(ctx, c.cfg, i+1)
 		if err != nil {
-			flog.Errorf("failed to establish connection %d: %v", i+1, err)
+			log.Errorf("failed to establish connection %d: %v", i+1, err)
 			return err
 		}
-		flog.Debugf("client connection %d established successfully", i+1)
+		log.Debugf("client connection %d established successfully", i+1)
 		c.iter.Items = append(c.iter.Items, tc)
 	}
+	metrics.OnCollect(c.collect)
 	go c.ticker(ctx)
+	if len(c.cfg.Reverse) > 0 {
+		for _, tc := range c.iter.Items {
+			go c.reverse(ctx, tc)
+		}
+	}
 
 	go func() {
 		<-ctx.Done()
 		for _, tc := range c.iter.Items {
 			tc.close()
 		}
-		flog.Infof("client shutdown complete")
+		log.Infof("client shutdown complete")
 	}()
 
 	ipv4Addr := "<nil>"
@@ -53,6 +69,6 @@ func (c *Client) Start(ctx context.Context) error {
 	if c.cfg.Network.IPv6.Addr != nil {
 		ipv6Addr = c.cfg.Network.IPv6.Addr.IP.String()
 	}
-	flog.Infof("Client started: IPv4:%s IPv6:%s -> %s (%d connections)", ipv4Addr, ipv6Addr, c.cfg.Server.Addr, len(c.iter.Items))
+	log.Infof("Client started: IPv4:%s IPv6:%s -> %s (%d connections)", ipv4Addr, ipv6Addr, c.cfg.Server.Addr, len(c.iter.Items))
 	return nil
 }
@@ -1,39 +1,153 @@
 package client
 
 import (
-	"paqet/internal/flog"
-	"paqet/internal/tnet"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"os"
 	"time"
 )
 
-func (c *Client) newConn() (tnet.Conn, error) {
+var ErrDenied = errors.New("denied by server policy")
+
+func (c *Client) newConn() (*serverConn, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	autoExpire := 300
-	tc := c.iter.Next()
+	tc := c.next()
 	go tc.sendTCPF(tc.conn)
 	err := tc.conn.Ping(false)
 	if err != nil {
-		flog.Infof("connection lost, retrying....")
-		if tc.conn != nil {
-			tc.conn.Close()
-		}
-		tc.conn = tc.waitConn()
-		tc.expire = time.Now().Add(time.Duration(autoExpire) * time.Second)
+		tc.reconnect()
 	}
 	return tc.conn, nil
 }
 
-func (c *Client) newStrm() (tnet.Strm, error) {
-	conn, err := c.newConn()
+func (c *Client) newStrm(ctx context.Context) (tnet.Strm, error) {
+	_, strm, err := c.openStrm(ctx)
+	return strm, err
+}
+
+// openStrm is newStrm for callers that also need the connection the stream
+// was opened on. It retries until a stream opens or ctx is done.
+func (c *Client) openStrm(ctx context.Context) (*serverConn, tnet.Strm, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		conn, err := c.newConn()
+		if err != nil {
+			log.Debugf("session creation failed, retrying")
+			continue
+		}
+		strm, err := conn.OpenStrm()
+		if err != nil {
+			log.Debugf("failed to open stream, retrying: %v", err)
+			continue
+		}
+		return conn, strm, nil
+	}
+}
+
+// request sends p on strm and waits for the server's answer, closing strm
+// if ctx is done first.
+func (sc *serverConn) request(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
+	stop := context.AfterFunc(ctx, func() { strm.Close() })
+	err := p.Write(strm)
+	if err == nil {
+		err = sc.readResult(ctx, strm)
+	}
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+// resultTimeout bounds the wait for the server's pong and for its answer
+// to a request. The answer costs each new stream one round trip before data
+// flows, except with servers that predate it.
+const resultTimeout = 10 * time.Second
+
+// serverConn is a connection along with the protocol revision the server
+// announced on it.
+type serverConn struct {
+	tnet.Conn
+	ready   chan struct{}
+	version int
+	err     error
+}
+
+func newServerConn(conn tnet.Conn) *serverConn {
+	sc := &serverConn{Conn: conn, ready: make(chan struct{})}
+	go sc.learnVersion()
+	return sc
+}
+
+// learnVersion asks the server for its revision; a server that predates
+// versioning answers the ping as revision 0.
+func (sc *serverConn) learnVersion() {
+	defer close(sc.ready)
+	strm, err := sc.Conn.OpenStrm()
 	if err != nil {
-		flog.Debugf("session creation failed, retrying")
-		return c.newStrm()
+		sc.err = err
+		return
+	}
+	defer strm.Close()
+	strm.SetDeadline(time.Now().Add(resultTimeout))
+	p := protocol.Proto{Type: protocol.PPING}
+	if err := p.Write(strm); err != nil {
+		sc.err = err
+		return
+	}
+	if err := p.Read(strm); err != nil {
+		sc.err = err
+		return
+	}
+	if p.Type != protocol.PPONG {
+		sc.err = fmt.Errorf("unexpected reply %d to version ping", p.Type)
+		return
+	}
+	sc.version = p.Version
+	log.Debugf("server on %s speaks protocol version %d", sc.RemoteAddr(), p.Version)
+}
+
+// serverVersion waits for the revision learned when the connection opened.
+func (sc *serverConn) serverVersion(ctx context.Context) (int, error) {
+	select {
+	case <-sc.ready:
+		return sc.version, sc.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
-	strm, err := conn.OpenStrm()
+}
+
+func (sc *serverConn) readResult(ctx context.Context, strm tnet.Strm) error {
+	version, err := sc.serverVersion(ctx)
 	if err != nil {
-		flog.Debugf("failed to open stream, retrying: %v", err)
-		return c.newStrm()
+		return fmt.Errorf("failed to learn server protocol version: %w", err)
+	}
+	if version < 1 {
+		return nil
+	}
+
+	strm.SetReadDeadline(time.Now().Add(resultTimeout))
+	defer strm.SetReadDeadline(time.Time{})
+	var p protocol.Proto
+	if err := p.Read(strm); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("no result from server within %s", resultTimeout)
+		}
+		return fmt.Errorf("failed to read result: %w", err)
+	}
+	switch p.Type {
+	case protocol.POK:
+		return nil
+	case protocol.PDENY:
+		return fmt.Errorf("%w: %s", ErrDenied, p.Msg)
+	case protocol.PFAIL:
+		return fmt.Errorf("server failed to connect: %s", p.Msg)
+	default:
+		return fmt.Errorf("unexpected result type %d", p.Type)
 	}
-	return strm, nil
 }
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/starco76/paqet/internal/metrics"
+	"strconv"
+)
+
+func (c *Client) collect() {
+	c.udpPool.mu.RLock()
+	sessions := int64(len(c.udpPool.strms))
+	c.udpPool.mu.RUnlock()
+
+	// Other instances report into the same gauges, so only add the change.
+	metrics.UDPSessions.With().Add(sessions - c.sessions.Swap(sessions))
+	conns := int64(len(c.iter.Items))
+	metrics.Connections.With().Add(conns - c.conns.Swap(conns))
+	for _, tc := range c.iter.Items {
+		if pConn := tc.pConn.Load(); pConn != nil {
+			metrics.SetSocket(c.cfg.Label(strconv.Itoa(tc.index)), pConn.Stats())
+		}
+	}
+}
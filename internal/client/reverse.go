@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"io"
+	"net"
+	"time"
+)
+
+func (c *Client) reverse(ctx context.Context, tc *timedConn) {
+	for {
+		c.mu.Lock()
+		conn := tc.conn
+		c.mu.Unlock()
+
+		if err := c.serveReverse(ctx, conn); err != nil {
+			log.Debugf("reverse acceptor stopped on %s: %v", conn.RemoteAddr(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		c.mu.Lock()
+		if tc.conn == conn {
+			tc.reconnect()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) serveReverse(ctx context.Context, conn *serverConn) error {
+	// Registrations are kept up for as long as this connection lasts.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, r := range c.cfg.Reverse {
+		go c.keepReverse(ctx, conn, r)
+	}
+
+	for {
+		strm, err := conn.AcceptStrm()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer strm.Close()
+			if err := c.handleReverseStrm(ctx, conn, strm); err != nil {
+				log.Errorf("reverse stream %d closed with error: %v", strm.SID(), err)
+			} else {
+				log.Debugf("reverse stream %d closed", strm.SID())
+			}
+		}()
+	}
+}
+
+// keepReverse registers r and registers it again whenever the server
+// refuses it or lets it go, backing off up to a minute between attempts.
+func (c *Client) keepReverse(ctx context.Context, conn *serverConn, r conf.Reverse) {
+	delay := time.Second
+	for {
+		strm, err := c.registerReverse(ctx, conn, r)
+		if err == nil {
+			delay = time.Second
+			done := make(chan error, 1)
+			go func() {
+				_, err := io.Copy(io.Discard, strm)
+				done <- err
+			}()
+			select {
+			case <-done:
+				log.Warnf("reverse %s listener %s released by server", r.Protocol, r.Listen)
+			case <-ctx.Done():
+			}
+			strm.Close()
+		} else {
+			log.Warnf("reverse %s listener %s not registered, retrying in %s: %v", r.Protocol, r.Listen, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
+
+func (c *Client) registerReverse(ctx context.Context, conn *serverConn, r conf.Reverse) (tnet.Strm, error) {
+	strm, err := conn.OpenStrm()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reverse registration stream for %s: %w", r.Listen, err)
+	}
+
+	// Msg carries the client's ID, so the server shares the listener among
+	// this client's connections only.
+	p := protocol.Proto{Type: protocol.PRTCP, Addr: r.Listen, Msg: c.id}
+	if r.Protocol == "udp" {
+		p.Type = protocol.PRUDP
+	}
+	if err := p.Write(strm); err != nil {
+		strm.Close()
+		return nil, fmt.Errorf("failed to register reverse %s listener %s: %w", r.Protocol, r.Listen, err)
+	}
+	if err := conn.readResult(ctx, strm); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	log.Infof("reverse %s listener %s -> %s registered on stream %d", r.Protocol, r.Listen, r.Target, strm.SID())
+	return strm, nil
+}
+
+func (c *Client) handleReverseStrm(ctx context.Context, tc tnet.Conn, strm tnet.Strm) error {
+	var p protocol.Proto
+	if err := p.Read(strm); err != nil {
+		log.Errorf("failed to read protocol message from reverse stream %d: %v", strm.SID(), err)
+		return err
+	}
+
+	network := "tcp"
+	if p.Type == protocol.PRUDP {
+		network = "udp"
+	} else if p.Type != protocol.PRTCP {
+		return fmt.Errorf("unexpected protocol type %d on reverse stream", p.Type)
+	}
+
+	var entry *conf.Reverse
+	for i, r := range c.cfg.Reverse {
+		if r.Protocol == network && p.Addr != nil && r.Listen.String() == p.Addr.String() {
+			entry = &c.cfg.Reverse[i]
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("no reverse %s entry for listener %s", network, p.Addr)
+	}
+	target := entry.Target
+	inbound := metrics.NewInbound(c.cfg.Label("reverse/" + entry.Listen.String()))
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, target.String())
+	if err != nil {
+		log.Errorf("failed to connect reverse stream %d to %s: %v", strm.SID(), target, err)
+		inbound.Fail()
+		return err
+	}
+	defer conn.Close()
+	ms := inbound.Open(network, p.Addr.String(), target.String(), strm.SID(), strm)
+	defer ms.Close()
+	log.Infof("accepted reverse %s stream %d: %s -> %s", network, strm.SID(), p.Addr, target)
+
+	copyFn := buffer.CopyT
+	if network == "udp" {
+		copyFn = buffer.CopyU
+		strm = tc.Packet(strm)
+	}
+	errCh := make(chan error, 2)
+	go func() {
+		err := copyFn(conn, ms.Down(strm))
+		errCh <- err
+	}()
+	go func() {
+		err := copyFn(strm, ms.Up(conn))
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		ms.End(err)
+		if err != nil {
+			log.Errorf("reverse %s stream %d to %s failed: %v", network, strm.SID(), target, err)
+			return err
+		}
+	case <-ctx.Done():
+		ms.End(ctx.Err())
+	}
+	return nil
+}
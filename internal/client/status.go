@@ -0,0 +1,36 @@
+package client
+
+import (
+	"cmp"
+	"github.com/starco76/paqet/internal/control"
+	"slices"
+)
+
+func (c *Client) Conns() []control.Conn {
+	conns := make([]control.Conn, 0, len(c.iter.Items))
+	for _, tc := range c.iter.Items {
+		if conn := tc.current(); conn != nil {
+			cc := control.NewConn(tc.index, conn)
+			cc.Draining = tc.drain.Load()
+			conns = append(conns, cc)
+		}
+	}
+	return conns
+}
+
+func (c *Client) UDPSessions() []control.UDPSession {
+	c.udpPool.mu.RLock()
+	sessions := make([]control.UDPSession, 0, len(c.udpPool.strms))
+	for key, sess := range c.udpPool.strms {
+		sessions = append(sessions, control.UDPSession{
+			Key:     key,
+			SID:     sess.strm.SID(),
+			Source:  sess.src,
+			Target:  sess.dst,
+			Started: sess.started,
+		})
+	}
+	c.udpPool.mu.RUnlock()
+	slices.SortFunc(sessions, func(a, b control.UDPSession) int { return cmp.Compare(a.SID, b.SID) })
+	return sessions
+}
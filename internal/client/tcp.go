@@ -1,33 +1,51 @@
 package client
 
 import (
-	"paqet/internal/flog"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
+	"context"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 )
 
-func (c *Client) TCP(addr string) (tnet.Strm, error) {
-	strm, err := c.newStrm()
+func (c *Client) TCP(ctx context.Context, addr string) (tnet.Strm, error) {
+	conn, strm, err := c.openStrm(ctx)
 	if err != nil {
-		flog.Debugf("failed to create stream for TCP %s: %v", addr, err)
+		log.Debugf("failed to create stream for TCP %s: %v", addr, err)
 		return nil, err
 	}
 
 	tAddr, err := tnet.NewAddr(addr)
 	if err != nil {
-		flog.Debugf("invalid TCP address %s: %v", addr, err)
+		log.Debugf("invalid TCP address %s: %v", addr, err)
 		strm.Close()
 		return nil, err
 	}
 
 	p := protocol.Proto{Type: protocol.PTCP, Addr: tAddr}
-	err = p.Write(strm)
+	if err := conn.request(ctx, strm, &p); err != nil {
+		log.Debugf("TCP stream %d for %s failed: %v", strm.SID(), addr, err)
+		strm.Close()
+		return nil, err
+	}
+
+	log.Debugf("TCP stream %d established for %s", strm.SID(), addr)
+	return strm, nil
+}
+
+// Service opens a stream to the handler the server registered as name.
+func (c *Client) Service(ctx context.Context, name string) (tnet.Strm, error) {
+	conn, strm, err := c.openStrm(ctx)
 	if err != nil {
-		flog.Debugf("failed to write TCP protocol header for %s on stream %d: %v", addr, strm.SID(), err)
+		log.Debugf("failed to create stream for service %s: %v", name, err)
+		return nil, err
+	}
+
+	p := protocol.Proto{Type: protocol.PSVC, Msg: name}
+	if err := conn.request(ctx, strm, &p); err != nil {
+		log.Debugf("service stream %d for %s failed: %v", strm.SID(), name, err)
 		strm.Close()
 		return nil, err
 	}
 
-	flog.Debugf("TCP stream %d established for %s", strm.SID(), addr)
+	log.Debugf("service stream %d established for %s", strm.SID(), name)
 	return strm, nil
 }
@@ -3,24 +3,32 @@ package client
 import (
 	"context"
 	"fmt"
-	"paqet/internal/conf"
-	"paqet/internal/protocol"
-	"paqet/internal/socket"
-	"paqet/internal/tnet"
-	"paqet/internal/tnet/kcp"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/socket"
+	"github.com/starco76/paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet/transport"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type timedConn struct {
 	cfg    *conf.Conf
-	conn   tnet.Conn
+	index  int
+	conn   *serverConn
+	pConn  atomic.Pointer[socket.PacketConn]
+	mu     sync.RWMutex // guards conn for readers that do not hold the client mutex
+	drain  atomic.Bool
 	expire time.Time
 	ctx    context.Context
 }
 
-func newTimedConn(ctx context.Context, cfg *conf.Conf) (*timedConn, error) {
+func newTimedConn(ctx context.Context, cfg *conf.Conf, index int) (*timedConn, error) {
 	var err error
-	tc := timedConn{cfg: cfg, ctx: ctx}
+	tc := timedConn{cfg: cfg, index: index, ctx: ctx}
 	tc.conn, err = tc.createConn()
 	if err != nil {
 		return nil, err
@@ -29,25 +37,31 @@ func newTimedConn(ctx context.Context, cfg *conf.Conf) (*timedConn, error) {
 	return &tc, nil
 }
 
-func (tc *timedConn) createConn() (tnet.Conn, error) {
+func (tc *timedConn) createConn() (*serverConn, error) {
 	netCfg := tc.cfg.Network
-	pConn, err := socket.New(tc.ctx, &netCfg)
+	pConn, err := socket.Open(tc.ctx, &netCfg)
 	if err != nil {
-		return nil, fmt.Errorf("could not create raw packet conn: %w", err)
+		return nil, fmt.Errorf("could not create packet conn: %w", err)
 	}
 
-	conn, err := kcp.Dial(tc.cfg.Server.Addr, tc.cfg.Transport.KCP, pConn)
+	conn, err := transport.Dial(tc.cfg.Server.Addr, &tc.cfg.Transport, pConn)
 	if err != nil {
+		pConn.Close()
 		return nil, err
 	}
 	err = tc.sendTCPF(conn)
 	if err != nil {
+		conn.Close()
+		pConn.Close()
 		return nil, err
 	}
-	return conn, nil
+	if raw, ok := pConn.(*socket.PacketConn); ok {
+		tc.pConn.Store(raw)
+	}
+	return newServerConn(conn), nil
 }
 
-func (tc *timedConn) waitConn() tnet.Conn {
+func (tc *timedConn) waitConn() *serverConn {
 	for {
 		if c, err := tc.createConn(); err == nil {
 			return c
@@ -57,6 +71,26 @@ func (tc *timedConn) waitConn() tnet.Conn {
 	}
 }
 
+// reconnect replaces a lost connection; callers hold the client mutex.
+func (tc *timedConn) reconnect() {
+	log.With("conn", tc.index).Infof("connection lost, retrying....")
+	if tc.conn != nil {
+		tc.conn.Close()
+	}
+	conn := tc.waitConn()
+	tc.mu.Lock()
+	tc.conn = conn
+	tc.mu.Unlock()
+	tc.expire = time.Now().Add(300 * time.Second)
+	metrics.Reconnects.With(tc.cfg.Label(strconv.Itoa(tc.index))).Inc()
+}
+
+func (tc *timedConn) current() *serverConn {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return tc.conn
+}
+
 func (tc *timedConn) sendTCPF(conn tnet.Conn) error {
 	strm, err := conn.OpenStrm()
 	if err != nil {
@@ -1,47 +1,48 @@
 package client
 
 import (
-	"paqet/internal/flog"
-	"paqet/internal/pkg/hash"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
+	"context"
+	"github.com/starco76/paqet/internal/pkg/hash"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"time"
 )
 
-func (c *Client) UDP(lAddr, tAddr string) (tnet.Strm, bool, uint64, error) {
+func (c *Client) UDP(ctx context.Context, lAddr, tAddr string) (tnet.Strm, bool, uint64, error) {
 	key := hash.AddrPair(lAddr, tAddr)
 	c.udpPool.mu.RLock()
-	if strm, exists := c.udpPool.strms[key]; exists {
+	if sess, exists := c.udpPool.strms[key]; exists {
 		c.udpPool.mu.RUnlock()
-		flog.Debugf("reusing UDP stream %d for %s -> %s", strm.SID(), lAddr, tAddr)
-		return strm, false, key, nil
+		log.Debugf("reusing UDP stream %d for %s -> %s", sess.strm.SID(), lAddr, tAddr)
+		return sess.strm, false, key, nil
 	}
 	c.udpPool.mu.RUnlock()
 
-	strm, err := c.newStrm()
+	conn, strm, err := c.openStrm(ctx)
 	if err != nil {
-		flog.Debugf("failed to create stream for UDP %s -> %s: %v", lAddr, tAddr, err)
+		log.Debugf("failed to create stream for UDP %s -> %s: %v", lAddr, tAddr, err)
 		return nil, false, 0, err
 	}
 
 	taddr, err := tnet.NewAddr(tAddr)
 	if err != nil {
-		flog.Debugf("invalid UDP address %s: %v", tAddr, err)
+		log.Debugf("invalid UDP address %s: %v", tAddr, err)
 		strm.Close()
 		return nil, false, 0, err
 	}
 	p := protocol.Proto{Type: protocol.PUDP, Addr: taddr}
-	err = p.Write(strm)
-	if err != nil {
-		flog.Debugf("failed to write UDP protocol header for %s -> %s on stream %d: %v", lAddr, tAddr, strm.SID(), err)
+	if err := conn.request(ctx, strm, &p); err != nil {
+		log.Debugf("UDP stream %d for %s -> %s failed: %v", strm.SID(), lAddr, tAddr, err)
 		strm.Close()
 		return nil, false, 0, err
 	}
+	strm = conn.Datagram(strm)
 
 	c.udpPool.mu.Lock()
-	c.udpPool.strms[key] = strm
+	c.udpPool.strms[key] = &udpSession{strm: strm, src: lAddr, dst: tAddr, started: time.Now()}
 	c.udpPool.mu.Unlock()
 
-	flog.Debugf("established UDP stream %d for %s -> %s", strm.SID(), lAddr, tAddr)
+	log.Debugf("established UDP stream %d for %s -> %s", strm.SID(), lAddr, tAddr)
 	return strm, true, key, nil
 }
 
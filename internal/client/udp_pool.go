@@ -1,24 +1,31 @@
 package client
 
 import (
-	"paqet/internal/flog"
-	"paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet"
 	"sync"
+	"time"
 )
 
+type udpSession struct {
+	strm    tnet.Strm
+	src     string
+	dst     string
+	started time.Time
+}
+
 type udpPool struct {
-	strms map[uint64]tnet.Strm
+	strms map[uint64]*udpSession
 	mu    sync.RWMutex
 }
 
 func (p *udpPool) delete(key uint64) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if strm, exists := p.strms[key]; exists {
-		flog.Debugf("closing UDP session stream %d", strm.SID())
-		strm.Close()
+	if sess, exists := p.strms[key]; exists {
+		log.Debugf("closing UDP session stream %d", sess.strm.SID())
+		sess.strm.Close()
 	} else {
-		flog.Debugf("UDP session key %d not found for close", key)
+		log.Debugf("UDP session key %d not found for close", key)
 	}
 	delete(p.strms, key)
 
@@ -0,0 +1,34 @@
+package conf
+
+import "fmt"
+
+type AccessLog struct {
+	File       string `yaml:"file"`
+	Format     string `yaml:"format"`
+	MaxSize    int    `yaml:"max_size"`
+	MaxAge     int    `yaml:"max_age"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+func (a *AccessLog) setDefaults() {
+	if a.Format == "" {
+		a.Format = "json"
+	}
+	if a.File != "" && a.MaxSize == 0 {
+		a.MaxSize = 100
+	}
+}
+
+func (a *AccessLog) validate() []error {
+	if a.File == "" {
+		return nil
+	}
+	var errors []error
+	if a.Format != "json" && a.Format != "csv" {
+		errors = append(errors, fmt.Errorf("access_log format must be 'json' or 'csv'"))
+	}
+	if a.MaxSize < 0 || a.MaxAge < 0 || a.MaxBackups < 0 {
+		errors = append(errors, fmt.Errorf("access_log max_size, max_age and max_backups must not be negative"))
+	}
+	return errors
+}
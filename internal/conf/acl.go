@@ -0,0 +1,174 @@
+package conf
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+type ACL struct {
+	// BlockPrivate denies loopback, private, shared and link-local
+	// destinations unless an allow rule's cidr covers them. It is on unless
+	// set to false.
+	BlockPrivate *bool     `yaml:"block_private"`
+	Allow        []ACLRule `yaml:"allow"`
+	Deny         []ACLRule `yaml:"deny"`
+}
+
+type ACLRule struct {
+	CIDR_  []string       `yaml:"cidr"`
+	Domain []string       `yaml:"domain"`
+	Ports_ []string       `yaml:"ports"`
+	CIDR   []netip.Prefix `yaml:"-"`
+	Ports  []PortRange    `yaml:"-"`
+}
+
+type PortRange struct {
+	From, To int
+}
+
+func (a *ACL) setDefaults() {
+	if a.BlockPrivate == nil {
+		a.BlockPrivate = new(bool)
+		*a.BlockPrivate = true
+	}
+}
+
+func (a *ACL) validate() []error {
+	var errors []error
+	for i := range a.Allow {
+		for _, err := range a.Allow[i].validate() {
+			errors = append(errors, fmt.Errorf("acl.allow[%d] %v", i, err))
+		}
+	}
+	for i := range a.Deny {
+		for _, err := range a.Deny[i].validate() {
+			errors = append(errors, fmt.Errorf("acl.deny[%d] %v", i, err))
+		}
+	}
+	return errors
+}
+
+func (r *ACLRule) validate() []error {
+	var errors []error
+
+	if len(r.CIDR_) == 0 && len(r.Domain) == 0 && len(r.Ports_) == 0 {
+		errors = append(errors, fmt.Errorf("rule must set at least one of cidr, domain or ports"))
+	}
+
+	r.CIDR = make([]netip.Prefix, 0, len(r.CIDR_))
+	for _, s := range r.CIDR_ {
+		p, err := parsePrefix(s)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid CIDR '%s': %v", s, err))
+			continue
+		}
+		r.CIDR = append(r.CIDR, p)
+	}
+
+	for i, d := range r.Domain {
+		r.Domain[i] = strings.ToLower(strings.TrimSuffix(d, "."))
+	}
+
+	r.Ports = make([]PortRange, 0, len(r.Ports_))
+	for _, s := range r.Ports_ {
+		pr, err := parsePortRange(s)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		r.Ports = append(r.Ports, pr)
+	}
+
+	return errors
+}
+
+// Match reports whether the rule matches the destination. host is the name
+// requested by the client and ip the address it resolved to; either may be empty.
+func (r *ACLRule) Match(host string, ip netip.Addr, port int) bool {
+	if len(r.CIDR) > 0 {
+		if !ip.IsValid() || !r.matchCIDR(ip) {
+			return false
+		}
+	}
+	if len(r.Domain) > 0 && !r.matchDomain(host) {
+		return false
+	}
+	if len(r.Ports) > 0 && !r.matchPort(port) {
+		return false
+	}
+	return true
+}
+
+func (r *ACLRule) matchCIDR(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range r.CIDR {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ACLRule) matchDomain(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+	for _, d := range r.Domain {
+		if suffix, ok := strings.CutPrefix(d, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ACLRule) matchPort(port int) bool {
+	for _, pr := range r.Ports {
+		if port >= pr.From && port <= pr.To {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return p, err
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+func parsePortRange(s string) (PortRange, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	f, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port '%s'", s)
+	}
+	t := f
+	if isRange {
+		t, err = strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range '%s'", s)
+		}
+	}
+	if f < 1 || t > 65535 || f > t {
+		return PortRange{}, fmt.Errorf("port range '%s' must be within 1-65535", s)
+	}
+	return PortRange{From: f, To: t}, nil
+}
@@ -2,8 +2,7 @@ package conf
 
 import (
 	"fmt"
-	"os"
-	"paqet/internal/flog"
+	"github.com/starco76/paqet/internal/flog"
 	"slices"
 	"strings"
 
@@ -11,43 +10,88 @@ import (
 )
 
 type Conf struct {
-	Role      string    `yaml:"role"`
-	Log       Log       `yaml:"log"`
-	Listen    Server    `yaml:"listen"`
-	SOCKS5    []SOCKS5  `yaml:"socks5"`
-	Forward   []Forward `yaml:"forward"`
-	Network   Network   `yaml:"network"`
-	Server    Server    `yaml:"server"`
-	Transport Transport `yaml:"transport"`
+	Name        string      `yaml:"name"`
+	Role        string      `yaml:"role"`
+	Log         Log         `yaml:"log"`
+	AccessLog   AccessLog   `yaml:"access_log"`
+	Listen      Server      `yaml:"listen"`
+	SOCKS5      []SOCKS5    `yaml:"socks5"`
+	Forward     []Forward   `yaml:"forward"`
+	Reverse     []Reverse   `yaml:"reverse"`
+	ReverseBind ReverseBind `yaml:"reverse_bind"`
+	Services    []Service   `yaml:"services"`
+	Network     Network     `yaml:"network"`
+	Server      Server      `yaml:"server"`
+	Transport   Transport   `yaml:"transport"`
+	ACL         ACL         `yaml:"acl"`
+	Limits      Limits      `yaml:"limits"`
+	Outbound    Outbound    `yaml:"outbound"`
+	Resolver    Resolver    `yaml:"resolver"`
+	Metrics     Metrics     `yaml:"metrics"`
+	Control     Control     `yaml:"control"`
+	Instances   []Conf      `yaml:"instances"`
 }
 
 func LoadFromFile(path string) (*Conf, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+	return Load(path)
+}
 
+func load(data []byte, dir string) (*Conf, error) {
 	var conf Conf
 
 	if err := yaml.Unmarshal(data, &conf); err != nil {
 		return &conf, err
 	}
+	refErrors := conf.resolve(dir)
 
-	validRoles := []string{"client", "server"}
-	if !slices.Contains(validRoles, conf.Role) {
+	if len(conf.Instances) > 0 {
+		refErrors = append(refErrors, conf.checkInstances()...)
+	} else if !slices.Contains(validRoles, conf.Role) {
 		return nil, fmt.Errorf("role must be 'client' or 'server'")
 	}
 
 	conf.setDefaults()
-	if err := conf.validate(); err != nil {
+	if err := writeErr(append(refErrors, conf.validate()...)); err != nil {
 		return &conf, err
 	}
+	for _, t := range conf.Tunnels() {
+		if t.Role == "client" && len(t.SOCKS5) == 0 && len(t.Forward) == 0 && len(t.Reverse) == 0 {
+			flog.Warnf("warning: client mode enabled but no SOCKS5, forward or reverse configurations found")
+		}
+	}
 
 	return &conf, nil
 }
 
+var validRoles = []string{"client", "server"}
+
+// Prepare fills in the defaults and validates a configuration built in code
+// rather than loaded from a file.
+func (c *Conf) Prepare() error {
+	if !slices.Contains(validRoles, c.Role) {
+		return fmt.Errorf("role must be 'client' or 'server'")
+	}
+	c.setDefaults()
+	return writeErr(c.validate())
+}
+
 func (c *Conf) setDefaults() {
 	c.Log.setDefaults()
+	c.AccessLog.setDefaults()
+	c.Metrics.setDefaults()
+	c.Control.setDefaults()
+	if len(c.Instances) > 0 {
+		for i := range c.Instances {
+			in := &c.Instances[i]
+			in.Log, in.AccessLog, in.Metrics, in.Control = c.Log, c.AccessLog, c.Metrics, c.Control
+			in.setTunnelDefaults()
+		}
+		return
+	}
+	c.setTunnelDefaults()
+}
+
+func (c *Conf) setTunnelDefaults() {
 	c.Listen.setDefaults()
 	for i := range c.SOCKS5 {
 		c.SOCKS5[i].setDefaults()
@@ -55,18 +99,46 @@ func (c *Conf) setDefaults() {
 	for i := range c.Forward {
 		c.Forward[i].setDefaults()
 	}
+	for i := range c.Reverse {
+		c.Reverse[i].setDefaults()
+	}
+	for i := range c.Services {
+		c.Services[i].setDefaults()
+	}
+	c.ReverseBind.setDefaults()
 	c.Network.setDefaults(c.Role)
 	c.Server.setDefaults()
 	c.Transport.setDefaults(c.Role)
+	c.ACL.setDefaults()
+	c.Limits.setDefaults()
+	c.Outbound.setDefaults()
+	c.Resolver.setDefaults()
 }
 
-func (c *Conf) validate() error {
+func (c *Conf) validate() []error {
 	var allErrors []error
 
 	allErrors = append(allErrors, c.Log.validate()...)
-	if c.Role == "client" && len(c.SOCKS5) == 0 && len(c.Forward) == 0 {
-		flog.Warnf("warning: client mode enabled but no SOCKS5 or forward configurations found")
+	allErrors = append(allErrors, c.AccessLog.validate()...)
+	allErrors = append(allErrors, c.Metrics.validate()...)
+	allErrors = append(allErrors, c.Control.validate()...)
+	if len(c.Instances) > 0 {
+		for i := range c.Instances {
+			if !slices.Contains(validRoles, c.Instances[i].Role) {
+				continue
+			}
+			for _, err := range c.Instances[i].validateTunnel() {
+				allErrors = append(allErrors, fmt.Errorf("%s %v", instanceRef(i, c.Instances[i].Name), err))
+			}
+		}
+		return allErrors
 	}
+	return append(allErrors, c.validateTunnel()...)
+}
+
+func (c *Conf) validateTunnel() []error {
+	var allErrors []error
+
 	for i := range c.SOCKS5 {
 		errs := c.SOCKS5[i].validate()
 		for _, err := range errs {
@@ -81,23 +153,54 @@ func (c *Conf) validate() error {
 		}
 	}
 
+	for i := range c.Reverse {
+		errs := c.Reverse[i].validate()
+		for _, err := range errs {
+			allErrors = append(allErrors, fmt.Errorf("reverse[%d] %v", i, err))
+		}
+	}
+
 	allErrors = append(allErrors, c.Network.validate()...)
 	allErrors = append(allErrors, c.Transport.validate()...)
 	if c.Role == "server" {
-		allErrors = append(allErrors, c.Listen.validate()...)
+		if c.Network.PacketConn == nil {
+			allErrors = append(allErrors, c.Listen.validate()...)
+			// A socket carrier listens on the listen port unless the
+			// network addresses pin one.
+			if c.Network.Carrier != "pcap-raw" && c.Network.Port == 0 && c.Listen.Addr != nil {
+				c.Network.Port = c.Listen.Addr.Port
+			}
+		}
+		allErrors = append(allErrors, c.ACL.validate()...)
+		allErrors = append(allErrors, c.ReverseBind.validate()...)
+		allErrors = append(allErrors, c.Limits.validate()...)
+		allErrors = append(allErrors, c.Outbound.validate()...)
+		allErrors = append(allErrors, c.Resolver.validate()...)
+		names := make(map[string]bool)
+		for i := range c.Services {
+			for _, err := range c.Services[i].validate() {
+				allErrors = append(allErrors, fmt.Errorf("services[%d] %v", i, err))
+			}
+			if names[c.Services[i].Name] {
+				allErrors = append(allErrors, fmt.Errorf("services[%d] name '%s' is used more than once", i, c.Services[i].Name))
+			}
+			names[c.Services[i].Name] = true
+		}
 	} else {
 		allErrors = append(allErrors, c.Server.validate()...)
-		if c.Server.Addr.IP.To4() != nil && c.Network.IPv4.Addr == nil {
-			allErrors = append(allErrors, fmt.Errorf("server address is IPv4, but the IPv4 interface is not configured"))
-		}
-		if c.Server.Addr.IP.To4() == nil && c.Network.IPv6.Addr == nil {
-			allErrors = append(allErrors, fmt.Errorf("server address is IPv6, but the IPv6 interface is not configured"))
+		if c.Server.Addr != nil && c.Network.PacketConn == nil && c.Network.Carrier == "pcap-raw" {
+			if c.Server.Addr.IP.To4() != nil && c.Network.IPv4.Addr == nil {
+				allErrors = append(allErrors, fmt.Errorf("server address is IPv4, but the IPv4 interface is not configured"))
+			}
+			if c.Server.Addr.IP.To4() == nil && c.Network.IPv6.Addr == nil {
+				allErrors = append(allErrors, fmt.Errorf("server address is IPv6, but the IPv6 interface is not configured"))
+			}
 		}
 		if c.Transport.Conn > 1 && c.Network.Port != 0 {
 			allErrors = append(allErrors, fmt.Errorf("only one connection is allowed when a client port is explicitly set"))
 		}
 	}
-	return writeErr(allErrors)
+	return allErrors
 }
 
 func writeErr(allErrors []error) error {
@@ -0,0 +1,452 @@
+package conf
+
+import (
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/tnet"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestACLRuleMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ACLRule
+		host string
+		ip   string
+		port int
+		want bool
+	}{
+		{"cidr hit", ACLRule{CIDR_: []string{"10.0.0.0/8"}}, "", "10.1.2.3", 80, true},
+		{"cidr miss", ACLRule{CIDR_: []string{"10.0.0.0/8"}}, "", "11.0.0.1", 80, false},
+		{"cidr single address", ACLRule{CIDR_: []string{"192.0.2.7"}}, "", "192.0.2.7", 80, true},
+		{"cidr mapped ipv4", ACLRule{CIDR_: []string{"10.0.0.0/8"}}, "", "::ffff:10.0.0.1", 80, true},
+		{"cidr unresolved", ACLRule{CIDR_: []string{"10.0.0.0/8"}}, "example.com", "", 80, false},
+		{"domain exact", ACLRule{Domain: []string{"example.com"}}, "Example.COM.", "", 80, true},
+		{"domain exact miss", ACLRule{Domain: []string{"example.com"}}, "www.example.com", "", 80, false},
+		{"domain wildcard", ACLRule{Domain: []string{"*.example.com"}}, "a.b.example.com", "", 80, true},
+		{"domain wildcard apex", ACLRule{Domain: []string{"*.example.com"}}, "example.com", "", 80, false},
+		{"domain no host", ACLRule{Domain: []string{"example.com"}}, "", "192.0.2.1", 80, false},
+		{"port single", ACLRule{Ports_: []string{"443"}}, "", "192.0.2.1", 443, true},
+		{"port range", ACLRule{Ports_: []string{"6881-6889"}}, "", "192.0.2.1", 6885, true},
+		{"port range miss", ACLRule{Ports_: []string{"6881-6889"}}, "", "192.0.2.1", 6890, false},
+		{"all fields", ACLRule{CIDR_: []string{"10.0.0.0/8"}, Ports_: []string{"22"}}, "", "10.0.0.1", 22, true},
+		{"all fields port miss", ACLRule{CIDR_: []string{"10.0.0.0/8"}, Ports_: []string{"22"}}, "", "10.0.0.1", 23, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := tt.rule.validate(); len(errs) > 0 {
+				t.Fatalf("validate: %v", errs)
+			}
+			var ip netip.Addr
+			if tt.ip != "" {
+				ip = netip.MustParseAddr(tt.ip)
+			}
+			if got := tt.rule.Match(tt.host, ip, tt.port); got != tt.want {
+				t.Errorf("Match(%q, %v, %d) = %v, want %v", tt.host, ip, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACLRuleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ACLRule
+		errs int
+	}{
+		{"empty", ACLRule{}, 1},
+		{"bad cidr", ACLRule{CIDR_: []string{"10.0.0.0/33"}}, 1},
+		{"bad port", ACLRule{Ports_: []string{"http"}}, 1},
+		{"reversed range", ACLRule{Ports_: []string{"90-80"}}, 1},
+		{"port out of range", ACLRule{Ports_: []string{"0"}}, 1},
+		{"valid", ACLRule{CIDR_: []string{"::1"}, Ports_: []string{"1-65535"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := tt.rule.validate(); len(errs) != tt.errs {
+				t.Errorf("validate() = %v, want %d errors", errs, tt.errs)
+			}
+		})
+	}
+}
+
+func TestReverseBindAllows(t *testing.T) {
+	r := ReverseBind{Allow: []ACLRule{
+		{CIDR_: []string{"0.0.0.0"}, Ports_: []string{"8000-8100"}},
+		{CIDR_: []string{"127.0.0.0/8"}},
+	}}
+	if errs := r.validate(); len(errs) > 0 {
+		t.Fatalf("validate: %v", errs)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{":8080", true},
+		{"0.0.0.0:8100", true},
+		{":8101", false},
+		{"192.0.2.1:8080", false},
+		{"127.0.0.1:22", true},
+		{"localhost:8080", false},
+		{"[::]:8080", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			addr, err := tnet.NewAddr(tt.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Allows(addr); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+
+	if (&ReverseBind{}).Allows(&tnet.Addr{Host: "127.0.0.1", Port: 8080}) {
+		t.Errorf("empty reverse_bind allowed a listener")
+	}
+	bad := ReverseBind{Allow: []ACLRule{{Domain: []string{"example.com"}}}}
+	if errs := bad.validate(); len(errs) != 1 {
+		t.Errorf("validate() with a domain = %v, want 1 error", errs)
+	}
+}
+
+func TestQUICIdentity(t *testing.T) {
+	a, b := quicIdentity("key a"), quicIdentity("key b")
+	if a.Equal(b) {
+		t.Fatalf("different keys share an identity")
+	}
+	// Every key stays cached, not only the last one.
+	identities.Lock()
+	n := len(identities.m)
+	identities.Unlock()
+	if again := quicIdentity("key a"); !again.Equal(a) {
+		t.Errorf("identity for a key changed")
+	}
+	identities.Lock()
+	defer identities.Unlock()
+	if len(identities.m) != n {
+		t.Errorf("cached identity was derived again")
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	flags := TCP{LF_: []string{"PA"}, RF_: []string{"PA", "S"}}
+	tests := []struct {
+		name string
+		uri  URI
+	}{
+		{"kcp", URI{Name: "home", Server: "203.0.113.1:9999", TCP: flags,
+			Transport: Transport{Protocol: "kcp", KCP: &KCP{Mode: "fast", MTU: 1350, Block_: "aes", Key: "secret"}}}},
+		{"kcp manual with fec", URI{Server: "203.0.113.1:9999", TCP: flags,
+			Transport: Transport{Protocol: "kcp", KCP: &KCP{Mode: "manual", NoDelay: 1, Interval: 20, Resend: 2, NoCongestion: 1, MTU: 1200, Dshard: 10, Pshard: 3, Block_: "none", Datagram: true, Key: "secret"}}}},
+		{"key with special characters", URI{Name: "a b#c", Server: "203.0.113.1:9999", TCP: flags,
+			Transport: Transport{Protocol: "kcp", KCP: &KCP{Mode: "fast", MTU: 1350, Block_: "aes", Key: `p@ss:w/rd?#%&+= "ü"\`}}}},
+		{"ipv6 server", URI{Server: "[2001:db8::1]:443", Carrier: "udp", TCP: flags,
+			Transport: Transport{Protocol: "kcp", KCP: &KCP{Mode: "fast2", MTU: 1350, Block_: "aes-128-gcm", Key: "k"}}}},
+		{"quic", URI{Server: "203.0.113.1:443", Carrier: "tcp-stream", TCP: flags,
+			Transport: Transport{Protocol: "quic", QUIC: &QUIC{ALPN: "h3", Datagram: true, Key: "q@uic:key/"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.uri.String()
+			got, err := ParseURI(s)
+			if err != nil {
+				t.Fatalf("ParseURI(%s): %v", s, err)
+			}
+			if !reflect.DeepEqual(got, &tt.uri) {
+				t.Errorf("ParseURI(%s) = %+v, want %+v", s, got, tt.uri)
+			}
+		})
+	}
+}
+
+func TestParseURIErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+	}{
+		{"scheme", "http://key@203.0.113.1:9999?transport=kcp"},
+		{"no port", "paqet://key@203.0.113.1?transport=kcp&mode=fast&block=aes"},
+		{"bad number", "paqet://key@203.0.113.1:9999?transport=kcp&mode=fast&block=aes&mtu=big"},
+		{"bad transport", "paqet://key@203.0.113.1:9999?transport=tcp"},
+		{"bad carrier", "paqet://key@203.0.113.1:9999?transport=kcp&mode=fast&block=aes&carrier=icmp"},
+		{"bad flags", "paqet://key@203.0.113.1:9999?transport=kcp&mode=fast&block=aes&lf=XYZ"},
+		{"no key", "paqet://203.0.113.1:9999?transport=kcp&mode=fast&block=aes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if u, err := ParseURI(tt.uri); err == nil {
+				t.Errorf("ParseURI(%s) = %+v, want an error", tt.uri, u)
+			}
+		})
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const baseClient = `role: "client"
+network:
+  carrier: "udp"
+server:
+  addr: "127.0.0.1:9999"
+transport:
+  protocol: "kcp"
+  kcp:
+    key: "secret"
+`
+
+func TestLoadMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		paths  []string
+		socks5 []string
+		level  string
+	}{
+		{
+			name: "lists concatenate",
+			files: map[string]string{
+				"a.yaml": baseClient + "socks5:\n  - listen: \"127.0.0.1:1080\"\n",
+				"b.yaml": "role: \"client\"\nsocks5:\n  - listen: \"127.0.0.1:1081\"\n",
+			},
+			paths:  []string{"a.yaml", "b.yaml"},
+			socks5: []string{"127.0.0.1:1080", "127.0.0.1:1081"},
+			level:  "none",
+		},
+		{
+			name: "directory in name order",
+			files: map[string]string{
+				"conf/10-base.yaml": baseClient,
+				"conf/20-socks.yml": "socks5:\n  - listen: \"127.0.0.1:1080\"\n",
+				"conf/30-log.yaml":  "log:\n  level: \"debug\"\n",
+				"conf/notes.txt":    "ignored",
+			},
+			paths:  []string{"conf"},
+			socks5: []string{"127.0.0.1:1080"},
+			level:  "debug",
+		},
+		{
+			name: "include globs relative to the file",
+			files: map[string]string{
+				"main.yaml":          "include:\n  - \"conf.d/*.yaml\"\n" + baseClient,
+				"conf.d/a.yaml":      "socks5:\n  - listen: \"127.0.0.1:1080\"\n",
+				"conf.d/b.yaml":      "socks5:\n  - listen: \"127.0.0.1:1081\"\nlog:\n  level: \"warn\"\n",
+				"conf.d/skip.yaml.x": "role: \"server\"\n",
+			},
+			paths:  []string{"main.yaml"},
+			socks5: []string{"127.0.0.1:1080", "127.0.0.1:1081"},
+			level:  "warn",
+		},
+		{
+			name: "empty value leaves the other file's",
+			files: map[string]string{
+				"a.yaml": baseClient + "log:\n  level: \"error\"\n",
+				"b.yaml": "log:\n  level:\nsocks5:\n  - listen: \"127.0.0.1:1080\"\n",
+			},
+			paths:  []string{"a.yaml", "b.yaml"},
+			socks5: []string{"127.0.0.1:1080"},
+			level:  "error",
+		},
+		{
+			name: "same file twice",
+			files: map[string]string{
+				"a.yaml": baseClient + "socks5:\n  - listen: \"127.0.0.1:1080\"\n",
+			},
+			paths:  []string{"a.yaml", "./a.yaml"},
+			socks5: []string{"127.0.0.1:1080"},
+			level:  "none",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			var paths []string
+			for _, p := range tt.paths {
+				paths = append(paths, filepath.Join(dir, p))
+			}
+			c, err := Load(paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var socks5 []string
+			for _, s := range c.SOCKS5 {
+				socks5 = append(socks5, s.Listen.String())
+			}
+			if !slices.Equal(socks5, tt.socks5) {
+				t.Errorf("socks5 = %v, want %v", socks5, tt.socks5)
+			}
+			if c.Log.Level_ != tt.level {
+				t.Errorf("log level = %q, want %q", c.Log.Level_, tt.level)
+			}
+		})
+	}
+}
+
+func TestLoadConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "scalar",
+			files: map[string]string{
+				"a.yaml": baseClient + "log:\n  level: \"info\"\n",
+				"b.yaml": "\nlog:\n  level: \"debug\"\n",
+			},
+			want: "log.level: set in both a.yaml:11 and b.yaml:3",
+		},
+		{
+			name: "list against scalar",
+			files: map[string]string{
+				"a.yaml": baseClient + "socks5:\n  - listen: \"127.0.0.1:1080\"\n",
+				"b.yaml": "socks5: \"127.0.0.1:1081\"\n",
+			},
+			want: "socks5: set in both a.yaml:11 and b.yaml:1",
+		},
+		{
+			name: "mapping against scalar",
+			files: map[string]string{
+				"a.yaml": baseClient,
+				"b.yaml": "server: \"127.0.0.1:9999\"\n",
+			},
+			want: "server: set in both a.yaml:5 and b.yaml:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := Load(filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml"))
+			if err == nil {
+				t.Fatal("Load succeeded, want a conflict")
+			}
+			want := strings.ReplaceAll(tt.want, "a.yaml", filepath.Join(dir, "a.yaml"))
+			want = strings.ReplaceAll(want, " b.yaml", " "+filepath.Join(dir, "b.yaml"))
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		path  string
+		want  string
+	}{
+		{"missing include", map[string]string{"a.yaml": "include: \"other.yaml\"\n" + baseClient}, "a.yaml", "no such file"},
+		{"empty directory", map[string]string{"conf/readme.txt": "x"}, "conf", "no configuration files found"},
+		{"syntax", map[string]string{"a.yaml": "role: [\n"}, "a.yaml", "a.yaml"},
+		{"log subsystem", map[string]string{"a.yaml": baseClient + "log:\n  levels:\n    kcpp: \"debug\"\n"}, "a.yaml", "unknown log subsystem 'kcpp'"},
+		{"datagram mtu", map[string]string{"a.yaml": baseClient + "    mtu: 1500\n    datagram: true\n"}, "a.yaml", "at most 1499"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := Load(filepath.Join(dir, tt.path))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Subsystems whose packages conf does not import are still known.
+func TestLogLevels(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.yaml": baseClient + "log:\n  levels:\n    kcp: \"debug\"\n    quic: \"error\"\n"})
+	c, err := Load(filepath.Join(dir, "a.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Log.Levels["kcp"] != int(flog.Debug) || c.Log.Levels["quic"] != int(flog.Error) {
+		t.Errorf("levels = %v", c.Log.Levels)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("PAQET_TEST_SET", "value")
+	t.Setenv("PAQET_TEST_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"plain", "plain", false},
+		{"${PAQET_TEST_SET}", "value", false},
+		{"a-${PAQET_TEST_SET}-b", "a-value-b", false},
+		{"${PAQET_TEST_SET:-default}", "value", false},
+		{"${PAQET_TEST_UNSET:-default}", "default", false},
+		{"${PAQET_TEST_EMPTY:-default}", "default", false},
+		{"${PAQET_TEST_UNSET:-}", "", false},
+		{"${PAQET_TEST_EMPTY}", "", false},
+		{"$${PAQET_TEST_SET}", "${PAQET_TEST_SET}", false},
+		{"$${PAQET_TEST_SET} ${PAQET_TEST_SET}", "${PAQET_TEST_SET} value", false},
+		{"$PAQET_TEST_SET", "$PAQET_TEST_SET", false},
+		{"${1INVALID}", "${1INVALID}", false},
+		{"${PAQET_TEST_UNSET}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandEnv(tt.in)
+			if (err != nil) != tt.err {
+				t.Fatalf("expandEnv(%q) error = %v, want error %v", tt.in, err, tt.err)
+			}
+			if !tt.err && got != tt.want {
+				t.Errorf("expandEnv(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	t.Setenv("PAQET_TEST_KEY", "from-env")
+	dir := writeFiles(t, map[string]string{
+		"key":   "from-file\r\n",
+		"empty": "\n",
+	})
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"literal", "literal", false},
+		{"env:PAQET_TEST_KEY", "from-env", false},
+		{"env:PAQET_TEST_UNSET", "", true},
+		{"file:key", "from-file", false},
+		{"file:" + filepath.Join(dir, "key"), "from-file", false},
+		{"file:empty", "", true},
+		{"file:missing", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := readSecret(tt.in, dir)
+			if (err != nil) != tt.err {
+				t.Fatalf("readSecret(%q) error = %v, want error %v", tt.in, err, tt.err)
+			}
+			if !tt.err && got != tt.want {
+				t.Errorf("readSecret(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Control configures the local control API. Token, when set, must be sent
+// as a bearer token; it is required on a TCP listen address, where any local
+// user can connect.
+type Control struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token" secret:"true"`
+}
+
+func (c *Control) setDefaults() {}
+
+func (c *Control) validate() []error {
+	if c.Listen == "" {
+		return nil
+	}
+	network, _, err := ParseControlAddr(c.Listen)
+	if err != nil {
+		return []error{fmt.Errorf("control %v", err)}
+	}
+	if network == "tcp" && c.Token == "" {
+		return []error{fmt.Errorf("control token is required when listening on a TCP address")}
+	}
+	return nil
+}
+
+// ParseControlAddr accepts "unix:/path", a bare absolute path or a loopback
+// host:port.
+func ParseControlAddr(s string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(s, "unix:"); ok {
+		return "unix", path, nil
+	}
+	if strings.HasPrefix(s, "/") {
+		return "unix", s, nil
+	}
+
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid listen address '%s': %v", s, err)
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("listen address must be a unix socket or a loopback address")
+		}
+	}
+	return "tcp", s, nil
+}
@@ -0,0 +1,29 @@
+package conf
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Diff returns the yaml names of the top-level sections whose configured
+// values differ between c and next.
+func (c *Conf) Diff(next *Conf) []string {
+	var changed []string
+	a, b := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	t := a.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		x, errX := yaml.Marshal(a.Field(i).Interface())
+		y, errY := yaml.Marshal(b.Field(i).Interface())
+		if errX != nil || errY != nil || !bytes.Equal(x, y) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
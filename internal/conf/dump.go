@@ -0,0 +1,98 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const masked = "********"
+
+// Dump renders the configuration, defaults included, as yaml or json with
+// every field tagged `secret:"true"` masked.
+func (c *Conf) Dump(format string) ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	// The round trip through yaml leaves c untouched and copies exactly the
+	// fields that get printed.
+	var cp Conf
+	if err := yaml.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	mask(reflect.ValueOf(&cp).Elem())
+	var out any = &cp
+	if len(cp.Instances) > 0 {
+		// Each instance carries a copy of the shared sections; print them
+		// once, where they are configured.
+		instances := make([]yaml.MapSlice, len(cp.Instances))
+		for i := range cp.Instances {
+			instances[i] = sections(&cp.Instances[i], func(name string) bool { return !Shared(name) && name != "instances" })
+		}
+		top := sections(&cp, Shared)
+		out = append(top, yaml.MapItem{Key: "instances", Value: instances})
+	}
+	if data, err = yaml.Marshal(out); err != nil {
+		return nil, err
+	}
+	if format != "json" {
+		return data, nil
+	}
+
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// sections lists the top-level fields of c whose yaml names pass keep.
+func sections(c *Conf, keep func(name string) bool) yaml.MapSlice {
+	var m yaml.MapSlice
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" && keep(name) {
+			m = append(m, yaml.MapItem{Key: name, Value: v.Field(i).Interface()})
+		}
+	}
+	return m
+}
+
+func mask(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			mask(v.Elem())
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			mask(v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := v.Field(i)
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if t.Field(i).Tag.Get("secret") == "true" && f.Kind() == reflect.String {
+				if f.String() != "" {
+					f.SetString(masked)
+				}
+				continue
+			}
+			mask(f)
+		}
+	}
+}
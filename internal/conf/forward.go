@@ -1,19 +1,25 @@
 package conf
 
 import (
+	"fmt"
+	"github.com/starco76/paqet/internal/tnet"
 	"net"
-	"paqet/internal/tnet"
 )
 
 type Forward struct {
 	Listen_  string       `yaml:"listen"`
 	Target_  string       `yaml:"target"`
 	Protocol string       `yaml:"protocol"`
+	Service  string       `yaml:"service"`
 	Listen   *net.UDPAddr `yaml:"-"`
 	Target   *tnet.Addr   `yaml:"-"`
 }
 
-func (c *Forward) setDefaults() {}
+func (c *Forward) setDefaults() {
+	if c.Service != "" && c.Protocol == "" {
+		c.Protocol = "tcp"
+	}
+}
 func (c *Forward) validate() []error {
 	var errors []error
 	l, err := validateAddr(c.Listen_, true)
@@ -22,6 +28,15 @@ func (c *Forward) validate() []error {
 	}
 	c.Listen = l
 
+	if c.Service != "" {
+		if c.Target_ != "" {
+			errors = append(errors, fmt.Errorf("target and service cannot both be set"))
+		}
+		if c.Protocol != "tcp" {
+			errors = append(errors, fmt.Errorf("a service can only be forwarded over tcp"))
+		}
+		return errors
+	}
 	t, err := tnet.NewAddr(c.Target_)
 	if err != nil {
 		errors = append(errors, err)
@@ -0,0 +1,125 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// shared lists the sections that belong to the process rather than to one
+// instance: they are set once at the top level and every instance uses them.
+var shared = []string{"log", "access_log", "metrics", "control"}
+
+// Shared reports whether section is one of those set once for the process.
+func Shared(section string) bool {
+	return slices.Contains(shared, section)
+}
+
+var instanceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// checkInstances reports misplaced sections and bad names in a configuration
+// with instances. It runs before defaults fill in the sections it inspects.
+func (c *Conf) checkInstances() []error {
+	var errors []error
+	for _, name := range setSections(c) {
+		if name != "instances" && !slices.Contains(shared, name) {
+			errors = append(errors, fmt.Errorf("%s must be set inside each instance when instances are used", name))
+		}
+	}
+	seen := make(map[string]bool)
+	for i := range c.Instances {
+		in := &c.Instances[i]
+		switch {
+		case in.Name == "":
+			errors = append(errors, fmt.Errorf("instances[%d] name is required", i))
+		case !instanceName.MatchString(in.Name):
+			errors = append(errors, fmt.Errorf("instances[%d] name '%s' may only contain letters, digits, '_', '.' and '-'", i, in.Name))
+		case seen[in.Name]:
+			errors = append(errors, fmt.Errorf("instances[%d] name '%s' is used more than once", i, in.Name))
+		}
+		seen[in.Name] = true
+		if !slices.Contains(validRoles, in.Role) {
+			errors = append(errors, fmt.Errorf("%s role must be 'client' or 'server'", instanceRef(i, in.Name)))
+		}
+		for _, name := range setSections(in) {
+			if name == "instances" || slices.Contains(shared, name) {
+				errors = append(errors, fmt.Errorf("%s %s can only be set at the top level", instanceRef(i, in.Name), name))
+			}
+		}
+	}
+	return errors
+}
+
+// instanceRef names an instance in errors, by index when it has no name.
+func instanceRef(i int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("instances[%d]", i)
+	}
+	return fmt.Sprintf("instances[%s]", name)
+}
+
+// setSections returns the yaml names of the non-empty top-level fields of c.
+func setSections(c *Conf) []string {
+	var names []string
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || name == "name" {
+			continue
+		}
+		if !v.Field(i).IsZero() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Tunnels returns what the process runs: each instance, or c itself when the
+// configuration has no instances.
+func (c *Conf) Tunnels() []*Conf {
+	if len(c.Instances) == 0 {
+		return []*Conf{c}
+	}
+	list := make([]*Conf, len(c.Instances))
+	for i := range c.Instances {
+		list[i] = &c.Instances[i]
+	}
+	return list
+}
+
+// Tunnel picks one instance by name for commands that work on a single one.
+// The name may be empty when there is nothing to choose from.
+func (c *Conf) Tunnel(name string) (*Conf, error) {
+	if len(c.Instances) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("the configuration has no instances")
+		}
+		return c, nil
+	}
+	if name == "" && len(c.Instances) == 1 {
+		return &c.Instances[0], nil
+	}
+	var names []string
+	for i := range c.Instances {
+		if c.Instances[i].Name == name {
+			return &c.Instances[i], nil
+		}
+		names = append(names, c.Instances[i].Name)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("the configuration has several instances, choose one of: %s", strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("no instance named '%s', choose one of: %s", name, strings.Join(names, ", "))
+}
+
+// Label prefixes s with the instance name so that metrics and status entries
+// of different instances stay apart.
+func (c *Conf) Label(s string) string {
+	if c.Name == "" {
+		return s
+	}
+	return c.Name + "/" + s
+}
@@ -23,11 +23,13 @@ type KCP struct {
 	Pshard int `yaml:"pshard"`
 
 	Block_ string `yaml:"block"`
-	Key    string `yaml:"key"`
+	Key    string `yaml:"key" secret:"true"`
 
 	Smuxbuf   int `yaml:"smuxbuf"`
 	Streambuf int `yaml:"streambuf"`
 
+	Datagram bool `yaml:"datagram"`
+
 	Block kcp.BlockCrypt `yaml:"-"`
 }
 
@@ -84,6 +86,9 @@ func (k *KCP) validate() []error {
 	if k.MTU < 50 || k.MTU > 1500 {
 		errors = append(errors, fmt.Errorf("KCP MTU must be between 50-1500 bytes"))
 	}
+	if k.Datagram && k.MTU > 1499 {
+		errors = append(errors, fmt.Errorf("KCP MTU must be at most 1499 bytes with datagram enabled"))
+	}
 
 	if k.Rcvwnd < 1 || k.Rcvwnd > 32768 {
 		errors = append(errors, fmt.Errorf("KCP rcvwnd must be between 1-32768"))
@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+type Limits struct {
+	State   string        `yaml:"state"`
+	Report  int           `yaml:"report"`
+	Default Limit         `yaml:"default"`
+	Clients []ClientLimit `yaml:"clients"`
+}
+
+type Limit struct {
+	Upload   int64 `yaml:"upload"`
+	Download int64 `yaml:"download"`
+	Daily    int64 `yaml:"daily"`
+	Monthly  int64 `yaml:"monthly"`
+}
+
+type ClientLimit struct {
+	Addr_ string `yaml:"addr"`
+	Limit `yaml:",inline"`
+	Addr  netip.Prefix `yaml:"-"`
+}
+
+func (l *Limits) setDefaults() {
+	if l.Report == 0 {
+		l.Report = 300
+	}
+}
+
+func (l *Limits) validate() []error {
+	var errors []error
+
+	if l.Report < 0 {
+		errors = append(errors, fmt.Errorf("limits report interval must be >= 0 seconds"))
+	}
+	errors = append(errors, l.Default.validate()...)
+	for i := range l.Clients {
+		c := &l.Clients[i]
+		p, err := parsePrefix(c.Addr_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("limits.clients[%d] invalid address '%s': %v", i, c.Addr_, err))
+		}
+		c.Addr = p
+		for _, err := range c.Limit.validate() {
+			errors = append(errors, fmt.Errorf("limits.clients[%d] %v", i, err))
+		}
+	}
+
+	return errors
+}
+
+func (l *Limit) validate() []error {
+	var errors []error
+	if l.Upload < 0 || l.Download < 0 {
+		errors = append(errors, fmt.Errorf("upload and download rates must be >= 0 bytes/s"))
+	}
+	if l.Daily < 0 || l.Monthly < 0 {
+		errors = append(errors, fmt.Errorf("daily and monthly quotas must be >= 0 bytes"))
+	}
+	return errors
+}
+
+func (l *Limits) For(ip netip.Addr) Limit {
+	ip = ip.Unmap()
+	for _, c := range l.Clients {
+		if c.Addr.Contains(ip) {
+			return c.Limit
+		}
+	}
+	return l.Default
+}
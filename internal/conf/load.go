@@ -0,0 +1,278 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// Load reads the configuration from one or more paths and merges them. A
+// directory stands for the *.yaml and *.yml files in it, in name order, and
+// any file can pull in more with a top-level include list of globs relative
+// to itself. Lists are concatenated across files; a scalar set to different
+// values in two files is an error.
+func Load(paths ...string) (*Conf, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no configuration file given")
+	}
+	var l loader
+	for _, path := range paths {
+		if err := l.add(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(l.files) == 0 {
+		return nil, fmt.Errorf("no configuration files found in %s", strings.Join(paths, ", "))
+	}
+	dir := filepath.Dir(l.files[0].path)
+	if len(l.files) == 1 {
+		return load(l.files[0].data, dir)
+	}
+
+	root := &node{}
+	var errors []error
+	for _, f := range l.files {
+		for _, doc := range f.ast.Docs {
+			if doc.Body != nil {
+				errors = append(errors, root.merge(doc.Body, f.path, "")...)
+			}
+		}
+	}
+	if err := writeErr(errors); err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(root.value())
+	if err != nil {
+		return nil, err
+	}
+	return load(data, dir)
+}
+
+type file struct {
+	path string
+	data []byte
+	ast  *ast.File
+}
+
+type loader struct {
+	files []file
+	seen  map[string]bool
+}
+
+func (l *loader) add(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if ext := filepath.Ext(e.Name()); !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				if err := l.add(filepath.Join(path, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	if l.seen[abs] {
+		return nil
+	}
+	l.seen[abs] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	l.files = append(l.files, file{path: path, data: data, ast: f})
+
+	for _, pattern := range includes(f) {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: include %q: %w", path, pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: include %q: no such file", path, pattern)
+		}
+		for _, m := range matches {
+			if err := l.add(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// includes returns the globs listed under the top-level include key.
+func includes(f *ast.File) []string {
+	var globs []string
+	for _, doc := range f.Docs {
+		for _, mv := range mappingValues(doc.Body) {
+			if mv.Key.String() != "include" {
+				continue
+			}
+			var v any
+			if err := yaml.NodeToValue(mv.Value, &v); err != nil {
+				continue
+			}
+			switch v := v.(type) {
+			case string:
+				globs = append(globs, v)
+			case []any:
+				for _, g := range v {
+					if s, ok := g.(string); ok {
+						globs = append(globs, s)
+					}
+				}
+			}
+		}
+	}
+	return globs
+}
+
+func mappingValues(n ast.Node) []*ast.MappingValueNode {
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	case *ast.AnchorNode:
+		return mappingValues(n.Value)
+	case *ast.TagNode:
+		return mappingValues(n.Value)
+	}
+	return nil
+}
+
+// node is one value of the merged document, remembering where it was set.
+type node struct {
+	file string
+	line int
+
+	keys   []string
+	fields map[string]*node
+	list   []any
+	isList bool
+	scalar any
+	isSet  bool
+}
+
+func (n *node) merge(an ast.Node, file, path string) []error {
+	if seq, ok := unwrap(an).(*ast.SequenceNode); ok {
+		var items []any
+		for _, item := range seq.Values {
+			var v any
+			if err := yaml.NodeToValue(item, &v); err != nil {
+				return []error{fmt.Errorf("%s:%d: %v", file, line(item), err)}
+			}
+			items = append(items, v)
+		}
+		if n.isSet && !n.isList {
+			return []error{n.conflict(file, line(an), path)}
+		}
+		n.list = append(n.list, items...)
+		n.isList, n.isSet, n.file, n.line = true, true, file, line(an)
+		return nil
+	}
+
+	if values := mappingValues(an); values != nil {
+		if n.isSet && n.fields == nil {
+			return []error{n.conflict(file, line(an), path)}
+		}
+		if n.fields == nil {
+			n.fields = make(map[string]*node)
+		}
+		n.isSet, n.file, n.line = true, file, line(an)
+		var errors []error
+		for _, mv := range values {
+			key := mv.Key.String()
+			if path == "" && key == "include" {
+				continue
+			}
+			child, ok := n.fields[key]
+			if !ok {
+				child = &node{}
+				n.fields[key] = child
+				n.keys = append(n.keys, key)
+			}
+			errors = append(errors, child.merge(mv.Value, file, strings.TrimPrefix(path+"."+key, "."))...)
+		}
+		return errors
+	}
+
+	var v any
+	if err := yaml.NodeToValue(an, &v); err != nil {
+		return []error{fmt.Errorf("%s:%d: %v", file, line(an), err)}
+	}
+	if v == nil {
+		// An empty value leaves whatever another file set.
+		return nil
+	}
+	if n.isSet && (n.isList || n.fields != nil || n.scalar != v) {
+		return []error{n.conflict(file, line(an), path)}
+	}
+	n.scalar, n.isSet, n.file, n.line = v, true, file, line(an)
+	return nil
+}
+
+func (n *node) conflict(file string, line int, path string) error {
+	return fmt.Errorf("%s: set in both %s:%d and %s:%d", path, n.file, n.line, file, line)
+}
+
+func (n *node) value() any {
+	switch {
+	case n.fields != nil:
+		m := make(yaml.MapSlice, 0, len(n.keys))
+		for _, k := range n.keys {
+			m = append(m, yaml.MapItem{Key: k, Value: n.fields[k].value()})
+		}
+		return m
+	case n.isList:
+		return slices.Clip(n.list)
+	}
+	return n.scalar
+}
+
+func unwrap(n ast.Node) ast.Node {
+	for {
+		switch v := n.(type) {
+		case *ast.AnchorNode:
+			n = v.Value
+		case *ast.TagNode:
+			n = v.Value
+		default:
+			return n
+		}
+	}
+}
+
+func line(n ast.Node) int {
+	if t := n.GetToken(); t != nil && t.Position != nil {
+		return t.Position.Line
+	}
+	return 0
+}
@@ -2,37 +2,64 @@ package conf
 
 import (
 	"fmt"
+	"github.com/starco76/paqet/internal/flog"
+	"slices"
 )
 
 type Log struct {
-	Level_ string `yaml:"level"`
+	Level_     string            `yaml:"level"`
+	Format     string            `yaml:"format"`
+	File       string            `yaml:"file"`
+	MaxSize    int               `yaml:"max_size"`
+	MaxAge     int               `yaml:"max_age"`
+	MaxBackups int               `yaml:"max_backups"`
+	Levels_    map[string]string `yaml:"levels"`
 
-	Level int `yaml:"-"`
+	Level  int            `yaml:"-"`
+	Levels map[string]int `yaml:"-"`
 }
 
 func (l *Log) setDefaults() {
 	if l.Level_ == "" {
 		l.Level_ = "none"
 	}
+	if l.Format == "" {
+		l.Format = "text"
+	}
+	if l.File != "" && l.MaxSize == 0 {
+		l.MaxSize = 100
+	}
 }
 
 func (l *Log) validate() []error {
 	var errors []error
-	switch l.Level_ {
-	case "none":
-		l.Level = -1
-	case "debug":
-		l.Level = 0
-	case "info":
-		l.Level = 1
-	case "warn":
-		l.Level = 2
-	case "error":
-		l.Level = 3
-	case "fatal":
-		l.Level = 4
-	default:
-		errors = append(errors, fmt.Errorf("invalid logging level '%s': must be one of none, debug, info, warn, error, fatal", l.Level_))
+	level, err := flog.ParseLevel(l.Level_)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	l.Level = int(level)
+
+	if l.Format != "text" && l.Format != "json" {
+		errors = append(errors, fmt.Errorf("log format must be 'text' or 'json'"))
+	}
+	if l.MaxSize < 0 || l.MaxAge < 0 || l.MaxBackups < 0 {
+		errors = append(errors, fmt.Errorf("log max_size, max_age and max_backups must not be negative"))
+	}
+
+	known := flog.Subsystems()
+	l.Levels = make(map[string]int, len(l.Levels_))
+	for sub, s := range l.Levels_ {
+		if !slices.Contains(known, sub) {
+			slices.Sort(known)
+			errors = append(errors, fmt.Errorf("unknown log subsystem '%s': must be one of %v", sub, known))
+			continue
+		}
+		level, err := flog.ParseLevel(s)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("log level for %s: %v", sub, err))
+			continue
+		}
+		l.Levels[sub] = int(level)
 	}
 	return errors
 }
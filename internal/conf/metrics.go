@@ -0,0 +1,37 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type Metrics struct {
+	Listen_ string       `yaml:"listen"`
+	Path    string       `yaml:"path"`
+	Listen  *net.UDPAddr `yaml:"-"`
+}
+
+func (m *Metrics) setDefaults() {
+	if m.Path == "" {
+		m.Path = "/metrics"
+	}
+}
+
+func (m *Metrics) validate() []error {
+	if m.Listen_ == "" {
+		return nil
+	}
+	var errors []error
+
+	addr, err := validateAddr(m.Listen_, true)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("metrics %v", err))
+	}
+	m.Listen = addr
+
+	if !strings.HasPrefix(m.Path, "/") {
+		errors = append(errors, fmt.Errorf("metrics path must start with '/'"))
+	}
+	return errors
+}
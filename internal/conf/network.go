@@ -1,9 +1,11 @@
 package conf
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"runtime"
+	"slices"
 )
 
 type Addr struct {
@@ -13,7 +15,14 @@ type Addr struct {
 	Router     net.HardwareAddr `yaml:"-"`
 }
 
+var validCarriers = []string{"pcap-raw", "udp", "tcp-stream"}
+
 type Network struct {
+	// Carrier is how packets reach the peer: "pcap-raw" injects them as raw
+	// TCP segments, "udp" sends them from a kernel UDP socket and
+	// "tcp-stream" frames them over a kernel TCP connection. Only pcap-raw
+	// uses the interface, router MACs, pcap and TCP flag settings.
+	Carrier    string         `yaml:"carrier"`
 	Interface_ string         `yaml:"interface"`
 	GUID       string         `yaml:"guid"`
 	IPv4       Addr           `yaml:"ipv4"`
@@ -22,16 +31,34 @@ type Network struct {
 	TCP        TCP            `yaml:"tcp"`
 	Interface  *net.Interface `yaml:"-"`
 	Port       int            `yaml:"-"`
+
+	// PacketConn replaces the raw socket when set by code embedding paqet;
+	// the interface, addresses and pcap settings are then left unused.
+	PacketConn func(ctx context.Context) (net.PacketConn, error) `yaml:"-"`
 }
 
 func (n *Network) setDefaults(role string) {
+	if n.Carrier == "" {
+		n.Carrier = "pcap-raw"
+	}
 	n.PCAP.setDefaults(role)
 	n.TCP.setDefaults()
 }
 
 func (n *Network) validate() []error {
+	if n.PacketConn != nil {
+		return nil
+	}
 	var errors []error
 
+	if !slices.Contains(validCarriers, n.Carrier) {
+		errors = append(errors, fmt.Errorf("network carrier must be one of: %v", validCarriers))
+		return errors
+	}
+	if n.Carrier != "pcap-raw" {
+		return append(errors, n.validateSocket()...)
+	}
+
 	if n.Interface_ == "" {
 		errors = append(errors, fmt.Errorf("network interface is required"))
 	}
@@ -78,6 +105,28 @@ func (n *Network) validate() []error {
 	return errors
 }
 
+// validateSocket checks a kernel socket carrier, which binds to the
+// configured addresses, if any, and needs nothing else.
+func (n *Network) validateSocket() []error {
+	var errors []error
+	for _, a := range []*Addr{&n.IPv4, &n.IPv6} {
+		if a.Addr_ == "" {
+			continue
+		}
+		l, err := validateAddr(a.Addr_, false)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		a.Addr = l
+		n.Port = l.Port
+	}
+	if n.IPv4.Addr != nil && n.IPv6.Addr != nil && n.IPv4.Addr.Port != n.IPv6.Addr.Port {
+		errors = append(errors, fmt.Errorf("IPv4 port (%d) and IPv6 port (%d) must match when both are configured", n.IPv4.Addr.Port, n.IPv6.Addr.Port))
+	}
+	return errors
+}
+
 func (n *Addr) validate() []error {
 	var errors []error
 
@@ -0,0 +1,113 @@
+package conf
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+	"runtime"
+	"slices"
+)
+
+type Outbound struct {
+	Default string         `yaml:"default"`
+	Dialers []Dialer       `yaml:"dialers"`
+	Rules   []OutboundRule `yaml:"rules"`
+}
+
+type Dialer struct {
+	Name      string     `yaml:"name"`
+	Type      string     `yaml:"type"`
+	Addr_     string     `yaml:"addr"`
+	Username  string     `yaml:"username"`
+	Password  string     `yaml:"password" secret:"true"`
+	Source_   string     `yaml:"source"`
+	Interface string     `yaml:"interface"`
+	Addr      *tnet.Addr `yaml:"-"`
+	Source    net.IP     `yaml:"-"`
+}
+
+type OutboundRule struct {
+	ACLRule `yaml:",inline"`
+	Dialer  string `yaml:"dialer"`
+}
+
+func (o *Outbound) setDefaults() {
+	if o.Default == "" {
+		o.Default = "direct"
+	}
+	for i := range o.Dialers {
+		if o.Dialers[i].Type == "" {
+			o.Dialers[i].Type = "direct"
+		}
+	}
+	if !slices.ContainsFunc(o.Dialers, func(d Dialer) bool { return d.Name == "direct" }) {
+		o.Dialers = append(o.Dialers, Dialer{Name: "direct", Type: "direct"})
+	}
+}
+
+func (o *Outbound) validate() []error {
+	var errors []error
+
+	names := make(map[string]bool)
+	for i := range o.Dialers {
+		d := &o.Dialers[i]
+		if d.Name == "" {
+			errors = append(errors, fmt.Errorf("outbound.dialers[%d] name is required", i))
+		} else if names[d.Name] {
+			errors = append(errors, fmt.Errorf("outbound.dialers[%d] duplicate name '%s'", i, d.Name))
+		}
+		names[d.Name] = true
+		for _, err := range d.validate() {
+			errors = append(errors, fmt.Errorf("outbound.dialers[%d] %v", i, err))
+		}
+	}
+
+	if !names[o.Default] {
+		errors = append(errors, fmt.Errorf("outbound default dialer '%s' is not defined", o.Default))
+	}
+	for i := range o.Rules {
+		r := &o.Rules[i]
+		for _, err := range r.ACLRule.validate() {
+			errors = append(errors, fmt.Errorf("outbound.rules[%d] %v", i, err))
+		}
+		if !names[r.Dialer] {
+			errors = append(errors, fmt.Errorf("outbound.rules[%d] dialer '%s' is not defined", i, r.Dialer))
+		}
+	}
+
+	return errors
+}
+
+func (d *Dialer) validate() []error {
+	var errors []error
+
+	validTypes := []string{"direct", "socks5", "http"}
+	if !slices.Contains(validTypes, d.Type) {
+		errors = append(errors, fmt.Errorf("type must be one of: %v", validTypes))
+	}
+
+	if d.Type != "direct" {
+		addr, err := tnet.NewAddr(d.Addr_)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid proxy address '%s': %v", d.Addr_, err))
+		}
+		d.Addr = addr
+	}
+
+	if d.Source_ != "" {
+		d.Source = net.ParseIP(d.Source_)
+		if d.Source == nil {
+			errors = append(errors, fmt.Errorf("invalid source address '%s'", d.Source_))
+		}
+	}
+	if d.Interface != "" {
+		if runtime.GOOS != "linux" {
+			errors = append(errors, fmt.Errorf("interface binding is only supported on linux"))
+		}
+		if _, err := net.InterfaceByName(d.Interface); err != nil {
+			errors = append(errors, fmt.Errorf("failed to find network interface %s: %v", d.Interface, err))
+		}
+	}
+
+	return errors
+}
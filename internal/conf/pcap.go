@@ -2,7 +2,7 @@ package conf
 
 import (
 	"fmt"
-	"paqet/internal/flog"
+	"github.com/starco76/paqet/internal/flog"
 )
 
 type PCAP struct {
@@ -0,0 +1,80 @@
+package conf
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+type QUIC struct {
+	Key         string `yaml:"key" secret:"true"`
+	ALPN        string `yaml:"alpn"`
+	IdleTimeout int    `yaml:"idle_timeout"`
+	KeepAlive   int    `yaml:"keepalive"`
+	MaxStreams  int    `yaml:"max_streams"`
+	Datagram    bool   `yaml:"datagram"`
+
+	// Identity is derived from Key. Both peers present a certificate for it
+	// and accept only a peer that presents the same one.
+	Identity ed25519.PrivateKey `yaml:"-"`
+}
+
+func (q *QUIC) setDefaults() {
+	if q.ALPN == "" {
+		q.ALPN = "paqet"
+	}
+	if q.IdleTimeout == 0 {
+		q.IdleTimeout = 30
+	}
+	if q.KeepAlive == 0 {
+		q.KeepAlive = 10
+	}
+	if q.MaxStreams == 0 {
+		q.MaxStreams = 1024
+	}
+}
+
+func (q *QUIC) validate() []error {
+	var errors []error
+
+	if len(q.Key) == 0 {
+		errors = append(errors, fmt.Errorf("QUIC key is required"))
+	}
+	if q.IdleTimeout < 1 || q.IdleTimeout > 600 {
+		errors = append(errors, fmt.Errorf("QUIC idle_timeout must be between 1-600 seconds"))
+	}
+	if q.KeepAlive < 1 || q.KeepAlive >= q.IdleTimeout {
+		errors = append(errors, fmt.Errorf("QUIC keepalive must be at least 1 second and less than idle_timeout"))
+	}
+	if q.MaxStreams < 1 || q.MaxStreams > 65535 {
+		errors = append(errors, fmt.Errorf("QUIC max_streams must be between 1-65535"))
+	}
+	q.Identity = quicIdentity(q.Key)
+
+	return errors
+}
+
+// The derivation is slow on purpose and the same keys are validated again
+// on reload and when URIs are parsed, so every identity derived is kept.
+var identities struct {
+	sync.Mutex
+	m map[string]ed25519.PrivateKey
+}
+
+func quicIdentity(key string) ed25519.PrivateKey {
+	identities.Lock()
+	defer identities.Unlock()
+	if priv, ok := identities.m[key]; ok {
+		return priv
+	}
+	if identities.m == nil {
+		identities.m = make(map[string]ed25519.PrivateKey)
+	}
+	seed := pbkdf2.Key([]byte(key), []byte("paqet-quic"), 100_000, ed25519.SeedSize, sha256.New)
+	priv := ed25519.NewKeyFromSeed(seed)
+	identities.m[key] = priv
+	return priv
+}
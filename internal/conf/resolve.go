@@ -0,0 +1,131 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// envRef matches ${NAME} and ${NAME:-default}; $${ escapes a literal ${.
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// resolve expands ${NAME} in every string value, then replaces env:NAME and
+// file:path references in fields tagged `secret:"true"`. Relative secret
+// files are read from dir.
+func (c *Conf) resolve(dir string) []error {
+	var errors []error
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path string, s string, secret bool) string {
+		v, err := expandEnv(s)
+		if err == nil && secret {
+			v, err = readSecret(v, dir)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%s: %v", path, err))
+			return s
+		}
+		return v
+	})
+	return errors
+}
+
+func expandEnv(s string) (string, error) {
+	var err error
+	s = envRef.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		sub := envRef.FindStringSubmatch(m)
+		v, ok := os.LookupEnv(sub[1])
+		if strings.Contains(m, ":-") {
+			if v == "" {
+				return sub[2]
+			}
+			return v
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", sub[1])
+		}
+		return v
+	})
+	return s, err
+}
+
+// ReadSecret resolves an env:NAME or file:path reference given outside a
+// configuration file; relative paths start at the working directory.
+func ReadSecret(s string) (string, error) {
+	return readSecret(s, ".")
+}
+
+func readSecret(s, dir string) (string, error) {
+	if name, ok := strings.CutPrefix(s, "env:"); ok {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	}
+	if path, ok := strings.CutPrefix(s, "file:"); ok {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read secret file: %v", err)
+		}
+		v := strings.TrimRight(string(data), "\r\n")
+		if v == "" {
+			return "", fmt.Errorf("secret file %s is empty", path)
+		}
+		return v, nil
+	}
+	return s, nil
+}
+
+// walkStrings calls fn for every string reachable from v through yaml
+// fields, storing what it returns; path is the yaml path of the value.
+func walkStrings(v reflect.Value, path string, fn func(path, s string, secret bool) string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			p := fmt.Sprintf("%s.%v", path, iter.Key())
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(fn(p, iter.Value().String(), false)).Convert(v.Type().Elem()))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			p := path
+			if opts != "inline" {
+				if name == "" {
+					name = strings.ToLower(field.Name)
+				}
+				p = strings.TrimPrefix(path+"."+name, ".")
+			}
+			f := v.Field(i)
+			if f.Kind() == reflect.String {
+				f.SetString(fn(p, f.String(), field.Tag.Get("secret") == "true"))
+				continue
+			}
+			walkStrings(f, p, fn)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Resolver configures how the server resolves destination names. A zero
+// CacheSize or MinTTL takes the default; -1 turns the cache or the TTL floor
+// off.
+type Resolver struct {
+	Servers_      []string            `yaml:"servers"`
+	Prefer        string              `yaml:"prefer"`
+	Hosts_        map[string][]string `yaml:"hosts"`
+	CacheSize     int                 `yaml:"cache_size"`
+	MinTTL        int                 `yaml:"min_ttl"`
+	MaxTTL        int                 `yaml:"max_ttl"`
+	Timeout       int                 `yaml:"timeout"`
+	FallbackDelay int                 `yaml:"fallback_delay"`
+
+	Servers []*url.URL              `yaml:"-"`
+	Hosts   map[string][]netip.Addr `yaml:"-"`
+}
+
+func (r *Resolver) setDefaults() {
+	if r.Prefer == "" {
+		r.Prefer = "auto"
+	}
+	if r.CacheSize == 0 {
+		r.CacheSize = 4096
+	}
+	if r.MinTTL == 0 {
+		r.MinTTL = 10
+	}
+	if r.MaxTTL == 0 {
+		r.MaxTTL = 3600
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 5
+	}
+	if r.FallbackDelay == 0 {
+		r.FallbackDelay = 300
+	}
+}
+
+func (r *Resolver) validate() []error {
+	var errors []error
+
+	r.Servers = make([]*url.URL, 0, len(r.Servers_))
+	for _, s := range r.Servers_ {
+		u, err := parseDNSServer(s)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid resolver server '%s': %v", s, err))
+			continue
+		}
+		r.Servers = append(r.Servers, u)
+	}
+
+	validPrefer := []string{"auto", "ipv4", "ipv6", "ipv4-only", "ipv6-only"}
+	if !slices.Contains(validPrefer, r.Prefer) {
+		errors = append(errors, fmt.Errorf("resolver prefer must be one of: %v", validPrefer))
+	}
+
+	r.Hosts = make(map[string][]netip.Addr, len(r.Hosts_))
+	for host, addrs := range r.Hosts_ {
+		name := strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, a := range addrs {
+			ip, err := netip.ParseAddr(a)
+			if err != nil {
+				errors = append(errors, fmt.Errorf("invalid resolver hosts address '%s' for %s", a, host))
+				continue
+			}
+			r.Hosts[name] = append(r.Hosts[name], ip.Unmap())
+		}
+	}
+
+	if r.CacheSize < -1 {
+		errors = append(errors, fmt.Errorf("resolver cache_size must be -1 (disabled) or more"))
+	}
+	if r.MinTTL < -1 || r.MaxTTL < max(r.MinTTL, 0) {
+		errors = append(errors, fmt.Errorf("resolver TTLs must satisfy min_ttl <= max_ttl, with min_ttl -1 (no minimum) or more"))
+	}
+	if r.Timeout < 1 || r.Timeout > 60 {
+		errors = append(errors, fmt.Errorf("resolver timeout must be between 1-60 seconds"))
+	}
+	if r.FallbackDelay < 0 || r.FallbackDelay > 10000 {
+		errors = append(errors, fmt.Errorf("resolver fallback_delay must be between 0-10000 milliseconds"))
+	}
+
+	return errors
+}
+
+func parseDNSServer(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "udp://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "53")
+		}
+		if _, err := netip.ParseAddr(u.Hostname()); err != nil {
+			return nil, fmt.Errorf("%s servers must be IP addresses", u.Scheme)
+		}
+	case "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing host")
+		}
+	default:
+		return nil, fmt.Errorf("scheme must be udp, tcp or https")
+	}
+	return u, nil
+}
@@ -0,0 +1,86 @@
+package conf
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/tnet"
+	"net/netip"
+	"slices"
+)
+
+type Reverse struct {
+	Listen_  string     `yaml:"listen"`
+	Target_  string     `yaml:"target"`
+	Protocol string     `yaml:"protocol"`
+	Listen   *tnet.Addr `yaml:"-"`
+	Target   *tnet.Addr `yaml:"-"`
+}
+
+func (c *Reverse) setDefaults() {
+	if c.Protocol == "" {
+		c.Protocol = "tcp"
+	}
+}
+
+func (c *Reverse) validate() []error {
+	var errors []error
+
+	validProtocols := []string{"tcp", "udp"}
+	if !slices.Contains(validProtocols, c.Protocol) {
+		errors = append(errors, fmt.Errorf("protocol must be one of: %v", validProtocols))
+	}
+
+	l, err := tnet.NewAddr(c.Listen_)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("invalid listen address '%s': %v", c.Listen_, err))
+	} else if l.Port < 1 || l.Port > 65535 {
+		errors = append(errors, fmt.Errorf("listen port must be between 1-65535"))
+	}
+	c.Listen = l
+
+	t, err := tnet.NewAddr(c.Target_)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("invalid target address '%s': %v", c.Target_, err))
+	}
+	c.Target = t
+
+	return errors
+}
+
+// ReverseBind lists the addresses clients may open reverse listeners on.
+// Rules match the bind address by cidr and ports; with no rules every
+// registration is refused.
+type ReverseBind struct {
+	Allow []ACLRule `yaml:"allow"`
+}
+
+func (r *ReverseBind) setDefaults() {}
+
+func (r *ReverseBind) validate() []error {
+	var errors []error
+	for i := range r.Allow {
+		for _, err := range r.Allow[i].validate() {
+			errors = append(errors, fmt.Errorf("reverse_bind.allow[%d] %v", i, err))
+		}
+		if len(r.Allow[i].Domain) > 0 {
+			errors = append(errors, fmt.Errorf("reverse_bind.allow[%d] domain does not apply to bind addresses", i))
+		}
+	}
+	return errors
+}
+
+// Allows reports whether a client may listen on addr. An empty host binds
+// every address and matches as 0.0.0.0.
+func (r *ReverseBind) Allows(addr *tnet.Addr) bool {
+	var ip netip.Addr
+	if addr.Host == "" {
+		ip = netip.IPv4Unspecified()
+	} else if a, err := netip.ParseAddr(addr.Host); err == nil {
+		ip = a
+	}
+	for i := range r.Allow {
+		if r.Allow[i].Match(addr.Host, ip, addr.Port) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Service makes a built-in handler available to clients under Name.
+type Service struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+var serviceTypes = []string{"echo", "discard", "socks5", "http", "bench"}
+
+func (s *Service) setDefaults() {
+	if s.Type == "" {
+		s.Type = s.Name
+	}
+}
+
+func (s *Service) validate() []error {
+	var errors []error
+	if s.Name == "" {
+		errors = append(errors, fmt.Errorf("name is required"))
+	}
+	if !slices.Contains(serviceTypes, s.Type) {
+		errors = append(errors, fmt.Errorf("type must be one of: %v", serviceTypes))
+	}
+	return errors
+}
@@ -7,7 +7,7 @@ import (
 type SOCKS5 struct {
 	Listen_  string       `yaml:"listen"`
 	Username string       `yaml:"username"`
-	Password string       `yaml:"password"`
+	Password string       `yaml:"password" secret:"true"`
 	Listen   *net.UDPAddr `yaml:"-"`
 }
 
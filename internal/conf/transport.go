@@ -11,6 +11,7 @@ type Transport struct {
 	TCPBuf   int    `yaml:"tcpbuf"`
 	UDPBuf   int    `yaml:"udpbuf"`
 	KCP      *KCP   `yaml:"kcp"`
+	QUIC     *QUIC  `yaml:"quic"`
 }
 
 func (t *Transport) setDefaults(role string) {
@@ -34,24 +35,42 @@ func (t *Transport) setDefaults(role string) {
 	switch t.Protocol {
 	case "kcp":
 		t.KCP.setDefaults(role)
+	case "quic":
+		if t.QUIC == nil {
+			t.QUIC = &QUIC{}
+		}
+		t.QUIC.setDefaults()
 	}
 }
 
+// key returns the shared secret of the selected protocol.
+func (t *Transport) key() string {
+	switch {
+	case t.Protocol == "kcp" && t.KCP != nil:
+		return t.KCP.Key
+	case t.Protocol == "quic" && t.QUIC != nil:
+		return t.QUIC.Key
+	}
+	return ""
+}
+
 func (t *Transport) validate() []error {
 	var errors []error
 
-	validProtocols := []string{"kcp"}
+	validProtocols := []string{"kcp", "quic"}
 	if !slices.Contains(validProtocols, t.Protocol) {
 		errors = append(errors, fmt.Errorf("transport protocol must be one of: %v", validProtocols))
 	}
 
 	if t.Conn < 1 || t.Conn > 256 {
-		errors = append(errors, fmt.Errorf("KCP conn must be between 1-256 connections"))
+		errors = append(errors, fmt.Errorf("transport conn must be between 1-256 connections"))
 	}
 
 	switch t.Protocol {
 	case "kcp":
 		errors = append(errors, t.KCP.validate()...)
+	case "quic":
+		errors = append(errors, t.QUIC.validate()...)
 	}
 
 	return errors
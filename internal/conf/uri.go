@@ -0,0 +1,171 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// URI carries what a client must share with a server to reach it, in the
+// form paqet://key@host:port?transport=kcp&mode=fast&...#name. Local network
+// details are left out; they differ on every machine.
+type URI struct {
+	Name      string
+	Server    string
+	Transport Transport
+	// Carrier is the server's network carrier, which the client must use
+	// too.
+	Carrier string
+	// TCP holds the flags from the client's point of view.
+	TCP TCP
+}
+
+// URI describes this server as reached at host.
+func (c *Conf) URI(host, name string) (*URI, error) {
+	if c.Role != "server" {
+		return nil, fmt.Errorf("only a server configuration can be exported")
+	}
+	_, port, err := net.SplitHostPort(c.Listen.Addr_)
+	if err != nil {
+		return nil, err
+	}
+	return &URI{
+		Name:      name,
+		Server:    net.JoinHostPort(host, port),
+		Transport: c.Transport,
+		Carrier:   c.Network.Carrier,
+		// What the server expects from its peer is what the client sends.
+		TCP: TCP{LF_: c.Network.TCP.RF_, RF_: c.Network.TCP.LF_},
+	}, nil
+}
+
+func (u *URI) String() string {
+	q := url.Values{}
+	q.Set("transport", u.Transport.Protocol)
+	if k := u.Transport.KCP; k != nil && u.Transport.Protocol == "kcp" {
+		q.Set("mode", k.Mode)
+		if k.Mode == "manual" {
+			q.Set("nodelay", strconv.Itoa(k.NoDelay))
+			q.Set("interval", strconv.Itoa(k.Interval))
+			q.Set("resend", strconv.Itoa(k.Resend))
+			q.Set("nc", strconv.Itoa(k.NoCongestion))
+		}
+		q.Set("mtu", strconv.Itoa(k.MTU))
+		if k.Dshard > 0 || k.Pshard > 0 {
+			q.Set("ds", strconv.Itoa(k.Dshard))
+			q.Set("ps", strconv.Itoa(k.Pshard))
+		}
+		q.Set("block", k.Block_)
+		if k.Datagram {
+			q.Set("datagram", "1")
+		}
+	}
+	if qc := u.Transport.QUIC; qc != nil && u.Transport.Protocol == "quic" {
+		if qc.ALPN != "" && qc.ALPN != "paqet" {
+			q.Set("alpn", qc.ALPN)
+		}
+		if qc.Datagram {
+			q.Set("datagram", "1")
+		}
+	}
+	if u.Carrier != "" && u.Carrier != "pcap-raw" {
+		q.Set("carrier", u.Carrier)
+	}
+	q.Set("lf", strings.Join(u.TCP.LF_, ","))
+	q.Set("rf", strings.Join(u.TCP.RF_, ","))
+
+	r := url.URL{Scheme: "paqet", Host: u.Server, RawQuery: q.Encode(), Fragment: u.Name}
+	if key := u.Transport.key(); key != "" {
+		r.User = url.User(key)
+	}
+	return r.String()
+}
+
+// ParseURI decodes and validates a paqet:// URI.
+func ParseURI(s string) (*URI, error) {
+	r, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if r.Scheme != "paqet" {
+		return nil, fmt.Errorf("not a paqet:// URI")
+	}
+
+	var errors []error
+	q := r.Query()
+	atoi := func(name string) int {
+		v := q.Get(name)
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%s must be a number", name))
+		}
+		return n
+	}
+	u := &URI{
+		Name:    r.Fragment,
+		Server:  r.Host,
+		Carrier: q.Get("carrier"),
+		Transport: Transport{
+			Protocol: q.Get("transport"),
+		},
+	}
+	if u.Transport.Protocol == "quic" {
+		u.Transport.QUIC = &QUIC{
+			ALPN:     q.Get("alpn"),
+			Datagram: q.Get("datagram") == "1",
+			Key:      r.User.Username(),
+		}
+	} else {
+		u.Transport.KCP = &KCP{
+			Mode:         q.Get("mode"),
+			NoDelay:      atoi("nodelay"),
+			Interval:     atoi("interval"),
+			Resend:       atoi("resend"),
+			NoCongestion: atoi("nc"),
+			MTU:          atoi("mtu"),
+			Dshard:       atoi("ds"),
+			Pshard:       atoi("ps"),
+			Block_:       q.Get("block"),
+			Datagram:     q.Get("datagram") == "1",
+			Key:          r.User.Username(),
+		}
+	}
+	if lf := q.Get("lf"); lf != "" {
+		u.TCP.LF_ = strings.Split(lf, ",")
+	}
+	if rf := q.Get("rf"); rf != "" {
+		u.TCP.RF_ = strings.Split(rf, ",")
+	}
+
+	if _, err := validateAddr(u.Server, true); err != nil {
+		errors = append(errors, fmt.Errorf("server %v", err))
+	}
+	// Validate a defaulted copy so the URI keeps only what it carried.
+	t := u.Transport
+	if t.KCP != nil {
+		k := *t.KCP
+		t.KCP = &k
+	}
+	if t.QUIC != nil {
+		qc := *t.QUIC
+		t.QUIC = &qc
+	}
+	t.setDefaults("client")
+	errors = append(errors, t.validate()...)
+	if u.Carrier != "" && !slices.Contains(validCarriers, u.Carrier) {
+		errors = append(errors, fmt.Errorf("carrier must be one of: %v", validCarriers))
+	}
+	tcp := u.TCP
+	tcp.setDefaults()
+	errors = append(errors, tcp.validate()...)
+	if err := writeErr(errors); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,162 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	http     *http.Client
+	token    string
+	instance string
+}
+
+// Dial connects to the control API at listen, authenticating with token
+// when it is set.
+func Dial(listen, token string) (*Client, error) {
+	network, address, err := conf.ParseControlAddr(listen)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &Client{token: token, http: &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+	}}, nil
+}
+
+// Connect dials addr, or the control listener configured at paths when addr
+// is empty. token, which may be an env:NAME or file:path reference, overrides
+// the configured one.
+func Connect(addr, token string, paths ...string) (*Client, error) {
+	if token != "" {
+		t, err := conf.ReadSecret(token)
+		if err != nil {
+			return nil, err
+		}
+		token = t
+	}
+	if addr == "" {
+		cfg, err := conf.Load(paths...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if cfg.Control.Listen == "" {
+			return nil, fmt.Errorf("control API is not enabled in %s", strings.Join(paths, ", "))
+		}
+		addr = cfg.Control.Listen
+		if token == "" {
+			token = cfg.Control.Token
+		}
+	}
+	return Dial(addr, token)
+}
+
+// SetInstance directs connection commands at the named instance.
+func (c *Client) SetInstance(name string) {
+	c.instance = name
+}
+
+func (c *Client) Status() (*Status, error) {
+	var st Status
+	if err := c.do(http.MethodGet, "/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (c *Client) KillStream(id uint64) (string, error) {
+	return c.action(http.MethodDelete, fmt.Sprintf("/streams/%d", id), nil)
+}
+
+func (c *Client) CloseConn(id int) (string, error) {
+	return c.action(http.MethodDelete, fmt.Sprintf("/conns/%d", id), nil)
+}
+
+func (c *Client) DrainConn(id int, timeout time.Duration) (string, error) {
+	return c.action(http.MethodPost, fmt.Sprintf("/conns/%d/drain?timeout=%s", id, url.QueryEscape(timeout.String())), nil)
+}
+
+func (c *Client) Reconnect() (string, error) {
+	return c.action(http.MethodPost, "/reconnect", nil)
+}
+
+func (c *Client) SetLogLevel(level string) (string, error) {
+	return c.action(http.MethodPut, "/log/level", map[string]string{"level": level})
+}
+
+func (c *Client) Reload() (*Reload, error) {
+	var res Reload
+	if err := c.do(http.MethodPost, "/reload", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) action(method, path string, body any) (string, error) {
+	var res struct {
+		Result string `json:"result"`
+	}
+	if err := c.do(method, path, body, &res); err != nil {
+		return "", err
+	}
+	return res.Result, nil
+}
+
+func (c *Client) do(method, path string, body, v any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	if c.instance != "" {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		path += sep + "instance=" + url.QueryEscape(c.instance)
+	}
+	req, err := http.NewRequest(method, "http://localhost"+path, rd)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s", e.Error)
+		}
+		return fmt.Errorf("control API returned %s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,319 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var log = flog.New("control")
+
+// Instance is the running client or server the control API reports on.
+type Instance interface {
+	Conns() []Conn
+	UDPSessions() []UDPSession
+	CloseConn(id int) error
+	DrainConn(id int, timeout time.Duration) error
+	Reconnect() error
+}
+
+// Reload lists the configuration sections a reload applied in place and
+// those that only take effect after a restart.
+type Reload struct {
+	Applied []string `json:"applied"`
+	Restart []string `json:"restart"`
+}
+
+func (r *Reload) String() string {
+	if len(r.Applied) == 0 && len(r.Restart) == 0 {
+		return "configuration unchanged"
+	}
+	var parts []string
+	if len(r.Applied) > 0 {
+		parts = append(parts, "applied: "+strings.Join(r.Applied, ", "))
+	}
+	if len(r.Restart) > 0 {
+		parts = append(parts, "restart required: "+strings.Join(r.Restart, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+type Server struct {
+	insts   []instance
+	reload  func() (*Reload, error)
+	started time.Time
+	mux     *http.ServeMux
+}
+
+type instance struct {
+	name string
+	role string
+	Instance
+}
+
+func New() *Server {
+	s := &Server{started: time.Now(), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /status", s.handleStatus)
+	s.mux.HandleFunc("DELETE /streams/{id}", s.handleKillStream)
+	s.mux.HandleFunc("DELETE /conns/{id}", s.handleCloseConn)
+	s.mux.HandleFunc("POST /conns/{id}/drain", s.handleDrainConn)
+	s.mux.HandleFunc("POST /reconnect", s.handleReconnect)
+	s.mux.HandleFunc("PUT /log/level", s.handleLogLevel)
+	s.mux.HandleFunc("POST /reload", s.handleReload)
+	return s
+}
+
+// Add registers a running client or server. name is empty when the
+// configuration has no instances.
+func (s *Server) Add(name, role string, inst Instance) {
+	s.insts = append(s.insts, instance{name: name, role: role, Instance: inst})
+}
+
+// instance picks the target of a request from its instance parameter, which
+// may be left out while only one is running.
+func (s *Server) instance(r *http.Request) (Instance, error) {
+	name := r.URL.Query().Get("instance")
+	if name == "" && len(s.insts) == 1 {
+		return s.insts[0], nil
+	}
+	var names []string
+	for _, in := range s.insts {
+		if in.name == name {
+			return in, nil
+		}
+		names = append(names, in.name)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("several instances are running, choose one of: %s", strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("no instance named '%s'", name)
+}
+
+// SetReload enables POST /reload, which re-reads the configuration with fn.
+func (s *Server) SetReload(fn func() (*Reload, error)) {
+	s.reload = fn
+}
+
+func (s *Server) Serve(ctx context.Context, cfg *conf.Control) error {
+	network, address, err := conf.ParseControlAddr(cfg.Listen)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		// A stale socket from an unclean exit would make Listen fail. Anything
+		// else at the path is left alone.
+		if fi, err := os.Lstat(address); err == nil {
+			if fi.Mode()&os.ModeSocket == 0 {
+				return fmt.Errorf("%s exists and is not a socket", address)
+			}
+			os.Remove(address)
+		}
+	}
+	var l net.Listener
+	if network == "unix" {
+		l, err = listenUnix(address)
+	} else {
+		l, err = net.Listen(network, address)
+	}
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: guard(network, cfg.Token, s.mux), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Infof("control API listening on %s", cfg.Listen)
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// guard refuses requests a browser could have sent: pages may post to
+// loopback addresses, and with DNS rebinding read the answers too. Requests
+// carrying an Origin, naming a host that is not loopback, or lacking the token
+// are rejected.
+func guard(network, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests are not allowed"))
+			return
+		}
+		if network == "tcp" && !loopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host '%s' is not a loopback address", r.Host))
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid control token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func loopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := Status{
+		Started:  s.started,
+		LogLevel: strings.ToLower(flog.GetLevel().String()),
+		KCP:      newKCP(),
+		Inbounds: metrics.Inbounds(),
+		Streams:  metrics.Streams(),
+	}
+	if len(s.insts) == 1 && s.insts[0].name == "" {
+		st.Role = s.insts[0].role
+		st.Conns = s.insts[0].Conns()
+		st.UDP = s.insts[0].UDPSessions()
+	} else {
+		for _, in := range s.insts {
+			st.Instances = append(st.Instances, InstanceStatus{
+				Name:  in.name,
+				Role:  in.role,
+				Conns: in.Conns(),
+				UDP:   in.UDPSessions(),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleKillStream(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid stream id"))
+		return
+	}
+	if err := metrics.Kill(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	log.Infof("stream %d killed on control request", id)
+	writeResult(w, fmt.Sprintf("stream %d closed", id))
+}
+
+func (s *Server) handleCloseConn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid connection id"))
+		return
+	}
+	inst, err := s.instance(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := inst.CloseConn(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeResult(w, fmt.Sprintf("connection %d closed", id))
+}
+
+func (s *Server) handleDrainConn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid connection id"))
+		return
+	}
+	timeout := 5 * time.Minute
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		if timeout, err = time.ParseDuration(t); err != nil || timeout < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout '%s'", t))
+			return
+		}
+	}
+	inst, err := s.instance(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := inst.DrainConn(id, timeout); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeResult(w, fmt.Sprintf("connection %d draining", id))
+}
+
+func (s *Server) handleReconnect(w http.ResponseWriter, r *http.Request) {
+	inst, err := s.instance(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := inst.Reconnect(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeResult(w, "reconnecting all connections")
+}
+
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	level, err := flog.ParseLevel(req.Level)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flog.SetLevel(int(level))
+	log.Infof("log level set to %s on control request", req.Level)
+	writeResult(w, fmt.Sprintf("log level set to %s", req.Level))
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("reload is not supported"))
+		return
+	}
+	res, err := s.reload()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeResult(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusOK, map[string]string{"result": msg})
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,203 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fake records the commands forwarded to it.
+type fake struct {
+	conns     []Conn
+	closed    []int
+	drained   map[int]time.Duration
+	reconnect int
+}
+
+func (f *fake) Conns() []Conn             { return f.conns }
+func (f *fake) UDPSessions() []UDPSession { return nil }
+func (f *fake) Reconnect() error          { f.reconnect++; return nil }
+
+func (f *fake) CloseConn(id int) error {
+	for _, c := range f.conns {
+		if c.ID == id {
+			f.closed = append(f.closed, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("no connection %d", id)
+}
+
+func (f *fake) DrainConn(id int, timeout time.Duration) error {
+	if f.drained == nil {
+		f.drained = make(map[int]time.Duration)
+	}
+	f.drained[id] = timeout
+	return nil
+}
+
+// serve runs s on listen until the test ends and returns a client once the
+// API answers.
+func serve(t *testing.T, s *Server, listen, token string) *Client {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, &conf.Control{Listen: listen, Token: token}) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	c, err := Dial(listen, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := c.Status(); err == nil {
+			return c
+		} else if time.Now().After(deadline) {
+			t.Fatalf("control API not ready: %v", err)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not used on windows")
+	}
+	path := filepath.Join(t.TempDir(), "paqet.sock")
+	// A socket left behind by an unclean exit is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	f := &fake{conns: []Conn{{ID: 1, Remote: "192.0.2.1:9999", Streams: 2}}}
+	s := New()
+	s.Add("", "client", f)
+	c := serve(t, s, "unix:"+path, "")
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("socket mode = %o, want 600", mode)
+	}
+
+	st, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Role != "client" || len(st.Conns) != 1 || st.Conns[0].Streams != 2 {
+		t.Errorf("Status() = role %q, conns %+v", st.Role, st.Conns)
+	}
+	if _, err := c.CloseConn(1); err != nil {
+		t.Errorf("CloseConn(1): %v", err)
+	}
+	if _, err := c.CloseConn(7); err == nil {
+		t.Errorf("CloseConn(7) succeeded for an unknown connection")
+	}
+	if len(f.closed) != 1 || f.closed[0] != 1 {
+		t.Errorf("closed = %v, want [1]", f.closed)
+	}
+	if _, err := c.DrainConn(1, time.Minute); err != nil || f.drained[1] != time.Minute {
+		t.Errorf("DrainConn(1, 1m) = %v, drained %v", err, f.drained)
+	}
+	if _, err := c.Reconnect(); err != nil || f.reconnect != 1 {
+		t.Errorf("Reconnect() = %v, reconnects %d", err, f.reconnect)
+	}
+	if _, err := c.Reload(); err == nil {
+		t.Errorf("Reload() succeeded without a reload function")
+	}
+
+	defer flog.SetLevel(int(flog.GetLevel()))
+	if _, err := c.SetLogLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	if flog.GetLevel() != flog.Debug {
+		t.Errorf("log level = %s after SetLogLevel(debug)", flog.GetLevel())
+	}
+	if _, err := c.SetLogLevel("loud"); err == nil {
+		t.Errorf("SetLogLevel(loud) succeeded")
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestTCP(t *testing.T) {
+	a, b := &fake{}, &fake{conns: []Conn{{ID: 3}}}
+	s := New()
+	s.Add("a", "client", a)
+	s.Add("b", "server", b)
+	s.SetReload(func() (*Reload, error) { return &Reload{Applied: []string{"log"}}, nil })
+	addr := freeAddr(t)
+	c := serve(t, s, addr, "secret")
+
+	st, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Instances) != 2 || st.Instances[1].Name != "b" || len(st.Instances[1].Conns) != 1 {
+		t.Errorf("Status().Instances = %+v", st.Instances)
+	}
+	// Connection commands must name an instance when several run.
+	if _, err := c.CloseConn(3); err == nil {
+		t.Errorf("CloseConn without an instance succeeded")
+	}
+	c.SetInstance("b")
+	if _, err := c.CloseConn(3); err != nil || len(b.closed) != 1 {
+		t.Errorf("CloseConn(3) on b = %v, closed %v", err, b.closed)
+	}
+	if res, err := c.Reload(); err != nil || res.String() != "applied: log" {
+		t.Errorf("Reload() = %v, %v", res, err)
+	}
+
+	wrong, err := Dial(addr, "guess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Status(); err == nil {
+		t.Errorf("Status with a wrong token succeeded")
+	}
+
+	// Requests a browser could send are refused even with the token.
+	for _, tc := range []struct{ host, origin string }{
+		{addr, "http://evil.example"},
+		{"evil.example", ""},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/status", nil)
+		req.Host = tc.host
+		req.Header.Set("Authorization", "Bearer secret")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("host %q origin %q: status %d, want 403", tc.host, tc.origin, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package control
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates the socket with mode 0600 from the start; a chmod after
+// Listen would leave a window in which anyone could connect.
+func listenUnix(address string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", address)
+}
@@ -0,0 +1,97 @@
+package control
+
+import (
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/tnet"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// Status describes the process. Role, Conns and UDP are set when it runs a
+// single unnamed client or server; otherwise Instances lists each one.
+type Status struct {
+	Role      string                `json:"role,omitempty"`
+	Started   time.Time             `json:"started"`
+	LogLevel  string                `json:"log_level"`
+	Conns     []Conn                `json:"conns,omitempty"`
+	KCP       KCP                   `json:"kcp"`
+	Inbounds  []metrics.InboundInfo `json:"inbounds"`
+	Streams   []metrics.StreamInfo  `json:"streams"`
+	UDP       []UDPSession          `json:"udp_sessions,omitempty"`
+	Instances []InstanceStatus      `json:"instances,omitempty"`
+}
+
+type InstanceStatus struct {
+	Name  string       `json:"name"`
+	Role  string       `json:"role"`
+	Conns []Conn       `json:"conns"`
+	UDP   []UDPSession `json:"udp_sessions"`
+}
+
+type Conn struct {
+	ID         int     `json:"id"`
+	Local      string  `json:"local"`
+	Remote     string  `json:"remote"`
+	RTT        float64 `json:"rtt_ms"`
+	RTTVar     float64 `json:"rttvar_ms"`
+	RTO        float64 `json:"rto_ms"`
+	SendWindow int     `json:"send_window"`
+	RecvWindow int     `json:"recv_window"`
+	Streams    int     `json:"streams"`
+	Draining   bool    `json:"draining,omitempty"`
+}
+
+// KCP holds the process-wide counters; kcp-go does not keep them per session.
+type KCP struct {
+	Retransmits     uint64 `json:"retransmits"`
+	FastRetransmits uint64 `json:"fast_retransmits"`
+	LostSegments    uint64 `json:"lost_segments"`
+	FECRecovered    uint64 `json:"fec_recovered"`
+	InSegments      uint64 `json:"in_segments"`
+	OutSegments     uint64 `json:"out_segments"`
+}
+
+type UDPSession struct {
+	Key     uint64    `json:"key"`
+	SID     int       `json:"sid"`
+	Source  string    `json:"source"`
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+}
+
+func NewConn(id int, c tnet.Conn) Conn {
+	st := c.Stats()
+	conn := Conn{
+		ID:         id,
+		RTT:        ms(st.RTT),
+		RTTVar:     ms(st.RTTVar),
+		RTO:        ms(st.RTO),
+		SendWindow: st.SendWindow,
+		RecvWindow: st.RecvWindow,
+		Streams:    st.Streams,
+	}
+	if a := c.LocalAddr(); a != nil {
+		conn.Local = a.String()
+	}
+	if a := c.RemoteAddr(); a != nil {
+		conn.Remote = a.String()
+	}
+	return conn
+}
+
+func newKCP() KCP {
+	s := kcp.DefaultSnmp.Copy()
+	return KCP{
+		Retransmits:     s.RetransSegs,
+		FastRetransmits: s.FastRetransSegs,
+		LostSegments:    s.LostSegs,
+		FECRecovered:    s.FECRecovered,
+		InSegments:      s.InSegs,
+		OutSegments:     s.OutSegs,
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -2,7 +2,11 @@ package flog
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,49 +21,156 @@ const (
 	Fatal
 )
 
+type entry struct {
+	time   time.Time
+	level  Level
+	sub    string
+	msg    string
+	fields []any
+}
+
 var (
-	minLevel = Info
-	logCh    = make(chan string, 1024)
+	minLevel   atomic.Int32
+	levels     atomic.Pointer[map[string]Level]
+	jsonFormat atomic.Bool
+	dropped    atomic.Uint64
+	logCh      = make(chan entry, 1024)
+
+	out   io.Writer = os.Stdout
+	outMu sync.Mutex
 )
 
-func init() {
+// subsystems names every logger New may create. It is fixed so that
+// configuration naming a subsystem is checked the same way whichever
+// packages the program links.
+var subsystems = []string{"client", "control", "forward", "kcp", "metrics", "quic", "resolver", "server", "socks"}
 
+func init() {
+	minLevel.Store(int32(Info))
+	go write()
 }
 
+// SetLevel may be called again at runtime.
 func SetLevel(l int) {
-	minLevel = Level(l)
-	if l != -1 {
-		go func() {
-			for msg := range logCh {
-				fmt.Fprint(os.Stdout, msg)
+	minLevel.Store(int32(l))
+}
+
+func GetLevel() Level {
+	return Level(minLevel.Load())
+}
+
+// SetLevels overrides the level of individual subsystems; the rest follow SetLevel.
+func SetLevels(m map[string]int) {
+	lv := make(map[string]Level, len(m))
+	for sub, l := range m {
+		lv[sub] = Level(l)
+	}
+	levels.Store(&lv)
+}
+
+func SetJSON(on bool) {
+	jsonFormat.Store(on)
+}
+
+// SetOutput replaces where lines are written, closing the previous output
+// unless it is stdout or stderr.
+func SetOutput(w io.Writer) {
+	outMu.Lock()
+	prev := out
+	out = w
+	outMu.Unlock()
+	if c, ok := prev.(io.Closer); ok && prev != os.Stdout && prev != os.Stderr && prev != w {
+		c.Close()
+	}
+}
+
+// Dropped reports how many lines were discarded because the writer fell behind.
+func Dropped() uint64 {
+	return dropped.Load()
+}
+
+// Subsystems lists the names New accepts, for validating per-subsystem levels.
+func Subsystems() []string {
+	return slices.Clone(subsystems)
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "none":
+		return None, nil
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn":
+		return Warn, nil
+	case "error":
+		return Error, nil
+	case "fatal":
+		return Fatal, nil
+	}
+	return None, fmt.Errorf("invalid logging level '%s': must be one of none, debug, info, warn, error, fatal", s)
+}
+
+func enabled(sub string, level Level) bool {
+	min := GetLevel()
+	if sub != "" {
+		if m := levels.Load(); m != nil {
+			if l, ok := (*m)[sub]; ok {
+				min = l
 			}
-		}()
+		}
 	}
+	return min != None && level >= min
 }
 
-func logf(level Level, format string, args ...any) {
-	if level < minLevel || minLevel == None {
+func logf(sub string, fields []any, level Level, format string, args ...any) {
+	if !enabled(sub, level) {
 		return
 	}
 
 	for _, arg := range args {
-		if err, ok := arg.(error); ok {
-			err = WErr(err)
-			if err == nil {
-				return
-			}
+		if err, ok := arg.(error); ok && err != nil && WErr(err) == nil {
+			// Expected errors such as EOF or a closed connection are only
+			// worth seeing when debugging.
+			level = Debug
 		}
 	}
+	if level == Debug && !enabled(sub, level) {
+		return
+	}
 
-	now := time.Now().Format("2006-01-02 15:04:05.000")
-	line := fmt.Sprintf("%s [%s] %s\n", now, level.String(), fmt.Sprintf(format, args...))
-
+	e := entry{time: time.Now(), level: level, sub: sub, msg: fmt.Sprintf(format, args...), fields: fields}
 	select {
-	case logCh <- line:
+	case logCh <- e:
 	default:
+		dropped.Add(1)
 	}
 }
 
+func write() {
+	var reported uint64
+	for e := range logCh {
+		if n := dropped.Load(); n > reported {
+			writeEntry(entry{time: time.Now(), level: Warn, msg: "log output fell behind, lines dropped", fields: []any{"dropped", n - reported}})
+			reported = n
+		}
+		writeEntry(e)
+	}
+}
+
+func writeEntry(e entry) {
+	var line []byte
+	if jsonFormat.Load() {
+		line = formatJSON(e)
+	} else {
+		line = formatText(e)
+	}
+	outMu.Lock()
+	out.Write(line)
+	outMu.Unlock()
+}
+
 func (l Level) String() string {
 	switch l {
 	case Debug:
@@ -79,12 +190,16 @@ func (l Level) String() string {
 	}
 }
 
-func Debugf(format string, args ...any) { logf(Debug, format, args...) }
-func Infof(format string, args ...any)  { logf(Info, format, args...) }
-func Warnf(format string, args ...any)  { logf(Warn, format, args...) }
-func Errorf(format string, args ...any) { logf(Error, format, args...) }
+func Debugf(format string, args ...any) { logf("", nil, Debug, format, args...) }
+func Infof(format string, args ...any)  { logf("", nil, Info, format, args...) }
+func Warnf(format string, args ...any)  { logf("", nil, Warn, format, args...) }
+func Errorf(format string, args ...any) { logf("", nil, Error, format, args...) }
 func Fatalf(format string, args ...any) {
-	logf(Fatal, format, args...)
+	logf("", nil, Fatal, format, args...)
+	exit()
+}
+
+func exit() {
 	// flush logs (optional: small sleep to let goroutine write)
 	time.Sleep(10 * time.Millisecond)
 	os.Exit(1)
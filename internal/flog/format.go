@@ -0,0 +1,84 @@
+package flog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func formatText(e entry) []byte {
+	var b strings.Builder
+	b.WriteString(e.time.Format("2006-01-02 15:04:05.000"))
+	b.WriteString(" [")
+	b.WriteString(e.level.String())
+	b.WriteString("] ")
+	if e.sub != "" {
+		b.WriteString(e.sub)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.msg)
+	for i := 0; i < len(e.fields); i += 2 {
+		key, val := field(e.fields, i)
+		s := fmt.Sprint(val)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(s)
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+func formatJSON(e entry) []byte {
+	b := []byte(`{"time":`)
+	b = appendJSON(b, e.time.Format(time.RFC3339Nano))
+	b = append(b, `,"level":`...)
+	b = appendJSON(b, strings.ToLower(e.level.String()))
+	if e.sub != "" {
+		b = append(b, `,"subsystem":`...)
+		b = appendJSON(b, e.sub)
+	}
+	b = append(b, `,"msg":`...)
+	b = appendJSON(b, e.msg)
+	for i := 0; i < len(e.fields); i += 2 {
+		key, val := field(e.fields, i)
+		b = append(b, ',')
+		b = appendJSON(b, key)
+		b = append(b, ':')
+		b = appendJSON(b, val)
+	}
+	return append(b, "}\n"...)
+}
+
+// field returns the i-th key/value pair, tolerating a missing value or a
+// non-string key the way log/slog does.
+func field(fields []any, i int) (string, any) {
+	if i+1 >= len(fields) {
+		return "!BADKEY", fields[i]
+	}
+	key, ok := fields[i].(string)
+	if !ok {
+		key = fmt.Sprint(fields[i])
+	}
+	val := fields[i+1]
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+	case fmt.Stringer:
+		val = v.String()
+	}
+	return key, val
+}
+
+func appendJSON(b []byte, v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return append(b, data...)
+}
@@ -0,0 +1,34 @@
+package flog
+
+import "slices"
+
+// Logger tags lines with a subsystem, whose level can be set on its own,
+// and with key/value fields such as the stream id or addresses.
+type Logger struct {
+	sub    string
+	fields []any
+}
+
+func New(subsystem string) *Logger {
+	if !slices.Contains(subsystems, subsystem) {
+		panic("flog: unknown subsystem " + subsystem)
+	}
+	return &Logger{sub: subsystem}
+}
+
+// With returns a logger that adds the key/value pairs kv to every line.
+func (l *Logger) With(kv ...any) *Logger {
+	fields := make([]any, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{sub: l.sub, fields: fields}
+}
+
+func (l *Logger) Debugf(format string, args ...any) { logf(l.sub, l.fields, Debug, format, args...) }
+func (l *Logger) Infof(format string, args ...any)  { logf(l.sub, l.fields, Info, format, args...) }
+func (l *Logger) Warnf(format string, args ...any)  { logf(l.sub, l.fields, Warn, format, args...) }
+func (l *Logger) Errorf(format string, args ...any) { logf(l.sub, l.fields, Error, format, args...) }
+func (l *Logger) Fatalf(format string, args ...any) {
+	logf(l.sub, l.fields, Fatal, format, args...)
+	exit()
+}
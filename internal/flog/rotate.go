@@ -0,0 +1,152 @@
+package flog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is a log file that is rotated once it grows past maxSize bytes or
+// has been written to for longer than maxAge. Rotated files get a timestamp
+// suffix and only the newest maxBackups are kept. Zero disables each limit.
+type File struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	failed time.Time
+	closed bool
+}
+
+const (
+	backupFormat = "20060102-150405.000"
+	// rotateRetry spaces out attempts after a rotation failed, during which
+	// the current file keeps growing.
+	rotateRetry = time.Minute
+)
+
+func OpenFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	lf := &File{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = info.Size()
+	lf.opened = time.Now()
+	return nil
+}
+
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.closed {
+		return 0, os.ErrClosed
+	}
+	if lf.f == nil {
+		// A failed rotation could not reopen the file either; try again now
+		// and then.
+		if time.Since(lf.failed) < rotateRetry {
+			return 0, os.ErrClosed
+		}
+		if err := lf.open(); err != nil {
+			lf.failed = time.Now()
+			return 0, err
+		}
+	}
+	if lf.size > 0 && time.Since(lf.failed) >= rotateRetry &&
+		(lf.maxSize > 0 && lf.size+int64(len(p)) > lf.maxSize ||
+			lf.maxAge > 0 && time.Since(lf.opened) >= lf.maxAge) {
+		if err := lf.rotate(); err != nil {
+			lf.failed = time.Now()
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %v\n", lf.path, err)
+			if lf.f == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+func (lf *File) rotate() error {
+	lf.f.Close()
+	lf.f = nil
+	backup := lf.path + "." + time.Now().Format(backupFormat)
+	if err := os.Rename(lf.path, backup); err != nil {
+		// Keep writing to the current file rather than losing every line.
+		if oerr := lf.open(); oerr != nil {
+			return errors.Join(err, oerr)
+		}
+		return err
+	}
+	if err := lf.open(); err != nil {
+		return err
+	}
+	if lf.maxBackups > 0 {
+		// The timestamp suffix sorts oldest first.
+		backups := lf.backups()
+		slices.Sort(backups)
+		for len(backups) > lf.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return nil
+}
+
+// backups lists the rotated copies of this file, leaving out other files
+// that merely share its name as a prefix.
+func (lf *File) backups() []string {
+	dir, name := filepath.Split(lf.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var backups []string
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), name+".")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		if _, err := time.Parse(backupFormat, suffix); err == nil {
+			backups = append(backups, filepath.Join(dir, e.Name()))
+		}
+	}
+	return backups
+}
+
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	lf.closed = true
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
@@ -3,16 +3,24 @@ package forward
 import (
 	"context"
 	"fmt"
-	"paqet/internal/client"
-	"paqet/internal/flog"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"net"
 	"sync"
 )
 
+var log = flog.New("forward")
+
 type Forward struct {
 	client     *client.Client
 	listenAddr string
 	targetAddr string
+	service    string
+	inbound    *metrics.Inbound
+	udp        sync.Map // session key -> *metrics.Stream
 	wg         sync.WaitGroup
+	done       chan struct{}
 }
 
 func New(client *client.Client, listenAddr, targetAddr string) (*Forward, error) {
@@ -20,34 +28,64 @@ func New(client *client.Client, listenAddr, targetAddr string) (*Forward, error)
 		client:     client,
 		listenAddr: listenAddr,
 		targetAddr: targetAddr,
+		inbound:    metrics.NewInbound("forward/" + listenAddr),
+		done:       make(chan struct{}),
 	}, nil
 }
 
+// NewService forwards TCP connections to the named service on the server
+// instead of to an address.
+func NewService(client *client.Client, listenAddr, service string) (*Forward, error) {
+	f, err := New(client, listenAddr, "service:"+service)
+	if err != nil {
+		return nil, err
+	}
+	f.service = service
+	return f, nil
+}
+
 func (f *Forward) Start(ctx context.Context, protocol string) error {
-	flog.Debugf("starting %s forwarder: %s -> %s", protocol, f.listenAddr, f.targetAddr)
+	log.Debugf("starting %s forwarder: %s -> %s", protocol, f.listenAddr, f.targetAddr)
 	switch protocol {
 	case "tcp":
 		return f.startTCP(ctx)
 	case "udp":
 		return f.startUDP(ctx)
 	default:
-		flog.Errorf("unsupported protocol: %s", protocol)
+		log.Errorf("unsupported protocol: %s", protocol)
 		return fmt.Errorf("unsupported protocol: %s", protocol)
 	}
 }
 
 func (f *Forward) startTCP(ctx context.Context) error {
+	listener, err := net.Listen("tcp", f.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to bind TCP socket on %s: %w", f.listenAddr, err)
+	}
 	f.wg.Go(func() {
-		if err := f.listenTCP(ctx); err != nil {
-			flog.Debugf("TCP forwarder stopped with: %v", err)
-		}
+		defer close(f.done)
+		f.listenTCP(ctx, listener)
 	})
 	return nil
 }
 
 func (f *Forward) startUDP(ctx context.Context) error {
+	laddr, err := net.ResolveUDPAddr("udp", f.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve UDP listen address '%s': %w", f.listenAddr, err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return fmt.Errorf("failed to bind UDP socket on %s: %w", laddr, err)
+	}
 	f.wg.Go(func() {
-		f.listenUDP(ctx)
+		defer close(f.done)
+		f.listenUDP(ctx, conn)
 	})
 	return nil
 }
+
+// Wait blocks until the listener has been closed after ctx is cancelled.
+func (f *Forward) Wait() {
+	<-f.done
+}
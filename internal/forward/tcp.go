@@ -2,32 +2,27 @@ package forward
 
 import (
 	"context"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/tnet"
 	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
 )
 
-func (f *Forward) listenTCP(ctx context.Context) error {
-	listener, err := net.Listen("tcp", f.listenAddr)
-	if err != nil {
-		flog.Errorf("failed to bind TCP socket on %s: %v", f.listenAddr, err)
-		return err
-	}
+func (f *Forward) listenTCP(ctx context.Context, listener net.Listener) {
 	defer listener.Close()
 	go func() {
 		<-ctx.Done()
 		listener.Close()
 	}()
-	flog.Infof("TCP forwarder listening on %s -> %s", f.listenAddr, f.targetAddr)
+	log.Infof("TCP forwarder listening on %s -> %s", f.listenAddr, f.targetAddr)
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-ctx.Done():
-				return nil
+				return
 			default:
-				flog.Errorf("failed to accept TCP connection on %s: %v", f.listenAddr, err)
+				log.Errorf("failed to accept TCP connection on %s: %v", f.listenAddr, err)
 				continue
 			}
 		}
@@ -35,44 +30,57 @@ func (f *Forward) listenTCP(ctx context.Context) error {
 		f.wg.Go(func() {
 			defer conn.Close()
 			if err := f.handleTCPConn(ctx, conn); err != nil {
-				flog.Errorf("TCP connection %s -> %s closed with error: %v", conn.RemoteAddr(), f.targetAddr, err)
+				log.Errorf("TCP connection %s -> %s closed with error: %v", conn.RemoteAddr(), f.targetAddr, err)
 			} else {
-				flog.Debugf("TCP connection %s -> %s closed", conn.RemoteAddr(), f.targetAddr)
+				log.Debugf("TCP connection %s -> %s closed", conn.RemoteAddr(), f.targetAddr)
 			}
 		})
 	}
 }
 
 func (f *Forward) handleTCPConn(ctx context.Context, conn net.Conn) error {
-	strm, err := f.client.TCP(f.targetAddr)
+	strm, err := f.open(ctx)
 	if err != nil {
-		flog.Errorf("failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), f.targetAddr, err)
+		log.Errorf("failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), f.targetAddr, err)
+		f.inbound.Fail()
 		return err
 	}
+	ms := f.inbound.Open("tcp", conn.RemoteAddr().String(), f.targetAddr, strm.SID(), strm)
+	defer ms.Close()
+	log := log.With("stream", ms.ID, "sid", strm.SID(), "src", conn.RemoteAddr(), "dst", f.targetAddr)
 	defer func() {
-		flog.Debugf("TCP stream closed for %s -> %s", conn.RemoteAddr(), f.targetAddr)
+		log.Debugf("TCP stream closed")
 		defer strm.Close()
 	}()
-	flog.Infof("accepted TCP connection %s -> %s", conn.RemoteAddr(), f.targetAddr)
+	log.Infof("accepted TCP connection %s -> %s", conn.RemoteAddr(), f.targetAddr)
 
 	errCh := make(chan error, 2)
 	go func() {
-		err := buffer.CopyT(conn, strm)
+		err := buffer.CopyT(conn, ms.Down(strm))
 		errCh <- err
 	}()
 	go func() {
-		err := buffer.CopyT(strm, conn)
+		err := buffer.CopyT(strm, ms.Up(conn))
 		errCh <- err
 	}()
 
 	select {
 	case err := <-errCh:
+		ms.End(err)
 		if err != nil {
-			flog.Errorf("TCP stream %d failed for %s -> %s: %v", strm.SID(), conn.RemoteAddr(), f.targetAddr, err)
+			log.Errorf("TCP stream failed: %v", err)
 			return err
 		}
 	case <-ctx.Done():
+		ms.End(ctx.Err())
 	}
 
 	return nil
 }
+
+func (f *Forward) open(ctx context.Context) (tnet.Strm, error) {
+	if f.service != "" {
+		return f.client.Service(ctx, f.service)
+	}
+	return f.client.TCP(ctx, f.targetAddr)
+}
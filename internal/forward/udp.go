@@ -2,33 +2,22 @@ package forward
 
 import (
 	"context"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/tnet"
 	"io"
 	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
-	"paqet/internal/tnet"
 	"time"
 )
 
-func (f *Forward) listenUDP(ctx context.Context) {
-	laddr, err := net.ResolveUDPAddr("udp", f.listenAddr)
-	if err != nil {
-		flog.Errorf("failed to resolve UDP listen address '%s': %v", f.listenAddr, err)
-		return
-	}
-
-	conn, err := net.ListenUDP("udp", laddr)
-	if err != nil {
-		flog.Errorf("failed to bind UDP socket on %s: %v", laddr, err)
-		return
-	}
+func (f *Forward) listenUDP(ctx context.Context, conn *net.UDPConn) {
 	defer conn.Close()
 	go func() {
 		<-ctx.Done()
 		conn.Close()
 	}()
 
-	flog.Infof("UDP forwarder listening on %s -> %s", laddr, f.targetAddr)
+	log.Infof("UDP forwarder listening on %s -> %s", conn.LocalAddr(), f.targetAddr)
 
 	for {
 		select {
@@ -38,7 +27,7 @@ func (f *Forward) listenUDP(ctx context.Context) {
 		}
 
 		if err := f.handleUDPPacket(ctx, conn); err != nil {
-			flog.Errorf("UDP packet handling failed on %s: %v", f.listenAddr, err)
+			log.Errorf("UDP packet handling failed on %s: %v", f.listenAddr, err)
 		}
 	}
 }
@@ -56,52 +45,73 @@ func (f *Forward) handleUDPPacket(ctx context.Context, conn *net.UDPConn) error
 		return nil
 	}
 
-	strm, new, k, err := f.client.UDP(caddr.String(), f.targetAddr)
+	strm, new, k, err := f.client.UDP(ctx, caddr.String(), f.targetAddr)
 	if err != nil {
-		flog.Errorf("failed to establish UDP stream for %s -> %s: %v", caddr, f.targetAddr, err)
+		log.Errorf("failed to establish UDP stream for %s -> %s: %v", caddr, f.targetAddr, err)
+		f.inbound.Fail()
 		f.client.CloseUDP(k)
 		return err
 	}
+	if new {
+		f.udp.Store(k, f.inbound.Open("udp", caddr.String(), f.targetAddr, strm.SID(), strm))
+	}
 
 	if _, err := strm.Write(buf[:n]); err != nil {
-		flog.Errorf("failed to forward %d bytes from %s -> %s: %v", n, caddr, f.targetAddr, err)
-		f.client.CloseUDP(k)
+		log.Errorf("failed to forward %d bytes from %s -> %s: %v", n, caddr, f.targetAddr, err)
+		f.closeUDP(k, err)
 		return err
 	}
+	ms, ok := f.udp.Load(k)
+	if !ok {
+		return nil
+	}
+	ms.(*metrics.Stream).AddUp(n)
 	if new {
-		flog.Infof("accepted UDP connection %d for %s -> %s", strm.SID(), caddr, f.targetAddr)
-		go f.handleUDPStrm(ctx, k, strm, conn, caddr)
+		log.Infof("accepted UDP connection %d for %s -> %s", strm.SID(), caddr, f.targetAddr)
+		go f.handleUDPStrm(ctx, k, ms.(*metrics.Stream), strm, conn, caddr)
 	}
 
 	return nil
 }
 
-func (f *Forward) handleUDPStrm(ctx context.Context, k uint64, strm tnet.Strm, conn *net.UDPConn, caddr *net.UDPAddr) {
+func (f *Forward) handleUDPStrm(ctx context.Context, k uint64, ms *metrics.Stream, strm tnet.Strm, conn *net.UDPConn, caddr *net.UDPAddr) {
 	bufp := buffer.UPool.Get().(*[]byte)
+	var err error
 	defer func() {
 		buffer.UPool.Put(bufp)
-		flog.Debugf("UDP stream %d closed for %s -> %s", strm.SID(), caddr, f.targetAddr)
-		f.client.CloseUDP(k)
+		log.Debugf("UDP stream %d closed for %s -> %s", strm.SID(), caddr, f.targetAddr)
+		f.closeUDP(k, err)
 	}()
 	buf := *bufp
+	r := ms.Down(strm)
 
 	for {
 		select {
 		case <-ctx.Done():
+			err = ctx.Err()
 			return
 		default:
 		}
 		strm.SetDeadline(time.Now().Add(8 * time.Second))
-		err := CopyU(strm, conn, caddr, buf)
+		err = CopyU(r, conn, caddr, buf)
 		strm.SetDeadline(time.Time{})
 		if err != nil {
-			flog.Errorf("UDP stream %d failed for %s -> %s: %v", strm.SID(), caddr, f.targetAddr, err)
+			log.Errorf("UDP stream %d failed for %s -> %s: %v", strm.SID(), caddr, f.targetAddr, err)
 			return
 		}
 	}
 }
 
-func CopyU(dst io.ReadWriter, src *net.UDPConn, addr *net.UDPAddr, buf []byte) error {
+// closeUDP ends the session, recording err as the reason it stopped.
+func (f *Forward) closeUDP(k uint64, err error) {
+	f.client.CloseUDP(k)
+	if ms, ok := f.udp.LoadAndDelete(k); ok {
+		ms.(*metrics.Stream).End(err)
+		ms.(*metrics.Stream).Close()
+	}
+}
+
+func CopyU(dst io.Reader, src *net.UDPConn, addr *net.UDPAddr, buf []byte) error {
 	n, err := dst.Read(buf)
 	if err != nil {
 		return err
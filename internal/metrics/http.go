@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/starco76/paqet/internal/flog"
+	"net"
+	"net/http"
+	"time"
+)
+
+var log = flog.New("metrics")
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// Serve exposes the metrics on addr under path until ctx is done.
+func Serve(ctx context.Context, addr, path string) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Infof("metrics listening on http://%s%s", l.Addr(), path)
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
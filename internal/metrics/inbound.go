@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Inbound caches the per-inbound values so hot paths avoid label lookups.
+type Inbound struct {
+	name   string
+	opened *Value
+	active *Value
+	errors *Value
+	up     *Value
+	down   *Value
+}
+
+type InboundInfo struct {
+	Name   string `json:"name"`
+	Opened int64  `json:"opened"`
+	Active int64  `json:"active"`
+	Errors int64  `json:"errors"`
+	Up     int64  `json:"up"`
+	Down   int64  `json:"down"`
+}
+
+var (
+	inbounds  = make(map[string]*Inbound)
+	inboundMu sync.Mutex
+)
+
+// NewInbound returns the counters for name, shared by every caller using the same name.
+func NewInbound(name string) *Inbound {
+	inboundMu.Lock()
+	defer inboundMu.Unlock()
+	if in, ok := inbounds[name]; ok {
+		return in
+	}
+	in := &Inbound{
+		name:   name,
+		opened: StreamsOpened.With(name),
+		active: StreamsActive.With(name),
+		errors: StreamErrors.With(name),
+		up:     Bytes.With(name, "up"),
+		down:   Bytes.With(name, "down"),
+	}
+	inbounds[name] = in
+	return in
+}
+
+func (in *Inbound) Fail() { in.errors.Inc() }
+
+func Inbounds() []InboundInfo {
+	inboundMu.Lock()
+	list := make([]InboundInfo, 0, len(inbounds))
+	for _, in := range inbounds {
+		list = append(list, InboundInfo{
+			Name:   in.name,
+			Opened: in.opened.Load(),
+			Active: in.active.Load(),
+			Errors: in.errors.Load(),
+			Up:     in.up.Load(),
+			Down:   in.down.Load(),
+		})
+	}
+	inboundMu.Unlock()
+	slices.SortFunc(list, func(a, b InboundInfo) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/xtaci/kcp-go/v5"
+)
+
+var (
+	kcpSessions      = NewGauge("paqet_kcp_sessions", "KCP sessions currently established.")
+	kcpBytes         = NewCounter("paqet_kcp_bytes_total", "Bytes passed between KCP and the upper layer.", "direction")
+	kcpSegments      = NewCounter("paqet_kcp_segments_total", "KCP segments handled.", "direction")
+	kcpRetrans       = NewCounter("paqet_kcp_retransmits_total", "Retransmitted KCP segments, by trigger; 'all' includes fast and early.", "type")
+	kcpLost          = NewCounter("paqet_kcp_lost_segments_total", "KCP segments inferred as lost.")
+	kcpRepeat        = NewCounter("paqet_kcp_repeat_segments_total", "Duplicate KCP segments received.")
+	kcpErrors        = NewCounter("paqet_kcp_errors_total", "KCP input errors, by cause.", "cause")
+	kcpFECRecovered  = NewCounter("paqet_kcp_fec_recovered_total", "Packets recovered by FEC.")
+	kcpFECErrors     = NewCounter("paqet_kcp_fec_errors_total", "Incorrect packets recovered by FEC.")
+	kcpFECParity     = NewCounter("paqet_kcp_fec_parity_shards_total", "FEC parity shards received.")
+	kcpSndQueue      = NewGauge("paqet_kcp_send_queue", "Segments waiting in KCP send queues.")
+	kcpRcvQueue      = NewGauge("paqet_kcp_receive_queue", "Segments waiting in KCP receive queues.")
+	kcpSndBuffer     = NewGauge("paqet_kcp_send_buffer", "Segments in flight in KCP send buffers.")
+	kcpSessionsTotal = NewCounter("paqet_kcp_sessions_total", "KCP sessions opened, by side.", "side")
+)
+
+func init() {
+	OnCollect(collectKCP)
+}
+
+func collectKCP() {
+	s := kcp.DefaultSnmp.Copy()
+	kcpSessions.With().Set(int64(s.CurrEstab))
+	kcpSessionsTotal.With("active").Set(int64(s.ActiveOpens))
+	kcpSessionsTotal.With("passive").Set(int64(s.PassiveOpens))
+	kcpBytes.With("sent").Set(int64(s.BytesSent))
+	kcpBytes.With("received").Set(int64(s.BytesReceived))
+	kcpSegments.With("in").Set(int64(s.InSegs))
+	kcpSegments.With("out").Set(int64(s.OutSegs))
+	kcpRetrans.With("all").Set(int64(s.RetransSegs))
+	kcpRetrans.With("fast").Set(int64(s.FastRetransSegs))
+	kcpRetrans.With("early").Set(int64(s.EarlyRetransSegs))
+	kcpLost.With().Set(int64(s.LostSegs))
+	kcpRepeat.With().Set(int64(s.RepeatSegs))
+	kcpErrors.With("read").Set(int64(s.InErrs))
+	kcpErrors.With("checksum").Set(int64(s.InCsumErrors))
+	kcpErrors.With("input").Set(int64(s.KCPInErrors))
+	kcpFECRecovered.With().Set(int64(s.FECRecovered))
+	kcpFECErrors.With().Set(int64(s.FECErrs))
+	kcpFECParity.With().Set(int64(s.FECParityShards))
+	kcpSndQueue.With().Set(int64(s.RingBufferSndQueue))
+	kcpRcvQueue.With().Set(int64(s.RingBufferRcvQueue))
+	kcpSndBuffer.With().Set(int64(s.RingBufferSndBuffer))
+}
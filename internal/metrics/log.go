@@ -0,0 +1,11 @@
+package metrics
+
+import "github.com/starco76/paqet/internal/flog"
+
+var logDropped = NewCounter("paqet_log_dropped_total", "Log lines dropped because the log output could not keep up.")
+
+func init() {
+	OnCollect(func() {
+		logDropped.With().Set(int64(flog.Dropped()))
+	})
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	StreamsOpened = NewCounter("paqet_streams_opened_total", "Streams opened through the tunnel.", "inbound")
+	StreamsActive = NewGauge("paqet_streams_active", "Streams currently open.", "inbound")
+	StreamErrors  = NewCounter("paqet_stream_errors_total", "Streams that failed to establish.", "inbound")
+	Bytes         = NewCounter("paqet_bytes_total", "Payload bytes relayed, by direction relative to the client.", "inbound", "direction")
+
+	Connections = NewGauge("paqet_connections", "Transport connections currently established.")
+	Reconnects  = NewCounter("paqet_reconnects_total", "Transport connections re-established after loss.", "conn")
+	UDPSessions = NewGauge("paqet_udp_sessions", "UDP sessions currently mapped to streams.")
+
+	Packets      = NewCounter("paqet_packets_total", "Packets handled by the raw socket.", "conn", "direction")
+	PacketBytes  = NewCounter("paqet_packet_bytes_total", "Bytes handled by the raw socket.", "conn", "direction")
+	PacketErrors = NewCounter("paqet_packet_errors_total", "Raw socket read and write errors.", "conn", "direction")
+	PcapDropped  = NewCounter("paqet_pcap_dropped_total", "Packets dropped by pcap, by where the drop happened.", "conn", "where")
+)
+
+type Value struct {
+	v atomic.Int64
+}
+
+func (v *Value) Add(n int64) { v.v.Add(n) }
+func (v *Value) Inc()        { v.v.Add(1) }
+func (v *Value) Dec()        { v.v.Add(-1) }
+func (v *Value) Set(n int64) { v.v.Store(n) }
+func (v *Value) Load() int64 { return v.v.Load() }
+
+type Vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]*Value
+	keys   map[string][]string
+	mu     sync.RWMutex
+}
+
+var (
+	families []*Vec
+	hooks    []func()
+	regMu    sync.Mutex
+)
+
+func newVec(kind, name, help string, labels []string) *Vec {
+	v := &Vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]*Value),
+		keys:   make(map[string][]string),
+	}
+	regMu.Lock()
+	families = append(families, v)
+	regMu.Unlock()
+	return v
+}
+
+func NewCounter(name, help string, labels ...string) *Vec {
+	return newVec("counter", name, help, labels)
+}
+
+func NewGauge(name, help string, labels ...string) *Vec {
+	return newVec("gauge", name, help, labels)
+}
+
+// With returns the value for the given label values, creating it on first use.
+func (v *Vec) With(values ...string) *Value {
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	val, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return val
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if val, ok := v.values[key]; ok {
+		return val
+	}
+	val = &Value{}
+	v.values[key] = val
+	v.keys[key] = slices.Clone(values)
+	return val
+}
+
+func (v *Vec) Delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	delete(v.values, key)
+	delete(v.keys, key)
+	v.mu.Unlock()
+}
+
+// OnCollect registers fn to run before every scrape, for sources that are
+// sampled rather than counted as they happen.
+func OnCollect(fn func()) {
+	regMu.Lock()
+	hooks = append(hooks, fn)
+	regMu.Unlock()
+}
+
+// Write renders all metrics in the Prometheus text exposition format.
+func Write(w io.Writer) error {
+	regMu.Lock()
+	fns := slices.Clone(hooks)
+	fams := slices.Clone(families)
+	regMu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+
+	for _, v := range fams {
+		if err := v.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Vec) write(w io.Writer) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if len(v.values) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		var b strings.Builder
+		b.WriteString(v.name)
+		if len(v.labels) > 0 {
+			b.WriteByte('{')
+			for i, l := range v.labels {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				var lv string
+				if i < len(v.keys[k]) {
+					lv = v.keys[k][i]
+				}
+				fmt.Fprintf(&b, "%s=\"%s\"", l, escape(lv))
+			}
+			b.WriteByte('}')
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", b.String(), v.values[k].Load()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
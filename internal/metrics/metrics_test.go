@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.", "code", "path")
+	c.With("200", "/").Add(3)
+	c.With("500", `a"b\c`+"\n").Inc()
+	g := NewGauge("test_temperature", "Temperature.")
+	g.With().Set(-4)
+	NewGauge("test_unused", "Never set.")
+
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# HELP test_requests_total Requests.\n# TYPE test_requests_total counter\n" +
+			`test_requests_total{code="200",path="/"} 3` + "\n" +
+			`test_requests_total{code="500",path="a\"b\\c\n"} 1` + "\n",
+		"# TYPE test_temperature gauge\ntest_temperature -4\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks\n%s\ngot\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "test_unused") {
+		t.Errorf("a metric without values was written")
+	}
+
+	c.Delete("500", `a"b\c`+"\n")
+	buf.Reset()
+	Write(&buf)
+	if strings.Contains(buf.String(), `code="500"`) {
+		t.Errorf("deleted value was written")
+	}
+}
+
+type closer struct{ closed bool }
+
+func (c *closer) Close() error { c.closed = true; return nil }
+
+func TestStream(t *testing.T) {
+	in := NewInbound("test/stream")
+	if NewInbound("test/stream") != in {
+		t.Errorf("NewInbound returned new counters for a known name")
+	}
+	var closed []string
+	OnStreamClose(func(s *Stream) {
+		if s.Inbound == "test/stream" {
+			closed = append(closed, s.Reason())
+		}
+	})
+
+	c := &closer{}
+	s := in.Open("tcp", "192.0.2.1:1000", "example.com:80", 7, c)
+	io.Copy(io.Discard, s.Up(strings.NewReader("hello")))
+	io.Copy(io.Discard, s.Down(strings.NewReader("hi")))
+	s.SetResolved("192.0.2.80:80")
+
+	info := find(t, s.ID)
+	if info.Up != 5 || info.Down != 2 || info.Resolved != "192.0.2.80:80" || info.SID != 7 {
+		t.Errorf("Streams() entry = %+v", info)
+	}
+	if err := Kill(s.ID); err != nil || !c.closed {
+		t.Errorf("Kill() = %v, closer called %v", err, c.closed)
+	}
+	s.End(io.EOF)
+	s.Close()
+	s.Close()
+	if err := Kill(s.ID); err == nil {
+		t.Errorf("Kill succeeded on a closed stream")
+	}
+
+	// Reasons come from the first error recorded.
+	s = in.Open("udp", "192.0.2.1:1000", "192.0.2.53:53", 8, nil)
+	s.End(fmt.Errorf("read: %w", os.ErrDeadlineExceeded))
+	s.End(errors.New("later"))
+	s.Close()
+	s = in.Open("udp", "192.0.2.1:1000", "192.0.2.53:53", 9, nil)
+	s.Close()
+
+	if want := []string{"killed", "idle", "closed"}; fmt.Sprint(closed) != fmt.Sprint(want) {
+		t.Errorf("close reasons = %v, want %v", closed, want)
+	}
+	for _, info := range Inbounds() {
+		if info.Name == "test/stream" && (info.Opened != 3 || info.Active != 0 || info.Up != 5 || info.Down != 2) {
+			t.Errorf("Inbounds() entry = %+v", info)
+		}
+	}
+}
+
+func find(t *testing.T, id uint64) StreamInfo {
+	t.Helper()
+	for _, info := range Streams() {
+		if info.ID == id {
+			return info
+		}
+	}
+	t.Fatalf("stream %d not listed", id)
+	return StreamInfo{}
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	NewInbound("test/serve").Fail()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, addr, "/metrics") }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(string(body), `paqet_stream_errors_total{inbound="test/serve"} 1`) {
+		t.Errorf("scrape lacks the stream error:\n%s", body)
+	}
+}
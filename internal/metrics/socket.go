@@ -0,0 +1,15 @@
+package metrics
+
+import "github.com/starco76/paqet/internal/socket"
+
+// SetSocket publishes a snapshot of the raw socket counters for conn.
+func SetSocket(conn string, s socket.Stats) {
+	Packets.With(conn, "in").Set(int64(s.InPackets))
+	Packets.With(conn, "out").Set(int64(s.OutPackets))
+	PacketBytes.With(conn, "in").Set(int64(s.InBytes))
+	PacketBytes.With(conn, "out").Set(int64(s.OutBytes))
+	PacketErrors.With(conn, "in").Set(int64(s.InErrors))
+	PacketErrors.With(conn, "out").Set(int64(s.OutErrors))
+	PcapDropped.With(conn, "kernel").Set(int64(s.PcapDropped))
+	PcapDropped.With(conn, "interface").Set(int64(s.PcapIfDropped))
+}
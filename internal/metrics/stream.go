@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream is one relayed TCP connection or UDP session, tracked from Open
+// until Close so it can be listed and accounted.
+type Stream struct {
+	ID      uint64
+	Inbound string
+	Network string
+	Source  string
+	Target  string
+	SID     int
+	Started time.Time
+
+	in       *Inbound
+	up       atomic.Int64
+	down     atomic.Int64
+	closer   io.Closer
+	once     sync.Once
+	mu       sync.Mutex
+	resolved string
+	reason   string
+}
+
+type StreamInfo struct {
+	ID       uint64    `json:"id"`
+	Inbound  string    `json:"inbound"`
+	Network  string    `json:"network"`
+	Source   string    `json:"source"`
+	Target   string    `json:"target"`
+	SID      int       `json:"sid"`
+	Started  time.Time `json:"started"`
+	Resolved string    `json:"resolved,omitempty"`
+	Up       int64     `json:"up"`
+	Down     int64     `json:"down"`
+}
+
+var (
+	streamID atomic.Uint64
+	streams  = make(map[uint64]*Stream)
+	streamMu sync.Mutex
+
+	closeHooks []func(s *Stream)
+)
+
+// OnStreamClose registers fn to run once for every stream as it closes.
+func OnStreamClose(fn func(s *Stream)) {
+	streamMu.Lock()
+	closeHooks = append(closeHooks, fn)
+	streamMu.Unlock()
+}
+
+// Open starts tracking a stream; closer is what gets closed when the stream
+// has to be torn down from outside its relay.
+func (in *Inbound) Open(network, source, target string, sid int, closer io.Closer) *Stream {
+	s := &Stream{
+		ID:      streamID.Add(1),
+		Inbound: in.name,
+		Network: network,
+		Source:  source,
+		Target:  target,
+		SID:     sid,
+		Started: time.Now(),
+		in:      in,
+		closer:  closer,
+	}
+	in.opened.Inc()
+	in.active.Inc()
+	streamMu.Lock()
+	streams[s.ID] = s
+	streamMu.Unlock()
+	return s
+}
+
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		s.in.active.Dec()
+		streamMu.Lock()
+		delete(streams, s.ID)
+		hooks := closeHooks
+		streamMu.Unlock()
+		for _, fn := range hooks {
+			fn(s)
+		}
+	})
+}
+
+// SetResolved records the address the target was actually dialed at.
+func (s *Stream) SetResolved(addr string) {
+	s.mu.Lock()
+	s.resolved = addr
+	s.mu.Unlock()
+}
+
+// End records why the relay stopped, from the error it ended with; the first
+// reason recorded is kept.
+func (s *Stream) End(err error) {
+	if err == nil {
+		return
+	}
+	var reason string
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		reason = "shutdown"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		reason = "idle"
+	case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed), errors.Is(err, io.ErrClosedPipe):
+		reason = "closed"
+	default:
+		reason = err.Error()
+	}
+	s.setReason(reason)
+}
+
+func (s *Stream) setReason(reason string) {
+	s.mu.Lock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+}
+
+// Reason is why the stream ended, "closed" when no relay error was recorded.
+func (s *Stream) Reason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reason == "" {
+		return "closed"
+	}
+	return s.reason
+}
+
+func (s *Stream) AddUp(n int) {
+	s.up.Add(int64(n))
+	s.in.up.Add(int64(n))
+}
+
+func (s *Stream) AddDown(n int) {
+	s.down.Add(int64(n))
+	s.in.down.Add(int64(n))
+}
+
+// Up counts bytes read through r as sent by the client side.
+func (s *Stream) Up(r io.Reader) io.Reader {
+	return &countingReader{r: r, add: s.AddUp}
+}
+
+func (s *Stream) Down(r io.Reader) io.Reader {
+	return &countingReader{r: r, add: s.AddDown}
+}
+
+func (s *Stream) Info() StreamInfo {
+	s.mu.Lock()
+	resolved := s.resolved
+	s.mu.Unlock()
+	return StreamInfo{
+		ID:       s.ID,
+		Inbound:  s.Inbound,
+		Network:  s.Network,
+		Source:   s.Source,
+		Target:   s.Target,
+		SID:      s.SID,
+		Started:  s.Started,
+		Resolved: resolved,
+		Up:       s.up.Load(),
+		Down:     s.down.Load(),
+	}
+}
+
+func Streams() []StreamInfo {
+	streamMu.Lock()
+	list := make([]StreamInfo, 0, len(streams))
+	for _, s := range streams {
+		list = append(list, s.Info())
+	}
+	streamMu.Unlock()
+	slices.SortFunc(list, func(a, b StreamInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return list
+}
+
+// Kill closes the stream's underlying connection so its relay exits.
+func Kill(id uint64) error {
+	streamMu.Lock()
+	s, ok := streams[id]
+	streamMu.Unlock()
+	if !ok {
+		return fmt.Errorf("stream %d not found", id)
+	}
+	if s.closer == nil {
+		return fmt.Errorf("stream %d cannot be closed", id)
+	}
+	s.setReason("killed")
+	return s.closer.Close()
+}
+
+type countingReader struct {
+	r   io.Reader
+	add func(int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.add(n)
+	}
+	return n, err
+}
@@ -0,0 +1,16 @@
+package outbound
+
+import (
+	"syscall"
+)
+
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package outbound
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+func bindToDevice(c syscall.RawConn, iface string) error {
+	return fmt.Errorf("binding to interface %s is not supported on %s", iface, runtime.GOOS)
+}
@@ -0,0 +1,87 @@
+package outbound
+
+import (
+	"context"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/resolver"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Direct struct {
+	source   net.IP
+	iface    string
+	check    Check
+	resolver *resolver.Resolver
+}
+
+func newDirect(cfg *conf.Dialer, check Check, res *resolver.Resolver) *Direct {
+	return &Direct{source: cfg.Source, iface: cfg.Interface, check: check, resolver: res}
+}
+
+func (d *Direct) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		host = ""
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if d.iface != "" {
+				if err := bindToDevice(c, d.iface); err != nil {
+					return err
+				}
+			}
+			if d.check == nil {
+				return nil
+			}
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return d.check(host, ap.Addr(), int(ap.Port()))
+		},
+	}
+	if d.source != nil {
+		if strings.HasPrefix(network, "udp") {
+			dialer.LocalAddr = &net.UDPAddr{IP: d.source}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: d.source}
+		}
+	}
+	if host == "" || d.resolver == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.resolver.LookupNetIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs = slices.DeleteFunc(addrs, func(a netip.Addr) bool {
+		return strings.HasSuffix(network, "4") && !a.Is4() || strings.HasSuffix(network, "6") && a.Is4()
+	})
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host}
+	}
+
+	dial := func(ctx context.Context, ip netip.Addr) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, netip.AddrPortFrom(ip, uint16(port)).String())
+	}
+	if strings.HasPrefix(network, "udp") {
+		return dial(ctx, addrs[0])
+	}
+	return resolver.DialParallel(ctx, addrs, d.resolver.FallbackDelay(), dial)
+}
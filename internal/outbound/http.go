@@ -0,0 +1,78 @@
+package outbound
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type HTTP struct {
+	addr     string
+	username string
+	password string
+	check    Check
+	dialer   *Direct
+}
+
+func (h *HTTP) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("HTTP proxy %s does not support %s", h.addr, network)
+	}
+
+	if err := checkResolved(ctx, h.check, h.dialer.resolver, addr, true); err != nil {
+		return nil, err
+	}
+	conn, err := h.dialer.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to HTTP proxy %s: %w", h.addr, err)
+	}
+	conn.SetDeadline(handshakeDeadline(ctx))
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if h.username != "" || h.password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(h.username + ":" + h.password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy %s replied %s", h.addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
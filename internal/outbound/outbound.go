@@ -0,0 +1,128 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/resolver"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Check is consulted with every address a direct dialer is about to connect to.
+// Proxy dialers consult it with every address the destination name resolves
+// to locally before handing the name to the upstream proxy.
+type Check func(host string, ip netip.Addr, port int) error
+
+// checkResolved resolves a destination name and runs check on each address.
+// Address literals are left to the caller, which checks them before routing.
+// When proxied, the upstream proxy resolves the name in the end and may know
+// names the local resolver does not, so a failed lookup is left to it and
+// .onion names, which must never reach DNS, are not looked up at all.
+func checkResolved(ctx context.Context, check Check, res *resolver.Resolver, addr string, proxied bool) error {
+	if check == nil {
+		return nil
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	if proxied && isOnion(host) {
+		return nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	var addrs []netip.Addr
+	if res != nil {
+		addrs, err = res.LookupNetIP(ctx, host)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+	if err != nil {
+		if proxied {
+			return nil
+		}
+		return err
+	}
+	for _, ip := range addrs {
+		if err := check(host, ip.Unmap(), port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isOnion(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == "onion" || strings.HasSuffix(host, ".onion")
+}
+
+type Router struct {
+	dialers map[string]Dialer
+	def     string
+	rules   []conf.OutboundRule
+	check   Check
+	res     *resolver.Resolver
+}
+
+func New(cfg *conf.Outbound, check Check, res *resolver.Resolver) (*Router, error) {
+	r := &Router{
+		dialers: make(map[string]Dialer),
+		def:     cfg.Default,
+		rules:   cfg.Rules,
+		check:   check,
+		res:     res,
+	}
+	for i := range cfg.Dialers {
+		d, err := newDialer(&cfg.Dialers[i], check, res)
+		if err != nil {
+			return nil, fmt.Errorf("outbound %s: %w", cfg.Dialers[i].Name, err)
+		}
+		r.dialers[cfg.Dialers[i].Name] = d
+	}
+	if _, ok := r.dialers[r.def]; !ok {
+		return nil, fmt.Errorf("outbound default dialer '%s' is not defined", r.def)
+	}
+	return r, nil
+}
+
+func newDialer(cfg *conf.Dialer, check Check, res *resolver.Resolver) (Dialer, error) {
+	switch cfg.Type {
+	case "direct":
+		return newDirect(cfg, check, res), nil
+	case "socks5":
+		return &SOCKS5{addr: cfg.Addr.String(), username: cfg.Username, password: cfg.Password, check: check, dialer: newDirect(cfg, nil, res)}, nil
+	case "http":
+		return &HTTP{addr: cfg.Addr.String(), username: cfg.Username, password: cfg.Password, check: check, dialer: newDirect(cfg, nil, res)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dialer type: %s", cfg.Type)
+	}
+}
+
+// Check runs the check on every address the host in addr resolves to, for
+// connections dialed outside the router.
+func (r *Router) Check(ctx context.Context, addr string) error {
+	return checkResolved(ctx, r.check, r.res, addr, false)
+}
+
+// Route picks the dialer for a destination. ip is only valid when the client
+// asked for an address literal.
+func (r *Router) Route(host string, ip netip.Addr, port int) (string, Dialer) {
+	for i := range r.rules {
+		if r.rules[i].Match(host, ip, port) {
+			return r.rules[i].Dialer, r.dialers[r.rules[i].Dialer]
+		}
+	}
+	return r.def, r.dialers[r.def]
+}
@@ -0,0 +1,138 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/resolver"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/txthinking/socks5"
+)
+
+// fakeSOCKS5 accepts every CONNECT and reports the requested addresses.
+func fakeSOCKS5(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	requests := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := socks5.NewNegotiationRequestFrom(conn); err != nil {
+					return
+				}
+				if _, err := socks5.NewNegotiationReply(socks5.MethodNone).WriteTo(conn); err != nil {
+					return
+				}
+				r, err := socks5.NewRequestFrom(conn)
+				if err != nil {
+					return
+				}
+				requests <- r.Address()
+				socks5.NewReply(socks5.RepSuccess, socks5.ATYPIPv4, []byte{0, 0, 0, 0}, []byte{0, 0}).WriteTo(conn)
+			}()
+		}
+	}()
+	return l.Addr().String(), requests
+}
+
+// failingDNS is a DNS server that drops every query, counting them.
+func failingDNS(t *testing.T) (*url.URL, *atomic.Int32) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var queries atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			queries.Add(1)
+			conn.Close()
+		}
+	}()
+	return &url.URL{Scheme: "tcp", Host: l.Addr().String()}, &queries
+}
+
+func TestProxyCheck(t *testing.T) {
+	errPrivate := errors.New("private")
+	check := func(host string, ip netip.Addr, port int) error {
+		if ip.IsPrivate() {
+			return errPrivate
+		}
+		return nil
+	}
+	proxy, requests := fakeSOCKS5(t)
+	dns, queries := failingDNS(t)
+	res, err := resolver.New(&conf.Resolver{
+		Servers: []*url.URL{dns},
+		Timeout: 1,
+		Hosts: map[string][]netip.Addr{
+			"internal.test": {netip.MustParseAddr("10.0.0.1")},
+			"public.test":   {netip.MustParseAddr("192.0.2.1")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paddr, err := tnet.NewAddr(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDialer(&conf.Dialer{Name: "tor", Type: "socks5", Addr: paddr}, check, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr    string
+		deny    bool
+		queried bool
+	}{
+		{addr: "public.test:80"},
+		{addr: "internal.test:80", deny: true},
+		{addr: "missing.test:80", queried: true},
+		{addr: "hidden.onion:80"},
+		{addr: "HIDDEN.ONION.:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			before := queries.Load()
+			conn, err := d.DialContext(context.Background(), "tcp", tt.addr)
+			if tt.deny {
+				if !errors.Is(err, errPrivate) {
+					t.Fatalf("DialContext(%s) error = %v, want denied", tt.addr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DialContext(%s) error = %v", tt.addr, err)
+			}
+			conn.Close()
+			if got := <-requests; got != tt.addr {
+				t.Errorf("proxy was asked for %s, want %s", got, tt.addr)
+			}
+			if queried := queries.Load() > before; queried != tt.queried {
+				t.Errorf("local DNS queried = %v, want %v", queried, tt.queried)
+			}
+		})
+	}
+}
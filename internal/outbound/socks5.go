@@ -0,0 +1,155 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/txthinking/socks5"
+)
+
+type SOCKS5 struct {
+	addr     string
+	username string
+	password string
+	check    Check
+	dialer   *Direct
+}
+
+func (s *SOCKS5) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := checkResolved(ctx, s.check, s.dialer.resolver, addr, true); err != nil {
+		return nil, err
+	}
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS5 proxy %s: %w", s.addr, err)
+	}
+	conn.SetDeadline(handshakeDeadline(ctx))
+
+	if err := s.negotiate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	a, h, p, err := socks5.ParseAddress(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if a == socks5.ATYPDomain {
+		h = h[1:]
+	}
+
+	if strings.HasPrefix(network, "udp") {
+		rp, err := s.request(conn, socks5.NewRequest(socks5.CmdUDP, socks5.ATYPIPv4, []byte{0, 0, 0, 0}, []byte{0, 0}))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		relay := rp.Address()
+		if rh, rport, err := net.SplitHostPort(relay); err == nil && net.ParseIP(rh).IsUnspecified() {
+			ph, _, _ := net.SplitHostPort(s.addr)
+			relay = net.JoinHostPort(ph, rport)
+		}
+		uconn, err := s.dialer.DialContext(ctx, "udp", relay)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to SOCKS5 UDP relay %s: %w", relay, err)
+		}
+		conn.SetDeadline(time.Time{})
+		return &socksUDPConn{Conn: uconn, ctrl: conn, atyp: a, host: h, port: p, buf: make([]byte, 65535)}, nil
+	}
+
+	if _, err := s.request(conn, socks5.NewRequest(socks5.CmdConnect, a, h, p)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (s *SOCKS5) negotiate(conn net.Conn) error {
+	m := socks5.MethodNone
+	if s.username != "" || s.password != "" {
+		m = socks5.MethodUsernamePassword
+	}
+	if _, err := socks5.NewNegotiationRequest([]byte{m}).WriteTo(conn); err != nil {
+		return err
+	}
+	rp, err := socks5.NewNegotiationReplyFrom(conn)
+	if err != nil {
+		return err
+	}
+	if rp.Method != m {
+		return fmt.Errorf("SOCKS5 proxy %s rejected authentication method %d", s.addr, m)
+	}
+	if m == socks5.MethodUsernamePassword {
+		if _, err := socks5.NewUserPassNegotiationRequest([]byte(s.username), []byte(s.password)).WriteTo(conn); err != nil {
+			return err
+		}
+		urp, err := socks5.NewUserPassNegotiationReplyFrom(conn)
+		if err != nil {
+			return err
+		}
+		if urp.Status != socks5.UserPassStatusSuccess {
+			return fmt.Errorf("SOCKS5 proxy %s: %w", s.addr, socks5.ErrUserPassAuth)
+		}
+	}
+	return nil
+}
+
+func (s *SOCKS5) request(conn net.Conn, r *socks5.Request) (*socks5.Reply, error) {
+	if _, err := r.WriteTo(conn); err != nil {
+		return nil, err
+	}
+	rp, err := socks5.NewReplyFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+	if rp.Rep != socks5.RepSuccess {
+		return nil, fmt.Errorf("SOCKS5 proxy %s replied with code %d", s.addr, rp.Rep)
+	}
+	return rp, nil
+}
+
+type socksUDPConn struct {
+	net.Conn
+	ctrl net.Conn
+	atyp byte
+	host []byte
+	port []byte
+	buf  []byte
+}
+
+func (c *socksUDPConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(c.buf)
+	if err != nil {
+		return 0, err
+	}
+	d, err := socks5.NewDatagramFromBytes(c.buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, d.Data), nil
+}
+
+func (c *socksUDPConn) Write(b []byte) (int, error) {
+	d := socks5.NewDatagram(c.atyp, c.host, c.port, b)
+	if _, err := c.Conn.Write(d.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *socksUDPConn) Close() error {
+	return errors.Join(c.Conn.Close(), c.ctrl.Close())
+}
+
+func handshakeDeadline(ctx context.Context) time.Time {
+	if d, ok := ctx.Deadline(); ok {
+		return d
+	}
+	return time.Now().Add(10 * time.Second)
+}
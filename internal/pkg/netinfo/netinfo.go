@@ -0,0 +1,36 @@
+// Package netinfo looks up the default gateway of an interface and the
+// link-layer address of its neighbours.
+package netinfo
+
+import (
+	"net"
+	"time"
+)
+
+// Probe sends one datagram to ip so that the kernel resolves its link-layer
+// address and the neighbour table gets an entry for it.
+func Probe(ip net.IP) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), "9"), time.Second)
+	if err != nil {
+		return
+	}
+	conn.Write([]byte{0})
+	conn.Close()
+	time.Sleep(200 * time.Millisecond)
+}
+
+// Router returns the default gateway on iface for the given family and its
+// MAC address, probing the gateway once if the neighbour table has no entry.
+// The MAC is nil when the gateway is known but could not be resolved.
+func Router(iface string, ipv6 bool) (net.IP, net.HardwareAddr, error) {
+	gw, err := Gateway(iface, ipv6)
+	if err != nil || gw == nil {
+		return nil, nil, err
+	}
+	mac, err := Neighbor(iface, gw)
+	if err == nil && mac == nil {
+		Probe(gw)
+		mac, err = Neighbor(iface, gw)
+	}
+	return gw, mac, err
+}
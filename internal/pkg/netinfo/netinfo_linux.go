@@ -0,0 +1,79 @@
+package netinfo
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Gateway returns the default gateway on iface, or nil if there is none.
+func Gateway(iface string, ipv6 bool) (net.IP, error) {
+	if ipv6 {
+		// The kernel does not expose IPv6 routes in a readable form under
+		// /proc, so ask iproute2.
+		out, err := exec.Command("ip", "-6", "route", "show", "default", "dev", iface).Output()
+		if err != nil {
+			return nil, err
+		}
+		f := strings.Fields(string(out))
+		if len(f) < 3 || f[1] != "via" {
+			return nil, nil
+		}
+		return net.ParseIP(f[2]), nil
+	}
+
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		// Iface, Destination, Gateway, ... with addresses in host byte order
+		f := strings.Fields(line)
+		if len(f) < 3 || f[0] != iface || f[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(f[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		return ip, nil
+	}
+	return nil, nil
+}
+
+// Neighbor returns the MAC address of ip on iface, or nil if the neighbour
+// table has no complete entry for it.
+func Neighbor(iface string, ip net.IP) (net.HardwareAddr, error) {
+	if ip.To4() == nil {
+		out, err := exec.Command("ip", "-6", "neigh", "show", ip.String(), "dev", iface).Output()
+		if err != nil {
+			return nil, err
+		}
+		f := strings.Fields(string(out))
+		for i := 0; i+1 < len(f); i++ {
+			if f[i] == "lladdr" {
+				return net.ParseMAC(f[i+1])
+			}
+		}
+		return nil, nil
+	}
+
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		f := strings.Fields(line)
+		if len(f) < 6 || f[5] != iface || f[0] != ip.String() || f[2] == "0x0" {
+			continue
+		}
+		return net.ParseMAC(f[3])
+	}
+	return nil, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package netinfo
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+func Gateway(iface string, ipv6 bool) (net.IP, error) {
+	return nil, fmt.Errorf("gateway lookup is not supported on %s", runtime.GOOS)
+}
+
+func Neighbor(iface string, ip net.IP) (net.HardwareAddr, error) {
+	return nil, fmt.Errorf("neighbour lookup is not supported on %s", runtime.GOOS)
+}
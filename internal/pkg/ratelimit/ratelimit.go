@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket refilled at rate bytes per second with one second of burst.
+// A zero rate disables limiting.
+type Limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func New(rate int64) *Limiter {
+	return &Limiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(rate)
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// Wait takes n tokens and sleeps until the bucket has caught up with them.
+func (l *Limiter) Wait(n int) {
+	if d := l.reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    int64
+		tokens  float64
+		elapsed time.Duration
+		n       int
+		want    time.Duration
+	}{
+		{"disabled", 0, 0, 0, 1 << 20, 0},
+		{"within burst", 1000, 1000, 0, 600, 0},
+		{"exactly empty", 1000, 1000, 0, 1000, 0},
+		{"over burst", 1000, 1000, 0, 1500, 500 * time.Millisecond},
+		{"empty bucket", 1000, 0, 0, 250, 250 * time.Millisecond},
+		{"refilled", 1000, 0, 500 * time.Millisecond, 500, 0},
+		{"refill capped at burst", 1000, 0, 10 * time.Second, 2000, time.Second},
+		{"in debt", 1000, -1000, 0, 1000, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.rate)
+			l.tokens = tt.tokens
+			l.last = time.Now().Add(-tt.elapsed)
+			got := l.reserve(tt.n)
+			if diff := got - tt.want; diff < -5*time.Millisecond || diff > 5*time.Millisecond {
+				t.Errorf("reserve(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	l := New(1000)
+	l.SetRate(100)
+	if l.tokens != 100 {
+		t.Errorf("tokens after lowering the rate = %v, want 100", l.tokens)
+	}
+	l.SetRate(0)
+	if d := l.reserve(1 << 20); d != 0 {
+		t.Errorf("reserve with rate 0 = %v, want 0", d)
+	}
+}
@@ -2,9 +2,9 @@ package protocol
 
 import (
 	"encoding/gob"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
 	"io"
-	"paqet/internal/conf"
-	"paqet/internal/tnet"
 )
 
 type PType = byte
@@ -15,15 +15,36 @@ const (
 	PTCPF PType = 0x03
 	PTCP  PType = 0x04
 	PUDP  PType = 0x05
+	PRTCP PType = 0x06
+	PRUDP PType = 0x07
+	POK   PType = 0x08
+	PDENY PType = 0x09
+	PFAIL PType = 0x0A
+	PSVC  PType = 0x0C
 )
 
+// Version is the protocol revision this build speaks. Peers at 1 or later
+// answer requests with POK, PDENY or PFAIL; older ones send no answer.
+// Clients learn the server's revision from the PPONG to a PPING sent once
+// per connection, and servers the client's from each request.
+const Version = 1
+
 type Proto struct {
 	Type PType
-	Addr *tnet.Addr
-	TCPF []conf.TCPF
+	// Version is the sender's revision, set by Write. Peers that predate it
+	// decode it as 0.
+	Version int
+	Addr    *tnet.Addr
+	TCPF    []conf.TCPF
+	Msg     string
 }
 
 func (p *Proto) Read(r io.Reader) error {
+	// gob buffers readers that can't read single bytes, which would swallow
+	// whatever follows the message on the stream.
+	if _, ok := r.(io.ByteReader); !ok {
+		r = &byteReader{Reader: r}
+	}
 	dec := gob.NewDecoder(r)
 
 	err := dec.Decode(p)
@@ -36,10 +57,24 @@ func (p *Proto) Read(r io.Reader) error {
 func (p *Proto) Write(w io.Writer) error {
 	enc := gob.NewEncoder(w)
 
-	err := enc.Encode(p)
+	v := *p
+	v.Version = Version
+	err := enc.Encode(&v)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+type byteReader struct {
+	io.Reader
+	b [1]byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(r.Reader, r.b[:]); err != nil {
+		return 0, err
+	}
+	return r.b[0], nil
+}
@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type query struct {
+	id     uint16
+	packed []byte
+}
+
+func newQuery(name string, qtype dnsmessage.Type) (*query, error) {
+	n, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: n, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return &query{id: msg.Header.ID, packed: packed}, nil
+}
+
+func parseAnswer(name string, qtype dnsmessage.Type, resp []byte) ([]netip.Addr, time.Duration, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return nil, 0, fmt.Errorf("DNS server returned %s for %s", h.RCode, name)
+	}
+
+	var addrs []netip.Addr
+	var ttl uint32
+	for {
+		ah, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if ah.Type != qtype || ah.Class != dnsmessage.ClassINET {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		switch qtype {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			addrs = append(addrs, netip.AddrFrom4(a.A))
+		case dnsmessage.TypeAAAA:
+			a, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			addrs = append(addrs, netip.AddrFrom16(a.AAAA))
+		}
+		if ttl == 0 || ah.TTL < ttl {
+			ttl = ah.TTL
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
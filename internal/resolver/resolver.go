@@ -0,0 +1,214 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var log = flog.New("resolver")
+
+type entry struct {
+	addrs  []netip.Addr
+	err    error
+	expire time.Time
+}
+
+type cacheKey struct {
+	host  string
+	qtype dnsmessage.Type
+}
+
+type Resolver struct {
+	cfg       *conf.Resolver
+	upstreams []upstream
+	cache     map[cacheKey]entry
+	mu        sync.Mutex
+}
+
+func New(cfg *conf.Resolver) (*Resolver, error) {
+	r := &Resolver{cfg: cfg, cache: make(map[cacheKey]entry)}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	for _, u := range cfg.Servers {
+		up, err := newUpstream(u, timeout)
+		if err != nil {
+			return nil, err
+		}
+		r.upstreams = append(r.upstreams, up)
+	}
+	return r, nil
+}
+
+func (r *Resolver) FallbackDelay() time.Duration {
+	return time.Duration(r.cfg.FallbackDelay) * time.Millisecond
+}
+
+// LookupNetIP resolves host to addresses ordered by the configured family preference.
+func (r *Resolver) LookupNetIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if addrs, ok := r.cfg.Hosts[name]; ok {
+		return r.sort(addrs), nil
+	}
+
+	var qtypes []dnsmessage.Type
+	switch r.cfg.Prefer {
+	case "ipv4-only":
+		qtypes = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ipv6-only":
+		qtypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		qtypes = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	}
+
+	type result struct {
+		addrs []netip.Addr
+		err   error
+	}
+	results := make(chan result, len(qtypes))
+	for _, qtype := range qtypes {
+		go func() {
+			addrs, err := r.lookup(ctx, name, qtype)
+			results <- result{addrs, err}
+		}()
+	}
+
+	var addrs []netip.Addr
+	var errs []error
+	for range qtypes {
+		res := <-results
+		addrs = append(addrs, res.addrs...)
+		if res.err != nil {
+			errs = append(errs, res.err)
+		}
+	}
+	if len(addrs) == 0 {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return r.sort(addrs), nil
+}
+
+func (r *Resolver) lookup(ctx context.Context, name string, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	key := cacheKey{name, qtype}
+	now := time.Now()
+	if r.cfg.CacheSize > 0 {
+		r.mu.Lock()
+		e, ok := r.cache[key]
+		r.mu.Unlock()
+		if ok && now.Before(e.expire) {
+			return e.addrs, e.err
+		}
+	}
+
+	addrs, ttl, err := r.query(ctx, name, qtype)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	ttl = max(ttl, time.Duration(r.cfg.MinTTL)*time.Second)
+	ttl = min(ttl, time.Duration(r.cfg.MaxTTL)*time.Second)
+	r.store(key, entry{addrs: addrs, err: err, expire: now.Add(ttl)})
+	return addrs, err
+}
+
+func (r *Resolver) query(ctx context.Context, name string, qtype dnsmessage.Type) ([]netip.Addr, time.Duration, error) {
+	if len(r.upstreams) == 0 {
+		network := "ip4"
+		if qtype == dnsmessage.TypeAAAA {
+			network = "ip6"
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, network, name)
+		for i := range addrs {
+			addrs[i] = addrs[i].Unmap()
+		}
+		return addrs, 0, err
+	}
+
+	q, err := newQuery(name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	var lastErr error
+	for _, up := range r.upstreams {
+		resp, err := up.exchange(ctx, q)
+		if err != nil {
+			log.Debugf("DNS query %s %s via %s failed: %v", name, qtype, up, err)
+			lastErr = err
+			continue
+		}
+		return parseAnswer(name, qtype, resp)
+	}
+	return nil, 0, fmt.Errorf("all DNS servers failed for %s: %w", name, lastErr)
+}
+
+func (r *Resolver) store(key cacheKey, e entry) {
+	if r.cfg.CacheSize <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= r.cfg.CacheSize {
+		now := time.Now()
+		for k, v := range r.cache {
+			if now.After(v.expire) {
+				delete(r.cache, k)
+			}
+		}
+		for k := range r.cache {
+			if len(r.cache) < r.cfg.CacheSize {
+				break
+			}
+			delete(r.cache, k)
+		}
+	}
+	r.cache[key] = e
+}
+
+// sort interleaves address families starting with the preferred one, as
+// described for happy eyeballs in RFC 8305.
+func (r *Resolver) sort(addrs []netip.Addr) []netip.Addr {
+	var v4, v6 []netip.Addr
+	for _, a := range addrs {
+		if a.Is4() {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+	switch r.cfg.Prefer {
+	case "ipv4-only":
+		return v4
+	case "ipv6-only":
+		return v6
+	}
+
+	first, second := v6, v4
+	if r.cfg.Prefer == "ipv4" {
+		first, second = v4, v6
+	}
+	sorted := make([]netip.Addr, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			sorted = append(sorted, first[i])
+		}
+		if i < len(second) {
+			sorted = append(sorted, second[i])
+		}
+	}
+	return sorted
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,224 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"github.com/starco76/paqet/internal/conf"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type answer struct {
+	typ  dnsmessage.Type
+	ttl  uint32
+	addr string
+}
+
+func response(t *testing.T, rcode dnsmessage.RCode, answers ...answer) []byte {
+	t.Helper()
+	name := dnsmessage.MustNewName("example.com.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, RCode: rcode})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range answers {
+		h := dnsmessage.ResourceHeader{Name: name, Type: a.typ, Class: dnsmessage.ClassINET, TTL: a.ttl}
+		var err error
+		switch a.typ {
+		case dnsmessage.TypeA:
+			err = b.AResource(h, dnsmessage.AResource{A: netip.MustParseAddr(a.addr).As4()})
+		case dnsmessage.TypeAAAA:
+			err = b.AAAAResource(h, dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(a.addr).As16()})
+		case dnsmessage.TypeCNAME:
+			err = b.CNAMEResource(h, dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(a.addr)})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestParseAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		qtype    dnsmessage.Type
+		rcode    dnsmessage.RCode
+		answers  []answer
+		want     []string
+		ttl      time.Duration
+		notFound bool
+		err      bool
+	}{
+		{
+			name:    "lowest ttl",
+			qtype:   dnsmessage.TypeA,
+			answers: []answer{{dnsmessage.TypeA, 300, "192.0.2.1"}, {dnsmessage.TypeA, 60, "192.0.2.2"}},
+			want:    []string{"192.0.2.1", "192.0.2.2"},
+			ttl:     60 * time.Second,
+		},
+		{
+			name:    "aaaa",
+			qtype:   dnsmessage.TypeAAAA,
+			answers: []answer{{dnsmessage.TypeAAAA, 120, "2001:db8::1"}},
+			want:    []string{"2001:db8::1"},
+			ttl:     120 * time.Second,
+		},
+		{
+			name:    "cname skipped",
+			qtype:   dnsmessage.TypeA,
+			answers: []answer{{dnsmessage.TypeCNAME, 10, "alias.example.com."}, {dnsmessage.TypeA, 30, "192.0.2.3"}},
+			want:    []string{"192.0.2.3"},
+			ttl:     30 * time.Second,
+		},
+		{
+			name:     "other family skipped",
+			qtype:    dnsmessage.TypeA,
+			answers:  []answer{{dnsmessage.TypeAAAA, 30, "2001:db8::1"}},
+			notFound: true,
+		},
+		{name: "no answers", qtype: dnsmessage.TypeA, notFound: true},
+		{name: "nxdomain", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError, notFound: true},
+		{name: "servfail", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeServerFailure, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, ttl, err := parseAnswer("example.com", tt.qtype, response(t, tt.rcode, tt.answers...))
+			if tt.notFound {
+				if !isNotFound(err) {
+					t.Fatalf("err = %v, want not found", err)
+				}
+				return
+			}
+			if tt.err {
+				if err == nil || isNotFound(err) {
+					t.Fatalf("err = %v, want a server error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, a := range addrs {
+				got = append(got, a.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("addrs = %v, want %v", got, tt.want)
+			}
+			if ttl != tt.ttl {
+				t.Errorf("ttl = %s, want %s", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+type fakeUpstream struct {
+	resp    []byte
+	queries int
+}
+
+func (u *fakeUpstream) String() string { return "fake" }
+
+func (u *fakeUpstream) exchange(ctx context.Context, q *query) ([]byte, error) {
+	u.queries++
+	if u.resp == nil {
+		return nil, errors.New("unreachable")
+	}
+	return u.resp, nil
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheSize int
+		minTTL    int
+		maxTTL    int
+		ttl       uint32
+		want      time.Duration
+		queries   int
+	}{
+		{name: "record ttl", cacheSize: 16, minTTL: 10, maxTTL: 3600, ttl: 60, want: 60 * time.Second, queries: 1},
+		{name: "raised to min_ttl", cacheSize: 16, minTTL: 10, maxTTL: 3600, ttl: 2, want: 10 * time.Second, queries: 1},
+		{name: "lowered to max_ttl", cacheSize: 16, minTTL: 10, maxTTL: 30, ttl: 600, want: 30 * time.Second, queries: 1},
+		{name: "no minimum", cacheSize: 16, minTTL: -1, maxTTL: 3600, ttl: 0, want: 0, queries: 2},
+		{name: "cache disabled", cacheSize: -1, minTTL: 10, maxTTL: 3600, ttl: 60, queries: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := &fakeUpstream{resp: response(t, dnsmessage.RCodeSuccess, answer{dnsmessage.TypeA, tt.ttl, "192.0.2.1"})}
+			r := &Resolver{
+				cfg:       &conf.Resolver{CacheSize: tt.cacheSize, MinTTL: tt.minTTL, MaxTTL: tt.maxTTL},
+				upstreams: []upstream{up},
+				cache:     make(map[cacheKey]entry),
+			}
+			start := time.Now()
+			for range 2 {
+				addrs, err := r.lookup(context.Background(), "example.com", dnsmessage.TypeA)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(addrs) != 1 || addrs[0] != netip.MustParseAddr("192.0.2.1") {
+					t.Fatalf("addrs = %v", addrs)
+				}
+			}
+			if up.queries != tt.queries {
+				t.Errorf("queries = %d, want %d", up.queries, tt.queries)
+			}
+			e, ok := r.cache[cacheKey{"example.com", dnsmessage.TypeA}]
+			if tt.cacheSize < 0 {
+				if ok {
+					t.Errorf("answer cached with the cache disabled")
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("answer not cached")
+			}
+			if got := e.expire.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("expires after %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	up := &fakeUpstream{resp: response(t, dnsmessage.RCodeNameError)}
+	r := &Resolver{
+		cfg:       &conf.Resolver{CacheSize: 16, MinTTL: 10, MaxTTL: 3600},
+		upstreams: []upstream{up},
+		cache:     make(map[cacheKey]entry),
+	}
+	for range 2 {
+		if _, err := r.lookup(context.Background(), "example.com", dnsmessage.TypeA); !isNotFound(err) {
+			t.Fatalf("err = %v, want not found", err)
+		}
+	}
+	if up.queries != 1 {
+		t.Errorf("queries = %d, want 1", up.queries)
+	}
+
+	up = &fakeUpstream{}
+	r.upstreams = []upstream{up}
+	if _, err := r.lookup(context.Background(), "example.org", dnsmessage.TypeA); err == nil || isNotFound(err) {
+		t.Fatalf("err = %v, want upstream failure", err)
+	}
+	if _, ok := r.cache[cacheKey{"example.org", dnsmessage.TypeA}]; ok {
+		t.Errorf("upstream failure was cached")
+	}
+}
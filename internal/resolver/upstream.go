@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type upstream interface {
+	exchange(ctx context.Context, q *query) ([]byte, error)
+	String() string
+}
+
+func newUpstream(u *url.URL, timeout time.Duration) (upstream, error) {
+	switch u.Scheme {
+	case "udp":
+		return &udpUpstream{addr: u.Host, timeout: timeout}, nil
+	case "tcp":
+		return &tcpUpstream{addr: u.Host, timeout: timeout}, nil
+	case "https":
+		return &dohUpstream{url: u.String(), client: &http.Client{Timeout: timeout}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported DNS server scheme: %s", u.Scheme)
+	}
+}
+
+type udpUpstream struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (u *udpUpstream) String() string { return "udp://" + u.addr }
+
+func (u *udpUpstream) exchange(ctx context.Context, q *query) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: u.timeout}
+	conn, err := dialer.DialContext(ctx, "udp", u.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline(ctx, u.timeout))
+
+	if _, err := conn.Write(q.packed); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1232)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var h dnsmessage.Header
+		var p dnsmessage.Parser
+		if h, err = p.Start(buf[:n]); err != nil || h.ID != q.id {
+			continue
+		}
+		if h.Truncated {
+			return (&tcpUpstream{addr: u.addr, timeout: u.timeout}).exchange(ctx, q)
+		}
+		return buf[:n], nil
+	}
+}
+
+type tcpUpstream struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (u *tcpUpstream) String() string { return "tcp://" + u.addr }
+
+func (u *tcpUpstream) exchange(ctx context.Context, q *query) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: u.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", u.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline(ctx, u.timeout))
+
+	msg := make([]byte, 2+len(q.packed))
+	binary.BigEndian.PutUint16(msg, uint16(len(q.packed)))
+	copy(msg[2:], q.packed)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+type dohUpstream struct {
+	url    string
+	client *http.Client
+}
+
+func (u *dohUpstream) String() string { return u.url }
+
+func (u *dohUpstream) exchange(ctx context.Context, q *query) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(q.packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server replied %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	d := time.Now().Add(timeout)
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		return cd
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net/netip"
+)
+
+var errDenied = errors.New("destination denied by server policy")
+
+func (s *Server) checkACL(host string, ip netip.Addr, port int) error {
+	acl := s.acl.Load()
+	for i := range acl.Deny {
+		if acl.Deny[i].Match(host, ip, port) {
+			return errDenied
+		}
+	}
+	private := *acl.BlockPrivate && ip.IsValid() && isPrivate(ip)
+	for i := range acl.Allow {
+		// Only a rule naming the private range lifts block_private for it.
+		if acl.Allow[i].Match(host, ip, port) && (!private || len(acl.Allow[i].CIDR) > 0) {
+			return nil
+		}
+	}
+	// Without a resolved address the allow list and private ranges can't be decided yet.
+	if !ip.IsValid() {
+		return nil
+	}
+	if len(acl.Allow) > 0 {
+		return errDenied
+	}
+	if private {
+		return errDenied
+	}
+	return nil
+}
+
+var (
+	sharedRange = netip.MustParsePrefix("100.64.0.0/10")
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+)
+
+func isPrivate(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsInterfaceLocalMulticast() || sharedRange.Contains(ip) || thisNetwork.Contains(ip)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err == nil {
+		host = ""
+	}
+	if err := s.checkACL(host, ip, port); err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	if s.hooks.Dial != nil {
+		// The hook resolves names its own way, so the ACL sees what the
+		// configured resolver returns for them.
+		if err := s.outbound.Check(ctx, addr); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		return s.hooks.Dial(ctx, network, addr)
+	}
+	name, dialer := s.outbound.Route(host, ip, port)
+	log.Debugf("dialing %s %s via %s outbound", network, addr, name)
+	return dialer.DialContext(ctx, network, addr)
+}
@@ -2,59 +2,91 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
-	"paqet/internal/flog"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 )
 
 func (s *Server) handleConn(ctx context.Context, conn tnet.Conn) {
 	for {
 		select {
 		case <-ctx.Done():
-			flog.Debugf("stopping smux session for %s due to context cancellation", conn.RemoteAddr())
+			log.Debugf("stopping smux session for %s due to context cancellation", conn.RemoteAddr())
 			return
 		default:
 		}
 		strm, err := conn.AcceptStrm()
 		if err != nil {
-			flog.Errorf("failed to accept stream on %s: %v", conn.RemoteAddr(), err)
+			log.Errorf("failed to accept stream on %s: %v", conn.RemoteAddr(), err)
 			return
 		}
 		s.wg.Go(func() {
 			defer strm.Close()
-			if err := s.handleStrm(ctx, strm); err != nil {
-				flog.Errorf("stream %d from %s closed with error: %v", strm.SID(), strm.RemoteAddr(), err)
+			if err := s.handleStrm(ctx, conn, strm); err != nil {
+				log.Errorf("stream %d from %s closed with error: %v", strm.SID(), strm.RemoteAddr(), err)
 			} else {
-				flog.Debugf("stream %d from %s closed", strm.SID(), strm.RemoteAddr())
+				log.Debugf("stream %d from %s closed", strm.SID(), strm.RemoteAddr())
 			}
 		})
 	}
 }
 
-func (s *Server) handleStrm(ctx context.Context, strm tnet.Strm) error {
+func (s *Server) handleStrm(ctx context.Context, conn tnet.Conn, strm tnet.Strm) error {
 	var p protocol.Proto
 	err := p.Read(strm)
 	if err != nil {
-		flog.Errorf("failed to read protocol message from stream %d: %v", strm.SID(), err)
+		log.Errorf("failed to read protocol message from stream %d: %v", strm.SID(), err)
 		return err
 	}
+	if p.Version < 1 {
+		strm = legacyStrm{strm}
+	}
 
 	switch p.Type {
 	case protocol.PPING:
 		return s.handlePing(strm)
 	case protocol.PTCPF:
-		if len(p.TCPF) != 0 {
+		if len(p.TCPF) != 0 && s.pConn != nil {
 			s.pConn.SetClientTCPF(strm.RemoteAddr(), p.TCPF)
 		}
 		return nil
 	case protocol.PTCP:
 		return s.handleTCPProtocol(ctx, strm, &p)
 	case protocol.PUDP:
-		return s.handleUDPProtocol(ctx, strm, &p)
+		return s.handleUDPProtocol(ctx, conn, strm, &p)
+	case protocol.PSVC:
+		return s.handleService(ctx, strm, &p)
+	case protocol.PRTCP, protocol.PRUDP:
+		return s.handleReverse(ctx, conn, strm, &p)
 	default:
-		flog.Errorf("unknown protocol type %d on stream %d", p.Type, strm.SID())
+		log.Errorf("unknown protocol type %d on stream %d", p.Type, strm.SID())
 		return fmt.Errorf("unknown protocol type: %d", p.Type)
 	}
 }
+
+// legacyStrm is a stream from a client that predates result replies and
+// would relay one as data.
+type legacyStrm struct {
+	tnet.Strm
+}
+
+func (s *Server) writeResult(strm tnet.Strm, err error) error {
+	if _, ok := strm.(legacyStrm); ok {
+		return nil
+	}
+	p := protocol.Proto{Type: protocol.POK}
+	if err != nil {
+		p.Type = protocol.PFAIL
+		if errors.Is(err, errDenied) || errors.Is(err, errQuota) {
+			p.Type = protocol.PDENY
+		}
+		p.Msg = err.Error()
+	}
+	if err := p.Write(strm); err != nil {
+		log.Errorf("failed to send result on stream %d: %v", strm.SID(), err)
+		return err
+	}
+	return nil
+}
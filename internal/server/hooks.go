@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Hooks let code embedding the server make decisions the configuration
+// otherwise makes. Nil fields keep the configured behaviour.
+type Hooks struct {
+	// Accept is called for each new transport connection; an error drops it.
+	Accept func(remote net.Addr) error
+	// Authorize is called before a TCP or UDP request is dialed; an error is
+	// returned to the client as a denial.
+	Authorize func(ctx context.Context, client net.Addr, network, addr string) error
+	// Dial replaces the configured outbound routing. The ACL still applies,
+	// to the requested address and to what the configured resolver returns
+	// for a requested name.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// SetHooks must be called before Start.
+func (s *Server) SetHooks(h Hooks) {
+	s.hooks = h
+}
+
+func (s *Server) authorize(ctx context.Context, client net.Addr, network, addr string) error {
+	if s.hooks.Authorize == nil {
+		return nil
+	}
+	if err := s.hooks.Authorize(ctx, client, network, addr); err != nil {
+		return fmt.Errorf("%w: %v", errDenied, err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/pkg/ratelimit"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+var errQuota = errors.New("traffic quota exceeded")
+
+// idleEvict is how long a client without a quota is remembered after its
+// last traffic; there is nothing of it worth keeping beyond that.
+const idleEvict = time.Hour
+
+type usage struct {
+	Day        string `json:"day"`
+	DayBytes   int64  `json:"day_bytes"`
+	Month      string `json:"month"`
+	MonthBytes int64  `json:"month_bytes"`
+
+	addr       string
+	limit      conf.Limit
+	up, down   *ratelimit.Limiter
+	sent, recv int64
+	last       time.Time
+	mu         sync.Mutex
+
+	// streams counts the client's open streams, guarded by limiter.mu.
+	streams int
+}
+
+type limiter struct {
+	cfg     *conf.Limits
+	clients map[string]*usage
+	mu      sync.Mutex
+}
+
+func newLimiter(cfg *conf.Limits) *limiter {
+	l := &limiter{cfg: cfg, clients: make(map[string]*usage)}
+	if cfg.State == "" {
+		return l
+	}
+
+	data, err := os.ReadFile(cfg.State)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("failed to read quota state %s: %v", cfg.State, err)
+		}
+		return l
+	}
+	if err := json.Unmarshal(data, &l.clients); err != nil {
+		log.Warnf("failed to parse quota state %s: %v", cfg.State, err)
+		l.clients = make(map[string]*usage)
+		return l
+	}
+	for addr, u := range l.clients {
+		l.init(addr, u)
+	}
+	log.Infof("loaded quota state for %d clients from %s", len(l.clients), cfg.State)
+	return l
+}
+
+// update applies new limits to known clients without resetting their usage.
+func (l *limiter) update(cfg *conf.Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	for addr, u := range l.clients {
+		ip, _ := netip.ParseAddr(addr)
+		limit := cfg.For(ip)
+		u.mu.Lock()
+		u.limit = limit
+		u.mu.Unlock()
+		u.up.SetRate(limit.Upload)
+		u.down.SetRate(limit.Download)
+	}
+}
+
+func (l *limiter) config() *conf.Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+func (l *limiter) init(addr string, u *usage) {
+	u.addr = addr
+	ip, _ := netip.ParseAddr(addr)
+	u.limit = l.cfg.For(ip)
+	u.up = ratelimit.New(u.limit.Upload)
+	u.down = ratelimit.New(u.limit.Download)
+}
+
+func (l *limiter) get(addr net.Addr) *usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lookup(addr)
+}
+
+// hold returns the client's usage for a stream it opened, which keeps the
+// client from being evicted until release is called.
+func (l *limiter) hold(addr net.Addr) (u *usage, release func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u = l.lookup(addr)
+	u.streams++
+	return u, func() {
+		l.mu.Lock()
+		u.streams--
+		l.mu.Unlock()
+	}
+}
+
+func (l *limiter) lookup(addr net.Addr) *usage {
+	key := addr.String()
+	if ua, ok := addr.(*net.UDPAddr); ok {
+		key = ua.IP.String()
+	}
+	u, exists := l.clients[key]
+	if !exists {
+		u = &usage{}
+		l.init(key, u)
+		l.clients[key] = u
+	}
+	return u
+}
+
+func (l *limiter) run(ctx context.Context) {
+	save := time.NewTicker(time.Minute)
+	defer save.Stop()
+	// The report interval is re-read after every report so reloads apply.
+	report := time.NewTimer(l.reportInterval())
+	defer report.Stop()
+
+	for {
+		select {
+		case <-save.C:
+			l.evict(time.Now())
+			l.save()
+		case <-report.C:
+			if l.config().Report > 0 {
+				l.report()
+			}
+			report.Reset(l.reportInterval())
+		case <-ctx.Done():
+			l.report()
+			l.save()
+			return
+		}
+	}
+}
+
+func (l *limiter) reportInterval() time.Duration {
+	if r := l.config().Report; r > 0 {
+		return time.Duration(r) * time.Second
+	}
+	// Reporting is disabled; check again later in case a reload enables it.
+	return time.Minute
+}
+
+// evict forgets clients without a quota or open streams that have been idle
+// for idleEvict.
+func (l *limiter) evict(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for addr, u := range l.clients {
+		if u.streams > 0 {
+			continue
+		}
+		u.mu.Lock()
+		idle := u.limit.Daily == 0 && u.limit.Monthly == 0 && now.Sub(u.last) > idleEvict
+		u.mu.Unlock()
+		if idle {
+			delete(l.clients, addr)
+		}
+	}
+}
+
+func (l *limiter) save() {
+	l.mu.Lock()
+	state := l.cfg.State
+	if state == "" {
+		l.mu.Unlock()
+		return
+	}
+	for _, u := range l.clients {
+		u.mu.Lock()
+	}
+	data, err := json.MarshalIndent(l.clients, "", "  ")
+	for _, u := range l.clients {
+		u.mu.Unlock()
+	}
+	l.mu.Unlock()
+	if err != nil {
+		log.Errorf("failed to encode quota state: %v", err)
+		return
+	}
+
+	tmp := state + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Errorf("failed to write quota state %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, state); err != nil {
+		log.Errorf("failed to replace quota state %s: %v", state, err)
+	}
+}
+
+func (l *limiter) report() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, u := range l.clients {
+		u.mu.Lock()
+		if u.sent != 0 || u.recv != 0 {
+			log.Infof("client %s usage: up %d bytes, down %d bytes, today %d/%d bytes, this month %d/%d bytes",
+				u.addr, u.sent, u.recv, u.DayBytes, u.limit.Daily, u.MonthBytes, u.limit.Monthly)
+			u.sent, u.recv = 0, 0
+		}
+		u.mu.Unlock()
+	}
+}
+
+func (u *usage) check() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.last = time.Now()
+	u.rollover(u.last)
+	if u.limit.Daily > 0 && u.DayBytes >= u.limit.Daily {
+		return errQuota
+	}
+	if u.limit.Monthly > 0 && u.MonthBytes >= u.limit.Monthly {
+		return errQuota
+	}
+	return nil
+}
+
+func (u *usage) add(n int, upload bool) error {
+	u.mu.Lock()
+	u.last = time.Now()
+	u.rollover(u.last)
+	u.DayBytes += int64(n)
+	u.MonthBytes += int64(n)
+	if upload {
+		u.sent += int64(n)
+	} else {
+		u.recv += int64(n)
+	}
+	exceeded := (u.limit.Daily > 0 && u.DayBytes > u.limit.Daily) || (u.limit.Monthly > 0 && u.MonthBytes > u.limit.Monthly)
+	u.mu.Unlock()
+
+	if exceeded {
+		return errQuota
+	}
+	if upload {
+		u.up.Wait(n)
+	} else {
+		u.down.Wait(n)
+	}
+	return nil
+}
+
+func (u *usage) rollover(now time.Time) {
+	if day := now.Format(time.DateOnly); u.Day != day {
+		u.Day, u.DayBytes = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthBytes = month, 0
+	}
+}
+
+// reader accounts everything read through r to the client, in the upload
+// direction when upload is set.
+func (u *usage) reader(r io.Reader, upload bool) io.Reader {
+	return &meteredReader{r: r, u: u, upload: upload}
+}
+
+type meteredReader struct {
+	r      io.Reader
+	u      *usage
+	upload bool
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 {
+		if qerr := m.u.add(n, m.upload); qerr != nil {
+			return n, qerr
+		}
+	}
+	return n, err
+}
@@ -1,18 +1,17 @@
 package server
 
 import (
-	"paqet/internal/flog"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 )
 
 func (s *Server) handlePing(strm tnet.Strm) error {
-	flog.Debugf("accepted ping on stream %d from %s", strm.SID(), strm.RemoteAddr())
+	log.Debugf("accepted ping on stream %d from %s", strm.SID(), strm.RemoteAddr())
 	p := protocol.Proto{Type: protocol.PPONG}
 	if err := p.Write(strm); err != nil {
-		flog.Errorf("failed to send pong on stream %d: %v", strm.SID(), err)
+		log.Errorf("failed to send pong on stream %d: %v", strm.SID(), err)
 		return err
 	}
-	flog.Debugf("sent pong on stream %d", strm.SID())
+	log.Debugf("sent pong on stream %d", strm.SID())
 	return nil
 }
@@ -0,0 +1,13 @@
+package server
+
+import "github.com/starco76/paqet/internal/conf"
+
+// SetACL replaces the destination policy; streams already open are not affected.
+func (s *Server) SetACL(acl *conf.ACL) {
+	s.acl.Store(acl)
+}
+
+// SetLimits replaces the per-client limits, keeping the usage counted so far.
+func (s *Server) SetLimits(limits *conf.Limits) {
+	s.limits.update(limits)
+}
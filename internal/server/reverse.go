@@ -0,0 +1,342 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/pkg/hash"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type reverseListener struct {
+	key      string
+	owner    string
+	network  string
+	addr     *tnet.Addr
+	ptype    protocol.PType
+	listener io.Closer
+	inbound  *metrics.Inbound
+	conns    []tnet.Conn
+	index    int
+	mu       sync.Mutex
+}
+
+func (s *Server) handleReverse(ctx context.Context, conn tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	if p.Addr != nil && !s.cfg.ReverseBind.Allows(p.Addr) {
+		err := fmt.Errorf("%w: %s is not allowed by reverse_bind", errDenied, p.Addr)
+		log.Warnf("rejected reverse listener %s for %s: %v", p.Addr, conn.RemoteAddr(), err)
+		s.writeResult(strm, err)
+		return err
+	}
+	rl, err := s.bindReverse(ctx, conn, p)
+	if err != nil {
+		log.Errorf("failed to bind reverse listener %s for %s: %v", p.Addr, conn.RemoteAddr(), err)
+		s.writeResult(strm, err)
+		return err
+	}
+	defer s.unbindReverse(rl, conn)
+	log.Infof("reverse %s listener %s bound to %s", rl.network, rl.addr, conn.RemoteAddr())
+	if err := s.writeResult(strm, nil); err != nil {
+		return err
+	}
+
+	// The registration stream stays open for as long as the client wants the listener.
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, strm)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	log.Debugf("reverse %s listener %s released by %s", rl.network, rl.addr, conn.RemoteAddr())
+	return nil
+}
+
+func (s *Server) bindReverse(ctx context.Context, conn tnet.Conn, p *protocol.Proto) (*reverseListener, error) {
+	if p.Addr == nil {
+		return nil, fmt.Errorf("reverse listen address is required")
+	}
+	network := "tcp"
+	if p.Type == protocol.PRUDP {
+		network = "udp"
+	}
+	key := network + "/" + p.Addr.String()
+	// A client registers on each of its connections and its listeners are
+	// shared among them, but not with other clients. Clients that predate
+	// owner IDs are told apart by IP address.
+	owner := p.Msg
+	if owner == "" {
+		owner, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	}
+
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	rl, exists := s.reverse[key]
+	if exists && rl.owner != owner {
+		return nil, fmt.Errorf("reverse %s listener %s is in use by another client", network, p.Addr)
+	}
+	if !exists {
+		// Bind addresses come from clients, so listeners share one set of
+		// metrics per network rather than adding a label per address.
+		rl = &reverseListener{key: key, owner: owner, network: network, addr: p.Addr, ptype: p.Type, inbound: metrics.NewInbound(s.cfg.Label("reverse/" + network))}
+		switch network {
+		case "tcp":
+			l, err := net.Listen("tcp", p.Addr.String())
+			if err != nil {
+				return nil, err
+			}
+			rl.listener = l
+			s.wg.Go(func() {
+				s.acceptReverseTCP(ctx, rl, l)
+			})
+		case "udp":
+			laddr, err := net.ResolveUDPAddr("udp", p.Addr.String())
+			if err != nil {
+				return nil, err
+			}
+			l, err := net.ListenUDP("udp", laddr)
+			if err != nil {
+				return nil, err
+			}
+			rl.listener = l
+			s.wg.Go(func() {
+				s.serveReverseUDP(ctx, rl, l)
+			})
+		}
+		s.reverse[key] = rl
+		log.Infof("reverse %s listener started on %s", network, p.Addr)
+	}
+
+	rl.mu.Lock()
+	rl.conns = append(rl.conns, conn)
+	rl.mu.Unlock()
+	return rl, nil
+}
+
+func (s *Server) unbindReverse(rl *reverseListener, conn tnet.Conn) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+
+	rl.mu.Lock()
+	for i, c := range rl.conns {
+		if c == conn {
+			rl.conns = append(rl.conns[:i], rl.conns[i+1:]...)
+			break
+		}
+	}
+	remaining := len(rl.conns)
+	rl.mu.Unlock()
+
+	if remaining == 0 {
+		rl.listener.Close()
+		delete(s.reverse, rl.key)
+		log.Infof("reverse %s listener on %s stopped", rl.network, rl.addr)
+	}
+}
+
+func (rl *reverseListener) openStrm() (tnet.Strm, error) {
+	rl.mu.Lock()
+	if len(rl.conns) == 0 {
+		rl.mu.Unlock()
+		return nil, fmt.Errorf("no client bound to reverse listener %s", rl.addr)
+	}
+	rl.index = (rl.index + 1) % len(rl.conns)
+	conn := rl.conns[rl.index]
+	rl.mu.Unlock()
+
+	strm, err := conn.OpenStrm()
+	if err != nil {
+		return nil, err
+	}
+	p := protocol.Proto{Type: rl.ptype, Addr: rl.addr}
+	if err := p.Write(strm); err != nil {
+		strm.Close()
+		return nil, err
+	}
+	if rl.ptype == protocol.PRUDP {
+		return conn.Packet(strm), nil
+	}
+	return strm, nil
+}
+
+func (s *Server) acceptReverseTCP(ctx context.Context, rl *reverseListener, listener net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Running out of file descriptors fails every Accept until one
+			// is freed, so back off as net/http does.
+			delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+			log.Errorf("failed to accept reverse TCP connection on %s, retrying in %s: %v", rl.addr, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		delay = 0
+
+		s.wg.Go(func() {
+			defer conn.Close()
+			if err := s.handleReverseTCP(ctx, rl, conn); err != nil {
+				log.Errorf("reverse TCP connection %s -> %s closed with error: %v", conn.RemoteAddr(), rl.addr, err)
+			} else {
+				log.Debugf("reverse TCP connection %s -> %s closed", conn.RemoteAddr(), rl.addr)
+			}
+		})
+	}
+}
+
+func (s *Server) handleReverseTCP(ctx context.Context, rl *reverseListener, conn net.Conn) error {
+	strm, err := rl.openStrm()
+	if err != nil {
+		log.Errorf("failed to open reverse stream for %s -> %s: %v", conn.RemoteAddr(), rl.addr, err)
+		rl.inbound.Fail()
+		return err
+	}
+	defer strm.Close()
+	ms := rl.inbound.Open("tcp", conn.RemoteAddr().String(), rl.addr.String(), strm.SID(), strm)
+	defer ms.Close()
+	log.Infof("accepted reverse TCP connection %s -> %s on stream %d", conn.RemoteAddr(), rl.addr, strm.SID())
+	u, release := s.limits.hold(strm.RemoteAddr())
+	defer release()
+
+	errChan := make(chan error, 2)
+	go func() {
+		err := buffer.CopyT(conn, ms.Up(u.reader(strm, true)))
+		errChan <- err
+	}()
+	go func() {
+		err := buffer.CopyT(strm, ms.Down(u.reader(conn, false)))
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		ms.End(err)
+		if err != nil {
+			log.Errorf("reverse TCP stream %d for %s failed: %v", strm.SID(), rl.addr, err)
+			return err
+		}
+	case <-ctx.Done():
+		ms.End(ctx.Err())
+	}
+	return nil
+}
+
+func (s *Server) serveReverseUDP(ctx context.Context, rl *reverseListener, conn *net.UDPConn) {
+	type flow struct {
+		strm tnet.Strm
+		ms   *metrics.Stream
+	}
+	flows := make(map[uint64]*flow)
+	var mu sync.Mutex
+	defer func() {
+		mu.Lock()
+		for _, f := range flows {
+			f.strm.Close()
+		}
+		mu.Unlock()
+	}()
+
+	bufp := buffer.UPool.Get().(*[]byte)
+	defer buffer.UPool.Put(bufp)
+	buf := *bufp
+
+	for {
+		n, caddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Errorf("failed to read reverse UDP packet on %s: %v", rl.addr, err)
+			continue
+		}
+
+		key := hash.IPAddr(caddr.IP, uint16(caddr.Port))
+		mu.Lock()
+		f, exists := flows[key]
+		mu.Unlock()
+		if !exists {
+			strm, err := rl.openStrm()
+			if err != nil {
+				log.Errorf("failed to open reverse UDP stream for %s -> %s: %v", caddr, rl.addr, err)
+				rl.inbound.Fail()
+				continue
+			}
+			f = &flow{strm: strm, ms: rl.inbound.Open("udp", caddr.String(), rl.addr.String(), strm.SID(), strm)}
+			mu.Lock()
+			flows[key] = f
+			mu.Unlock()
+			log.Infof("accepted reverse UDP connection %s -> %s on stream %d", caddr, rl.addr, strm.SID())
+
+			s.wg.Go(func() {
+				defer func() {
+					mu.Lock()
+					delete(flows, key)
+					mu.Unlock()
+					f.strm.Close()
+					f.ms.Close()
+					log.Debugf("reverse UDP stream %d closed for %s -> %s", f.strm.SID(), caddr, rl.addr)
+				}()
+				s.relayReverseUDP(ctx, f.ms, f.strm, conn, caddr)
+			})
+		}
+
+		if err := s.limits.get(f.strm.RemoteAddr()).add(n, false); err != nil {
+			log.Debugf("dropped %d bytes from %s -> %s: %v", n, caddr, rl.addr, err)
+			continue
+		}
+		f.ms.AddDown(n)
+		if _, err := f.strm.Write(buf[:n]); err != nil {
+			log.Errorf("failed to forward %d bytes from %s -> %s: %v", n, caddr, rl.addr, err)
+			f.ms.End(err)
+			f.strm.Close()
+		}
+	}
+}
+
+func (s *Server) relayReverseUDP(ctx context.Context, ms *metrics.Stream, strm tnet.Strm, conn *net.UDPConn, caddr *net.UDPAddr) {
+	u, release := s.limits.hold(strm.RemoteAddr())
+	defer release()
+	r := ms.Up(u.reader(strm, true))
+	bufp := buffer.UPool.Get().(*[]byte)
+	defer buffer.UPool.Put(bufp)
+	buf := *bufp
+
+	for {
+		select {
+		case <-ctx.Done():
+			ms.End(ctx.Err())
+			return
+		default:
+		}
+		strm.SetReadDeadline(time.Now().Add(8 * time.Second))
+		n, err := r.Read(buf)
+		strm.SetReadDeadline(time.Time{})
+		if err != nil {
+			log.Debugf("reverse UDP stream %d read error for %s: %v", strm.SID(), caddr, err)
+			ms.End(err)
+			return
+		}
+		if _, err := conn.WriteToUDP(buf[:n], caddr); err != nil {
+			log.Errorf("failed to write reverse UDP response %d bytes to %s: %v", n, caddr, err)
+			ms.End(err)
+			return
+		}
+	}
+}
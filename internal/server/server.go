@@ -3,62 +3,98 @@ package server
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/signal"
 	"sync"
-	"syscall"
+	"sync/atomic"
 
-	"paqet/internal/conf"
-	"paqet/internal/flog"
-	"paqet/internal/socket"
-	"paqet/internal/tnet"
-	"paqet/internal/tnet/kcp"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/outbound"
+	"github.com/starco76/paqet/internal/resolver"
+	"github.com/starco76/paqet/internal/socket"
+	"github.com/starco76/paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet/transport"
 )
 
+var log = flog.New("server")
+
 type Server struct {
-	cfg   *conf.Conf
-	pConn *socket.PacketConn
-	wg    sync.WaitGroup
+	cfg      *conf.Conf
+	acl      atomic.Pointer[conf.ACL]
+	pConn    *socket.PacketConn
+	limits   *limiter
+	outbound *outbound.Router
+	reverse  map[string]*reverseListener
+	rmu      sync.Mutex
+	conns    map[int]tnet.Conn
+	connID   int
+	cmu      sync.Mutex
+	tcpIn    *metrics.Inbound
+	udpIn    *metrics.Inbound
+	hooks    Hooks
+	services map[string]handler
+	smu      sync.Mutex
+	wg       sync.WaitGroup
 }
 
 func New(cfg *conf.Conf) (*Server, error) {
 	s := &Server{
-		cfg: cfg,
+		cfg:      cfg,
+		limits:   newLimiter(&cfg.Limits),
+		reverse:  make(map[string]*reverseListener),
+		conns:    make(map[int]tnet.Conn),
+		services: make(map[string]handler),
+		tcpIn:    metrics.NewInbound(cfg.Label("tcp")),
+		udpIn:    metrics.NewInbound(cfg.Label("udp")),
+	}
+	s.acl.Store(&cfg.ACL)
+	res, err := resolver.New(&cfg.Resolver)
+	if err != nil {
+		return nil, err
 	}
+	router, err := outbound.New(&cfg.Outbound, s.checkACL, res)
+	if err != nil {
+		return nil, err
+	}
+	s.outbound = router
+	s.registerServices()
 
 	return s, nil
 }
 
-func (s *Server) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sig
-		flog.Infof("Shutdown signal received, initiating graceful shutdown...")
-		cancel()
-	}()
-
-	pConn, err := socket.New(ctx, &s.cfg.Network)
+// Start serves until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	pConn, err := socket.Listen(ctx, &s.cfg.Network)
 	if err != nil {
-		return fmt.Errorf("could not create raw packet conn: %w", err)
+		return fmt.Errorf("could not create packet conn: %w", err)
+	}
+	if raw, ok := pConn.(*socket.PacketConn); ok {
+		s.pConn = raw
+		metrics.OnCollect(func() {
+			metrics.SetSocket(s.cfg.Label("server"), raw.Stats())
+		})
 	}
-	s.pConn = pConn
 
-	listener, err := kcp.Listen(s.cfg.Transport.KCP, pConn)
+	listener, err := transport.Listen(&s.cfg.Transport, pConn)
 	if err != nil {
-		return fmt.Errorf("could not start KCP listener: %w", err)
+		return fmt.Errorf("could not start %s listener: %w", s.cfg.Transport.Protocol, err)
 	}
 	defer listener.Close()
-	flog.Infof("Server started - listening for packets on :%d", s.cfg.Listen.Addr.Port)
+	if s.cfg.Listen.Addr != nil {
+		log.Infof("Server started - listening for packets on :%d (%s)", s.cfg.Listen.Addr.Port, s.cfg.Network.Carrier)
+	} else {
+		log.Infof("Server started - listening for packets on %s", listener.Addr())
+	}
 
+	s.wg.Go(func() {
+		s.limits.run(ctx)
+	})
 	s.wg.Go(func() {
 		s.listen(ctx, listener)
 	})
 
 	s.wg.Wait()
-	flog.Infof("Server shutdown completed")
+	log.Infof("Server shutdown completed")
 	return nil
 }
 
@@ -75,12 +111,21 @@ func (s *Server) listen(ctx context.Context, listener tnet.Listener) {
 		}
 		conn, err := listener.Accept()
 		if err != nil {
-			flog.Errorf("failed to accept connection: %v", err)
+			log.Errorf("failed to accept connection: %v", err)
 			continue
 		}
-		flog.Infof("accepted new connection from %s (local: %s)", conn.RemoteAddr(), conn.LocalAddr())
+		if s.hooks.Accept != nil {
+			if err := s.hooks.Accept(conn.RemoteAddr()); err != nil {
+				log.Warnf("rejected connection from %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				continue
+			}
+		}
+		log.Infof("accepted new connection from %s (local: %s)", conn.RemoteAddr(), conn.LocalAddr())
+		id := s.addConn(conn)
 
 		s.wg.Go(func() {
+			defer s.removeConn(id)
 			defer conn.Close()
 			s.handleConn(ctx, conn)
 		})
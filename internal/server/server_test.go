@@ -0,0 +1,842 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/bench"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/outbound"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/resolver"
+	"github.com/starco76/paqet/internal/socket"
+	"github.com/starco76/paqet/internal/tnet"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func rule(cidr string, ports ...int) conf.ACLRule {
+	r := conf.ACLRule{}
+	if cidr != "" {
+		r.CIDR = []netip.Prefix{netip.MustParsePrefix(cidr)}
+	}
+	for _, p := range ports {
+		r.Ports = append(r.Ports, conf.PortRange{From: p, To: p})
+	}
+	return r
+}
+
+func TestCheckACL(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name string
+		acl  conf.ACL
+		host string
+		ip   string
+		port int
+		deny bool
+	}{
+		{"default blocks loopback", conf.ACL{BlockPrivate: &on}, "", "127.0.0.1", 80, true},
+		{"default blocks private", conf.ACL{BlockPrivate: &on}, "", "10.0.0.1", 80, true},
+		{"default blocks mapped private", conf.ACL{BlockPrivate: &on}, "", "::ffff:192.168.1.1", 80, true},
+		{"default allows public", conf.ACL{BlockPrivate: &on}, "", "192.0.2.1", 80, false},
+		{"block_private off", conf.ACL{BlockPrivate: &off}, "", "127.0.0.1", 80, false},
+		{"unresolved is undecided", conf.ACL{BlockPrivate: &on}, "example.com", "", 80, false},
+		{"allow overrides block_private", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{rule("10.1.0.0/16")}}, "", "10.1.2.3", 80, false},
+		{"ports-only allow keeps block_private", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{rule("", 80, 443)}}, "", "127.0.0.1", 80, true},
+		{"ports-only allow keeps metadata blocked", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{rule("", 80)}}, "", "169.254.169.254", 80, true},
+		{"ports-only allow admits public", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{rule("", 80, 443)}}, "", "192.0.2.1", 443, false},
+		{"domain allow keeps block_private", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{{Domain: []string{"internal.example"}}}}, "internal.example", "10.0.0.1", 80, true},
+		{"later cidr allow overrides", conf.ACL{BlockPrivate: &on, Allow: []conf.ACLRule{rule("", 80), rule("10.0.0.0/8")}}, "", "10.0.0.1", 80, false},
+		{"default blocks shared range", conf.ACL{BlockPrivate: &on}, "", "100.64.1.1", 80, true},
+		{"default blocks this network", conf.ACL{BlockPrivate: &on}, "", "0.1.2.3", 80, true},
+		{"allow list denies the rest", conf.ACL{BlockPrivate: &off, Allow: []conf.ACLRule{rule("10.1.0.0/16")}}, "", "192.0.2.1", 80, true},
+		{"deny before allow", conf.ACL{BlockPrivate: &off, Allow: []conf.ACLRule{rule("10.0.0.0/8")}, Deny: []conf.ACLRule{rule("10.0.0.0/8", 22)}}, "", "10.0.0.1", 22, true},
+		{"deny before allow other port", conf.ACL{BlockPrivate: &off, Allow: []conf.ACLRule{rule("10.0.0.0/8")}, Deny: []conf.ACLRule{rule("10.0.0.0/8", 22)}}, "", "10.0.0.1", 80, false},
+		{"deny by port unresolved", conf.ACL{BlockPrivate: &off, Deny: []conf.ACLRule{rule("", 25)}}, "mail.example.com", "", 25, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			s.acl.Store(&tt.acl)
+			var ip netip.Addr
+			if tt.ip != "" {
+				ip = netip.MustParseAddr(tt.ip)
+			}
+			err := s.checkACL(tt.host, ip, tt.port)
+			if got := errors.Is(err, errDenied); got != tt.deny {
+				t.Errorf("checkACL(%q, %v, %d) = %v, want denied %v", tt.host, ip, tt.port, err, tt.deny)
+			}
+		})
+	}
+}
+
+func TestLimiterEvict(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(&conf.Limits{})
+	for addr, last := range map[string]time.Time{
+		"192.0.2.1": now.Add(-2 * idleEvict),
+		"192.0.2.2": now.Add(-idleEvict / 2),
+		"192.0.2.3": now.Add(-2 * idleEvict),
+		"192.0.2.4": now.Add(-2 * idleEvict),
+	} {
+		u := l.get(&net.UDPAddr{IP: net.ParseIP(addr)})
+		u.last = last
+	}
+	l.clients["192.0.2.3"].limit.Daily = 1 << 30
+	// A client with a stream open is kept however long it has been quiet.
+	held, release := l.hold(&net.UDPAddr{IP: net.ParseIP("192.0.2.4")})
+
+	l.evict(now)
+	for addr, kept := range map[string]bool{"192.0.2.1": false, "192.0.2.2": true, "192.0.2.3": true, "192.0.2.4": true} {
+		if _, ok := l.clients[addr]; ok != kept {
+			t.Errorf("client %s kept = %v, want %v", addr, ok, kept)
+		}
+	}
+	if u := l.get(&net.UDPAddr{IP: net.ParseIP("192.0.2.4")}); u != held {
+		t.Errorf("open stream and new lookup account to different clients")
+	}
+
+	release()
+	l.evict(now)
+	if _, ok := l.clients["192.0.2.4"]; ok {
+		t.Errorf("client 192.0.2.4 kept after its stream closed")
+	}
+}
+
+func TestDialHookACL(t *testing.T) {
+	on := true
+	res, err := resolver.New(&conf.Resolver{Hosts: map[string][]netip.Addr{
+		"internal.test": {netip.MustParseAddr("10.0.0.5")},
+		"public.test":   {netip.MustParseAddr("192.0.2.1")},
+		"mixed.test":    {netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("127.0.0.1")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		deny bool
+	}{
+		{"192.0.2.1:80", false},
+		{"10.0.0.1:80", true},
+		{"public.test:80", false},
+		{"internal.test:80", true},
+		{"mixed.test:80", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			s := &Server{}
+			s.acl.Store(&conf.ACL{BlockPrivate: &on})
+			router, err := outbound.New(&conf.Outbound{Default: "direct", Dialers: []conf.Dialer{{Name: "direct", Type: "direct"}}}, s.checkACL, res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.outbound = router
+			called := false
+			s.hooks.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				called = true
+				return nil, errors.New("hook")
+			}
+
+			_, err = s.dial(context.Background(), "tcp", tt.addr)
+			if denied := errors.Is(err, errDenied); denied != tt.deny {
+				t.Errorf("dial(%s) error = %v, want denied %v", tt.addr, err, tt.deny)
+			}
+			if called == tt.deny {
+				t.Errorf("hook called = %v, want %v", called, !tt.deny)
+			}
+		})
+	}
+}
+
+// loadConf writes yaml to a file and loads it.
+func loadConf(t *testing.T, yaml string) *conf.Conf {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "paqet.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := conf.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+var initBuffers sync.Once
+
+// setup is the carrier and transport both ends of a test run on.
+type setup struct {
+	carrier  string
+	protocol string
+	datagram bool
+}
+
+var kcpUDP = setup{carrier: "udp", protocol: "kcp"}
+
+func (s setup) String() string {
+	name := s.carrier + "/" + s.protocol
+	if s.datagram {
+		name += "/datagram"
+	}
+	return name
+}
+
+func (s setup) yaml() string {
+	return fmt.Sprintf(`network:
+  carrier: %q
+transport:
+  protocol: %q
+  %s:
+    key: "secret"
+    datagram: %v
+`, s.carrier, s.protocol, s.protocol, s.datagram)
+}
+
+// startServer runs a server on a loopback carrier with extra appended to
+// its config, and returns the address clients should dial.
+func startServer(t *testing.T, su setup, extra string) (*Server, string) {
+	t.Helper()
+	initBuffers.Do(func() {
+		flog.SetLevel(int(flog.None))
+		buffer.Initialize(32*1024, 4096)
+	})
+	// The carrier is opened here, so that its port is known before the
+	// server starts.
+	var pc net.PacketConn
+	var err error
+	lo := &conf.Network{IPv4: conf.Addr{Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}}
+	if su.carrier == "tcp-stream" {
+		pc, err = socket.ListenStream(context.Background(), lo)
+	} else {
+		pc, err = net.ListenUDP("udp", lo.IPv4.Addr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	cfg := loadConf(t, fmt.Sprintf(`role: "server"
+listen:
+  addr: ":%d"
+acl:
+  block_private: false
+%s%s`, addr.Port, su.yaml(), extra))
+	cfg.Network.PacketConn = func(ctx context.Context) (net.PacketConn, error) { return pc, nil }
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.Start(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, addr.String()
+}
+
+// startClient runs a client of the server at addr with extra appended to
+// its config.
+func startClient(t *testing.T, addr string, su setup, extra string) *client.Client {
+	t.Helper()
+	cfg := loadConf(t, fmt.Sprintf(`role: "client"
+server:
+  addr: "%s"
+%s%s`, addr, su.yaml(), extra))
+	c, err := client.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// nameServer answers every TCP connection with name and every UDP packet
+// with name followed by the packet.
+func nameServer(t *testing.T, name string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(name))
+			conn.Close()
+		}
+	}()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte(name), buf[:n]...), from)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// reach retries until the TCP or UDP reverse listener on port answers with
+// want, waiting out registration and reconnection.
+func reach(t *testing.T, network string, port int, want string) {
+	t.Helper()
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	var got string
+	var err error
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		got, err = exchange(network, addr)
+		if err == nil && got == want {
+			return
+		}
+	}
+	t.Fatalf("%s %s answered %q, %v; want %q", network, addr, got, err, want)
+}
+
+func exchange(network, addr string) (string, error) {
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if network == "tcp" {
+		b, err := io.ReadAll(conn)
+		return string(b), err
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return "", err
+	}
+	b := make([]byte, 2048)
+	n, err := conn.Read(b)
+	return string(b[:n]), err
+}
+
+func reverseBind(ports ...int) string {
+	s := "reverse_bind:\n  allow:\n"
+	for _, p := range ports {
+		s += fmt.Sprintf("    - cidr: [\"127.0.0.1/32\"]\n      ports: [%d]\n", p)
+	}
+	return s
+}
+
+func reverse(network string, port int, target string) string {
+	return fmt.Sprintf("  - listen: \"127.0.0.1:%d\"\n    target: \"%s\"\n    protocol: \"%s\"\n", port, target, network)
+}
+
+func TestReverse(t *testing.T) {
+	tcpPort, udpPort, deniedPort := freePort(t), freePort(t), freePort(t)
+	s, addr := startServer(t, kcpUDP, reverseBind(tcpPort, udpPort))
+	target := nameServer(t, "one")
+	startClient(t, addr, kcpUDP, "reverse:\n"+reverse("tcp", tcpPort, target)+reverse("udp", udpPort, target)+reverse("tcp", deniedPort, target))
+
+	reach(t, "tcp", tcpPort, "one")
+	reach(t, "udp", udpPort, "oneping")
+	s.rmu.Lock()
+	_, bound := s.reverse[fmt.Sprintf("tcp/127.0.0.1:%d", deniedPort)]
+	s.rmu.Unlock()
+	if bound {
+		t.Errorf("listener outside reverse_bind was bound")
+	}
+	if _, err := exchange("tcp", fmt.Sprintf("127.0.0.1:%d", deniedPort)); err == nil {
+		t.Errorf("port outside reverse_bind accepted a connection")
+	}
+}
+
+func TestReverseOwner(t *testing.T) {
+	port := freePort(t)
+	s, addr := startServer(t, kcpUDP, reverseBind(port))
+	c := startClient(t, addr, kcpUDP, "reverse:\n"+reverse("tcp", port, nameServer(t, "one")))
+	reach(t, "tcp", port, "one")
+
+	// Another client asking for the same listener is refused, so
+	// connections keep going to the first.
+	startClient(t, addr, kcpUDP, "reverse:\n"+reverse("tcp", port, nameServer(t, "two")))
+	time.Sleep(500 * time.Millisecond)
+	for range 10 {
+		if got, err := exchange("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err != nil || got != "one" {
+			t.Fatalf("reverse listener answered %q, %v; want %q", got, err, "one")
+		}
+	}
+	s.rmu.Lock()
+	owner := s.reverse[fmt.Sprintf("tcp/127.0.0.1:%d", port)].owner
+	s.rmu.Unlock()
+	if owner == "" {
+		t.Errorf("reverse listener has no owner")
+	}
+
+	// The first client registers again after losing a connection.
+	if err := c.CloseConn(1); err != nil {
+		t.Fatal(err)
+	}
+	reach(t, "tcp", port, "one")
+}
+
+type remoteConn struct {
+	tnet.Conn
+	addr net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr { return c.addr }
+
+func TestBindReverseOwner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{cfg: &conf.Conf{}, reverse: make(map[string]*reverseListener)}
+	laddr, err := tnet.NewAddr(fmt.Sprintf("127.0.0.1:%d", freePort(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := func(ip string) tnet.Conn {
+		return remoteConn{addr: &net.UDPAddr{IP: net.ParseIP(ip), Port: 40000}}
+	}
+
+	tests := []struct {
+		name  string
+		conn  tnet.Conn
+		owner string
+		fail  bool
+	}{
+		{"first owner", conn("192.0.2.1"), "a", false},
+		{"same owner", conn("192.0.2.2"), "a", false},
+		{"other owner", conn("192.0.2.1"), "b", true},
+		{"legacy client", conn("192.0.2.1"), "", true},
+	}
+	for _, tt := range tests {
+		_, err := s.bindReverse(ctx, tt.conn, &protocol.Proto{Type: protocol.PRTCP, Addr: laddr, Msg: tt.owner})
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: bindReverse error = %v, want failure %v", tt.name, err, tt.fail)
+		}
+	}
+	rl := s.reverse["tcp/"+laddr.String()]
+	if len(rl.conns) != 2 {
+		t.Errorf("listener has %d connections, want 2", len(rl.conns))
+	}
+	for _, c := range rl.conns {
+		s.unbindReverse(rl, c)
+	}
+
+	// Clients without IDs are told apart by address.
+	for _, ip := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2"} {
+		_, err := s.bindReverse(ctx, conn(ip), &protocol.Proto{Type: protocol.PRTCP, Addr: laddr})
+		if want := ip == "192.0.2.2"; (err != nil) != want {
+			t.Errorf("legacy client %s: bindReverse error = %v, want failure %v", ip, err, want)
+		}
+	}
+	rl = s.reverse["tcp/"+laddr.String()]
+	for _, c := range append([]tnet.Conn(nil), rl.conns...) {
+		s.unbindReverse(rl, c)
+	}
+	s.wg.Wait()
+}
+
+func echoServers(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], from)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	echo := echoServers(t)
+	for _, carrier := range []string{"udp", "tcp-stream"} {
+		for _, protocol := range []string{"kcp", "quic"} {
+			for _, datagram := range []bool{false, true} {
+				su := setup{carrier: carrier, protocol: protocol, datagram: datagram}
+				t.Run(su.String(), func(t *testing.T) {
+					_, addr := startServer(t, su, "")
+					c := startClient(t, addr, su, "")
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+
+					strm, err := c.TCP(ctx, echo)
+					if err != nil {
+						t.Fatalf("TCP: %v", err)
+					}
+					defer strm.Close()
+					strm.SetDeadline(time.Now().Add(10 * time.Second))
+					data := bytes.Repeat([]byte("tcp "), 64*1024)
+					go strm.Write(data)
+					got := make([]byte, len(data))
+					if _, err := io.ReadFull(strm, got); err != nil || !bytes.Equal(got, data) {
+						t.Fatalf("TCP echo: %v", err)
+					}
+
+					// UDP payloads keep their boundaries, whether they fit a
+					// datagram or not.
+					ustrm, _, key, err := c.UDP(ctx, "test", echo)
+					if err != nil {
+						t.Fatalf("UDP: %v", err)
+					}
+					defer c.CloseUDP(key)
+					for _, size := range []int{1, 1000, 3000} {
+						pkt := bytes.Repeat([]byte{byte(size)}, size)
+						if _, err := ustrm.Write(pkt); err != nil {
+							t.Fatal(err)
+						}
+						ustrm.SetReadDeadline(time.Now().Add(5 * time.Second))
+						buf := make([]byte, 4096)
+						n, err := ustrm.Read(buf)
+						if err != nil || !bytes.Equal(buf[:n], pkt) {
+							t.Fatalf("UDP echo of %d bytes returned %d bytes: %v", size, n, err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+const services = `services:
+  - name: "echo"
+  - name: "discard"
+  - name: "socks5"
+  - name: "http"
+`
+
+// service opens a stream to the named service, failing the test if the
+// server refuses it.
+func service(t *testing.T, c *client.Client, name string) tnet.Strm {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	strm, err := c.Service(ctx, name)
+	if err != nil {
+		t.Fatalf("Service(%s): %v", name, err)
+	}
+	t.Cleanup(func() { strm.Close() })
+	strm.SetDeadline(time.Now().Add(10 * time.Second))
+	return strm
+}
+
+func echoed(t *testing.T, rw io.ReadWriter, msg string) {
+	t.Helper()
+	if _, err := rw.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(rw, buf); err != nil || string(buf) != msg {
+		t.Fatalf("read %q, %v; want %q", buf, err, msg)
+	}
+}
+
+func TestServices(t *testing.T) {
+	echo := echoServers(t)
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	defer web.Close()
+	s, addr := startServer(t, kcpUDP, services)
+	s.Handle("hello", func(ctx context.Context, conn net.Conn) error {
+		_, err := fmt.Fprintf(conn, "hello %s", conn.RemoteAddr().(*net.UDPAddr).IP)
+		return err
+	})
+	c := startClient(t, addr, kcpUDP, "")
+
+	t.Run("echo", func(t *testing.T) {
+		echoed(t, service(t, c, "echo"), "over the echo service")
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		strm := service(t, c, "discard")
+		if _, err := strm.Write(make([]byte, 64*1024)); err != nil {
+			t.Fatal(err)
+		}
+		strm.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		if n, _ := strm.Read(make([]byte, 16)); n != 0 {
+			t.Errorf("discard service answered %d bytes", n)
+		}
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		b, err := io.ReadAll(service(t, c, "hello"))
+		if err != nil || string(b) != "hello 127.0.0.1" {
+			t.Errorf("hello service answered %q, %v", b, err)
+		}
+	})
+
+	t.Run("socks5", func(t *testing.T) {
+		strm := service(t, c, "socks5")
+		ap := netip.MustParseAddrPort(echo)
+		ip := ap.Addr().As4()
+		req := append([]byte{5, 1, 0, 5, 1, 0, 1}, ip[:]...)
+		req = append(req, byte(ap.Port()>>8), byte(ap.Port()))
+		if _, err := strm.Write(req); err != nil {
+			t.Fatal(err)
+		}
+		rep := make([]byte, 12)
+		if _, err := io.ReadFull(strm, rep); err != nil {
+			t.Fatal(err)
+		}
+		if rep[1] != 0 || rep[3] != 0 {
+			t.Fatalf("socks5 replies %v, want success", rep)
+		}
+		echoed(t, strm, "over socks5")
+	})
+
+	t.Run("http connect", func(t *testing.T) {
+		strm := service(t, c, "http")
+		fmt.Fprintf(strm, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", echo, echo)
+		br := bufio.NewReader(strm)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("CONNECT answered %v, %v", resp, err)
+		}
+		echoed(t, struct {
+			io.Reader
+			io.Writer
+		}{br, strm}, "over http connect")
+	})
+
+	t.Run("http get", func(t *testing.T) {
+		strm := service(t, c, "http")
+		host := strings.TrimPrefix(web.URL, "http://")
+		fmt.Fprintf(strm, "GET http://%s/page HTTP/1.1\r\nHost: %s\r\nProxy-Connection: keep-alive\r\n\r\n", host, host)
+		resp, err := http.ReadResponse(bufio.NewReader(strm), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		if string(b) != "GET /page" {
+			t.Errorf("GET answered %q", b)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := c.Service(context.Background(), "missing"); err == nil {
+			t.Errorf("Service(missing) succeeded")
+		}
+	})
+}
+
+func inbound(name string) metrics.InboundInfo {
+	for _, in := range metrics.Inbounds() {
+		if in.Name == name {
+			return in
+		}
+	}
+	return metrics.InboundInfo{Name: name}
+}
+
+// The server accounts relayed bytes to the inbound the stream came in on.
+func TestMetrics(t *testing.T) {
+	echo := echoServers(t)
+	_, addr := startServer(t, kcpUDP, "")
+	c := startClient(t, addr, kcpUDP, "")
+	before := inbound("tcp")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	strm, err := c.TCP(ctx, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strm.SetDeadline(time.Now().Add(10 * time.Second))
+	msg := strings.Repeat("m", 10000)
+	echoed(t, strm, msg)
+	if active := inbound("tcp").Active - before.Active; active != 1 {
+		t.Errorf("%d streams active during the relay, want 1", active)
+	}
+	strm.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		after := inbound("tcp")
+		if after.Opened-before.Opened == 1 && after.Active == before.Active &&
+			after.Up-before.Up == int64(len(msg)) && after.Down-before.Down == int64(len(msg)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tcp inbound went from %+v to %+v after relaying %d bytes each way", before, after, len(msg))
+		}
+	}
+}
+
+// TestAdmin runs the commands the control API forwards against a real
+// client and server.
+func TestAdmin(t *testing.T) {
+	echo := echoServers(t)
+	s, addr := startServer(t, kcpUDP, "")
+	c := startClient(t, addr, kcpUDP, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	relay := func() tnet.Strm {
+		t.Helper()
+		strm, err := c.TCP(ctx, echo)
+		if err != nil {
+			t.Fatalf("TCP: %v", err)
+		}
+		t.Cleanup(func() { strm.Close() })
+		strm.SetDeadline(time.Now().Add(10 * time.Second))
+		echoed(t, strm, "admin")
+		return strm
+	}
+
+	// Killing a stream ends its relay on both sides.
+	strm := relay()
+	var id uint64
+	for _, st := range metrics.Streams() {
+		if st.Inbound == "tcp" && st.Target == echo {
+			id = st.ID
+		}
+	}
+	if err := metrics.Kill(id); err != nil {
+		t.Fatalf("Kill(%d): %v", id, err)
+	}
+	if _, err := strm.Read(make([]byte, 1)); err == nil {
+		t.Errorf("stream still open after Kill")
+	}
+	strm.Close()
+
+	_, _, key, err := c.UDP(ctx, "admin", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := c.UDPSessions(); len(sessions) != 1 || sessions[0].Key != key || sessions[0].Target != echo {
+		t.Errorf("UDPSessions() = %+v", sessions)
+	}
+	c.CloseUDP(key)
+
+	// A drained connection is replaced once its streams are gone.
+	before := c.Conns()
+	if len(before) != 1 || len(s.Conns()) != 1 {
+		t.Fatalf("client has %d connections and server %d, want 1 each", len(before), len(s.Conns()))
+	}
+	if err := c.DrainConn(before[0].ID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DrainConn(before[0].ID, time.Minute); err == nil {
+		t.Errorf("DrainConn accepted a connection already draining")
+	}
+	if conns := c.Conns(); len(conns) != 1 || !conns[0].Draining {
+		t.Errorf("Conns() = %+v while draining", conns)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		if conns := c.Conns(); len(conns) == 1 && !conns[0].Draining && conns[0].Local != before[0].Local {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection not re-established after draining: %+v", c.Conns())
+		}
+	}
+	relay()
+
+	// Closing the connection from the server makes the client reconnect.
+	if err := s.CloseConn(s.Conns()[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CloseConn(1000); err == nil {
+		t.Errorf("server closed an unknown connection")
+	}
+	relay()
+
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reconnect(); err == nil {
+		t.Errorf("server accepted Reconnect")
+	}
+	relay()
+}
+
+// TestBench measures both directions against a server's bench service, as
+// paqet bench does without --local.
+func TestBench(t *testing.T) {
+	_, addr := startServer(t, kcpUDP, "services:\n  - name: \"speed\"\n    type: \"bench\"\n")
+	c := startClient(t, addr, kcpUDP, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	open := func(mode string) (io.ReadWriteCloser, error) { return c.Bench(ctx, "speed", mode) }
+
+	opts := bench.Options{Streams: 2, Duration: 300 * time.Millisecond, Probe: 20 * time.Millisecond}
+	for _, dir := range []string{bench.Upload, bench.Download} {
+		res, err := bench.Run(open, dir, opts)
+		if err != nil {
+			t.Fatalf("Run(%s): %v", dir, err)
+		}
+		if res.Bytes == 0 || len(res.RTT) == 0 {
+			t.Errorf("%s moved %d bytes and sampled %d round trips", dir, res.Bytes, len(res.RTT))
+		}
+	}
+	if _, err := c.Bench(ctx, "missing", bench.Echo); err == nil {
+		t.Errorf("Bench against a missing service succeeded")
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/starco76/paqet/internal/bench"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+
+	"github.com/txthinking/socks5"
+)
+
+// Service handles a stream a client opened by name instead of asking the
+// server to dial. conn is the stream; its RemoteAddr is the client.
+type Service func(ctx context.Context, conn net.Conn) error
+
+type handler func(ctx context.Context, strm tnet.Strm) error
+
+// Handle makes svc available to clients under name, replacing any service
+// already registered with it.
+func (s *Server) Handle(name string, svc Service) {
+	s.register(name, s.metered(name, svc))
+}
+
+func (s *Server) register(name string, h handler) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	s.services[name] = h
+}
+
+func (s *Server) service(name string) handler {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	return s.services[name]
+}
+
+func (s *Server) registerServices() {
+	for _, svc := range s.cfg.Services {
+		switch svc.Type {
+		case "echo":
+			s.Handle(svc.Name, func(ctx context.Context, conn net.Conn) error {
+				_, err := io.Copy(conn, conn)
+				return err
+			})
+		case "discard":
+			s.Handle(svc.Name, func(ctx context.Context, conn net.Conn) error {
+				_, err := io.Copy(io.Discard, conn)
+				return err
+			})
+		case "socks5":
+			s.register(svc.Name, s.serveSOCKS5)
+		case "http":
+			s.register(svc.Name, s.serveHTTP)
+		case "bench":
+			s.Handle(svc.Name, func(ctx context.Context, conn net.Conn) error {
+				return bench.ServeStream(conn)
+			})
+		}
+	}
+}
+
+func (s *Server) handleService(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
+	h := s.service(p.Msg)
+	if h == nil {
+		err := fmt.Errorf("no service named '%s'", p.Msg)
+		log.Warnf("rejected service stream %d from %s: %v", strm.SID(), strm.RemoteAddr(), err)
+		s.writeResult(strm, err)
+		return err
+	}
+	if err := s.limits.get(strm.RemoteAddr()).check(); err != nil {
+		log.Warnf("rejected service stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), p.Msg, err)
+		s.writeResult(strm, err)
+		return err
+	}
+	if err := s.authorize(ctx, strm.RemoteAddr(), "service", p.Msg); err != nil {
+		log.Warnf("rejected service stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), p.Msg, err)
+		s.writeResult(strm, err)
+		return err
+	}
+	if err := s.writeResult(strm, nil); err != nil {
+		return err
+	}
+	log.Infof("accepted service stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Msg)
+	return h(ctx, strm)
+}
+
+// metered accounts a Service's traffic to the client like a relayed stream.
+// The built-in proxies skip it since the streams they relay are counted
+// already.
+func (s *Server) metered(name string, svc Service) handler {
+	in := metrics.NewInbound(s.cfg.Label("service/" + name))
+	return func(ctx context.Context, strm tnet.Strm) error {
+		u, release := s.limits.hold(strm.RemoteAddr())
+		defer release()
+		ms := in.Open("service", strm.RemoteAddr().String(), name, strm.SID(), strm)
+		defer ms.Close()
+		err := svc(ctx, &serviceConn{Strm: strm, r: ms.Up(u.reader(strm, true)), u: u, ms: ms})
+		ms.End(err)
+		return err
+	}
+}
+
+type serviceConn struct {
+	tnet.Strm
+	r  io.Reader
+	u  *usage
+	ms *metrics.Stream
+}
+
+func (c *serviceConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *serviceConn) Write(p []byte) (int, error) {
+	if err := c.u.add(len(p), false); err != nil {
+		return 0, err
+	}
+	n, err := c.Strm.Write(p)
+	c.ms.AddDown(n)
+	return n, err
+}
+
+// serveSOCKS5 speaks SOCKS5 without authentication on the stream and relays
+// CONNECT requests from the server.
+func (s *Server) serveSOCKS5(ctx context.Context, strm tnet.Strm) error {
+	neg, err := socks5.NewNegotiationRequestFrom(strm)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(neg.Methods, socks5.MethodNone) {
+		socks5.NewNegotiationReply(socks5.MethodUnsupportAll).WriteTo(strm)
+		return fmt.Errorf("socks5 client offered no supported authentication method")
+	}
+	if _, err := socks5.NewNegotiationReply(socks5.MethodNone).WriteTo(strm); err != nil {
+		return err
+	}
+	req, err := socks5.NewRequestFrom(strm)
+	if err != nil {
+		return err
+	}
+	if req.Cmd != socks5.CmdConnect {
+		socks5.NewReply(socks5.RepCommandNotSupported, socks5.ATYPIPv4, []byte{0, 0, 0, 0}, []byte{0, 0}).WriteTo(strm)
+		return fmt.Errorf("unsupported socks5 command %d", req.Cmd)
+	}
+	addr := req.Address()
+	log.Infof("accepted SOCKS5 request on stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), addr)
+	return s.handleTCP(ctx, strm, addr, func(err error) error {
+		rep := byte(socks5.RepSuccess)
+		switch {
+		case errors.Is(err, errDenied), errors.Is(err, errQuota):
+			rep = socks5.RepNotAllowed
+		case err != nil:
+			rep = socks5.RepHostUnreachable
+		}
+		_, werr := socks5.NewReply(rep, socks5.ATYPIPv4, []byte{0, 0, 0, 0}, []byte{0, 0}).WriteTo(strm)
+		return werr
+	})
+}
+
+// serveHTTP proxies the first HTTP request on the stream. A CONNECT is
+// tunnelled; any other request is forwarded to its host with the connection
+// set to close, and nothing after it is, so the client makes its next
+// request, perhaps to another host, on a new connection.
+func (s *Server) serveHTTP(ctx context.Context, strm tnet.Strm) error {
+	br := bufio.NewReader(strm)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return err
+	}
+	addr := req.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "80")
+	}
+	log.Infof("accepted HTTP %s request on stream %d: %s -> %s", req.Method, strm.SID(), strm.RemoteAddr(), addr)
+
+	if req.Method == http.MethodConnect {
+		return s.handleTCP(ctx, &bufferedStrm{Strm: strm, r: br}, addr, func(err error) error {
+			status := "200 Connection established"
+			switch {
+			case errors.Is(err, errDenied), errors.Is(err, errQuota):
+				status = "403 Forbidden"
+			case err != nil:
+				status = "502 Bad Gateway"
+			}
+			_, werr := fmt.Fprintf(strm, "HTTP/1.1 %s\r\n\r\n", status)
+			return werr
+		})
+	}
+
+	for _, h := range req.Header["Connection"] {
+		for _, name := range strings.Split(h, ",") {
+			req.Header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, h := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization"} {
+		req.Header.Del(h)
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Keeps Write from adding Go's own.
+		req.Header["User-Agent"] = nil
+	}
+	req.Close = true
+	// Write sends the request in origin form and reframes its body.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(req.Write(pw))
+	}()
+	r := io.MultiReader(pr, discardReader{br})
+	return s.handleTCP(ctx, &bufferedStrm{Strm: strm, r: r}, addr, func(err error) error {
+		if err == nil {
+			return nil
+		}
+		status := "502 Bad Gateway"
+		if errors.Is(err, errDenied) || errors.Is(err, errQuota) {
+			status = "403 Forbidden"
+		}
+		_, werr := fmt.Fprintf(strm, "HTTP/1.1 %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status)
+		return werr
+	})
+}
+
+// discardReader reads r until it fails without passing anything on, so a
+// relay reading it stays up until the client goes away.
+type discardReader struct {
+	r io.Reader
+}
+
+func (d discardReader) Read(p []byte) (int, error) {
+	for {
+		if _, err := d.r.Read(p); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// bufferedStrm reads what was buffered while parsing before the rest of
+// the stream.
+type bufferedStrm struct {
+	tnet.Strm
+	r io.Reader
+}
+
+func (b *bufferedStrm) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/starco76/paqet/internal/control"
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/tnet"
+	"slices"
+	"time"
+)
+
+func (s *Server) addConn(conn tnet.Conn) int {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	s.connID++
+	s.conns[s.connID] = conn
+	metrics.Connections.With().Inc()
+	return s.connID
+}
+
+func (s *Server) removeConn(id int) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	delete(s.conns, id)
+	metrics.Connections.With().Dec()
+}
+
+func (s *Server) Conns() []control.Conn {
+	s.cmu.Lock()
+	conns := make([]control.Conn, 0, len(s.conns))
+	for id, conn := range s.conns {
+		conns = append(conns, control.NewConn(id, conn))
+	}
+	s.cmu.Unlock()
+	slices.SortFunc(conns, func(a, b control.Conn) int { return cmp.Compare(a.ID, b.ID) })
+	return conns
+}
+
+func (s *Server) UDPSessions() []control.UDPSession {
+	return nil
+}
+
+func (s *Server) CloseConn(id int) error {
+	s.cmu.Lock()
+	conn, ok := s.conns[id]
+	s.cmu.Unlock()
+	if !ok {
+		return fmt.Errorf("connection %d not found", id)
+	}
+	log.Infof("closing connection %d from %s on control request", id, conn.RemoteAddr())
+	return conn.Close()
+}
+
+func (s *Server) DrainConn(id int, timeout time.Duration) error {
+	return fmt.Errorf("draining is only supported on the client")
+}
+
+func (s *Server) Reconnect() error {
+	return fmt.Errorf("reconnecting is only supported on the client")
+}
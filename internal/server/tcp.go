@@ -2,49 +2,72 @@ package server
 
 import (
 	"context"
-	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
-	"time"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 )
 
 func (s *Server) handleTCPProtocol(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
-	flog.Infof("accepted TCP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
-	return s.handleTCP(ctx, strm, p.Addr.String())
+	log.Infof("accepted TCP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
+	return s.handleTCP(ctx, strm, p.Addr.String(), func(err error) error { return s.writeResult(strm, err) })
 }
 
-func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string) error {
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+// handleTCP relays strm to addr. reply tells the client whether the
+// connection was made, in whatever protocol it asked with.
+func (s *Server) handleTCP(ctx context.Context, strm tnet.Strm, addr string, reply func(error) error) error {
+	u, release := s.limits.hold(strm.RemoteAddr())
+	defer release()
+	if err := u.check(); err != nil {
+		log.Warnf("rejected TCP stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), addr, err)
+		reply(err)
+		return err
+	}
+
+	if err := s.authorize(ctx, strm.RemoteAddr(), "tcp", addr); err != nil {
+		log.Warnf("rejected TCP stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), addr, err)
+		reply(err)
+		s.tcpIn.Fail()
+		return err
+	}
+	conn, err := s.dial(ctx, "tcp", addr)
 	if err != nil {
-		flog.Errorf("failed to establish TCP connection to %s for stream %d: %v", addr, strm.SID(), err)
+		log.Errorf("failed to establish TCP connection to %s for stream %d: %v", addr, strm.SID(), err)
+		reply(err)
+		s.tcpIn.Fail()
 		return err
 	}
+	ms := s.tcpIn.Open("tcp", strm.RemoteAddr().String(), addr, strm.SID(), strm)
+	defer ms.Close()
+	ms.SetResolved(conn.RemoteAddr().String())
+	log := log.With("stream", ms.ID, "sid", strm.SID(), "src", strm.RemoteAddr(), "dst", addr)
 	defer func() {
 		conn.Close()
-		flog.Debugf("closed TCP connection %s for stream %d", addr, strm.SID())
+		log.Debugf("closed TCP connection")
 	}()
-	flog.Debugf("TCP connection established to %s for stream %d", addr, strm.SID())
+	log.Debugf("TCP connection established to %s", conn.RemoteAddr())
+	if err := reply(nil); err != nil {
+		return err
+	}
 
 	errChan := make(chan error, 2)
 	go func() {
-		err := buffer.CopyT(conn, strm)
+		err := buffer.CopyT(conn, ms.Up(u.reader(strm, true)))
 		errChan <- err
 	}()
 	go func() {
-		err := buffer.CopyT(strm, conn)
+		err := buffer.CopyT(strm, ms.Down(u.reader(conn, false)))
 		errChan <- err
 	}()
 
 	select {
 	case err := <-errChan:
+		ms.End(err)
 		if err != nil {
-			flog.Errorf("TCP stream %d to %s failed: %v", strm.SID(), addr, err)
+			log.Errorf("TCP stream failed: %v", err)
 			return err
 		}
 	case <-ctx.Done():
+		ms.End(ctx.Err())
 	}
 	return nil
 }
@@ -2,47 +2,71 @@ package server
 
 import (
 	"context"
-	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
-	"paqet/internal/protocol"
-	"paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 )
 
-func (s *Server) handleUDPProtocol(ctx context.Context, strm tnet.Strm, p *protocol.Proto) error {
-	flog.Infof("accepted UDP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
-	return s.handleUDP(ctx, strm, p.Addr.String())
+func (s *Server) handleUDPProtocol(ctx context.Context, tc tnet.Conn, strm tnet.Strm, p *protocol.Proto) error {
+	log.Infof("accepted UDP stream %d: %s -> %s", strm.SID(), strm.RemoteAddr(), p.Addr.String())
+	return s.handleUDP(ctx, tc, strm, p.Addr.String())
 }
 
-func (s *Server) handleUDP(ctx context.Context, strm tnet.Strm, addr string) error {
-	conn, err := net.Dial("udp", addr)
+func (s *Server) handleUDP(ctx context.Context, tc tnet.Conn, strm tnet.Strm, addr string) error {
+	u, release := s.limits.hold(strm.RemoteAddr())
+	defer release()
+	if err := u.check(); err != nil {
+		log.Warnf("rejected UDP stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), addr, err)
+		s.writeResult(strm, err)
+		return err
+	}
+
+	if err := s.authorize(ctx, strm.RemoteAddr(), "udp", addr); err != nil {
+		log.Warnf("rejected UDP stream %d from %s to %s: %v", strm.SID(), strm.RemoteAddr(), addr, err)
+		s.writeResult(strm, err)
+		s.udpIn.Fail()
+		return err
+	}
+	conn, err := s.dial(ctx, "udp", addr)
 	if err != nil {
-		flog.Errorf("failed to establish UDP connection to %s for stream %d: %v", addr, strm.SID(), err)
+		log.Errorf("failed to establish UDP connection to %s for stream %d: %v", addr, strm.SID(), err)
+		s.writeResult(strm, err)
+		s.udpIn.Fail()
 		return err
 	}
+	ms := s.udpIn.Open("udp", strm.RemoteAddr().String(), addr, strm.SID(), strm)
+	defer ms.Close()
+	ms.SetResolved(conn.RemoteAddr().String())
 	defer func() {
 		conn.Close()
-		flog.Debugf("closed UDP connection %s for stream %d", addr, strm.SID())
+		log.Debugf("closed UDP connection %s for stream %d", addr, strm.SID())
 	}()
-	flog.Debugf("UDP connection established to %s for stream %d", addr, strm.SID())
+	log.Debugf("UDP connection established to %s for stream %d", addr, strm.SID())
+	// The flow is registered before the client learns it may send.
+	flow := tc.Datagram(strm)
+	if err := s.writeResult(strm, nil); err != nil {
+		return err
+	}
 
 	errChan := make(chan error, 2)
 	go func() {
-		err := buffer.CopyU(conn, strm)
+		err := buffer.CopyU(conn, ms.Up(u.reader(flow, true)))
 		errChan <- err
 	}()
 	go func() {
-		err := buffer.CopyU(strm, conn)
+		err := buffer.CopyU(flow, ms.Down(u.reader(conn, false)))
 		errChan <- err
 	}()
 
 	select {
 	case err := <-errChan:
+		ms.End(err)
 		if err != nil {
-			flog.Errorf("UDP stream %d to %s failed: %v", strm.SID(), addr, err)
+			log.Errorf("UDP stream %d to %s failed: %v", strm.SID(), addr, err)
 			return err
 		}
 	case <-ctx.Done():
+		ms.End(ctx.Err())
 		return nil
 	}
 
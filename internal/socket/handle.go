@@ -2,21 +2,24 @@ package socket
 
 import (
 	"fmt"
-	"paqet/internal/conf"
+	"github.com/starco76/paqet/internal/conf"
 	"runtime"
 
 	"github.com/gopacket/gopacket/pcap"
 )
 
-func newHandle(cfg *conf.Network) (*pcap.Handle, error) {
+// Device returns the pcap device name for the configured interface.
+func Device(cfg *conf.Network) string {
 	// On Windows, use the GUID field to construct the NPF device name
 	// On other platforms, use the interface name directly
-	ifaceName := cfg.Interface.Name
 	if runtime.GOOS == "windows" {
-		ifaceName = cfg.GUID
+		return cfg.GUID
 	}
+	return cfg.Interface.Name
+}
 
-	inactive, err := pcap.NewInactiveHandle(ifaceName)
+func newHandle(cfg *conf.Network) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(Device(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inactive pcap handle for %s: %v", cfg.Interface.Name, err)
 	}
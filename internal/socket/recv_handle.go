@@ -2,9 +2,10 @@ package socket
 
 import (
 	"fmt"
+	"github.com/starco76/paqet/internal/conf"
 	"net"
-	"paqet/internal/conf"
 	"runtime"
+	"sync"
 
 	"github.com/gopacket/gopacket"
 	"github.com/gopacket/gopacket/layers"
@@ -13,6 +14,8 @@ import (
 
 type RecvHandle struct {
 	handle *pcap.Handle
+	closed bool
+	mu     sync.Mutex
 }
 
 func NewRecvHandle(cfg *conf.Network) (*RecvHandle, error) {
@@ -74,7 +77,19 @@ func (h *RecvHandle) Read() ([]byte, net.Addr, error) {
 	return appLayer.Payload(), addr, nil
 }
 
+func (h *RecvHandle) Stats() (*pcap.Stats, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, net.ErrClosed
+	}
+	return h.handle.Stats()
+}
+
 func (h *RecvHandle) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
 	if h.handle != nil {
 		h.handle.Close()
 	}
@@ -3,10 +3,10 @@ package socket
 import (
 	"encoding/binary"
 	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/pkg/hash"
+	"github.com/starco76/paqet/internal/pkg/iterator"
 	"net"
-	"paqet/internal/conf"
-	"paqet/internal/pkg/hash"
-	"paqet/internal/pkg/iterator"
 	"runtime"
 	"sync"
 	"sync/atomic"
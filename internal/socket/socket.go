@@ -3,10 +3,10 @@ package socket
 import (
 	"context"
 	"fmt"
+	"github.com/starco76/paqet/internal/conf"
 	"math/rand"
 	"net"
 	"os"
-	"paqet/internal/conf"
 	"sync/atomic"
 	"time"
 )
@@ -17,11 +17,50 @@ type PacketConn struct {
 	recvHandle    *RecvHandle
 	readDeadline  atomic.Value
 	writeDeadline atomic.Value
+	stats         stats
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// Open returns the packet conn a client's transport runs on: the one
+// supplied in cfg.PacketConn, or else a socket of the configured carrier.
+func Open(ctx context.Context, cfg *conf.Network) (net.PacketConn, error) {
+	return open(ctx, cfg, false)
+}
+
+// Listen is Open for a server, whose stream carrier waits for peers to
+// connect instead of dialing them.
+func Listen(ctx context.Context, cfg *conf.Network) (net.PacketConn, error) {
+	return open(ctx, cfg, true)
+}
+
+func open(ctx context.Context, cfg *conf.Network, listen bool) (net.PacketConn, error) {
+	switch {
+	case cfg.PacketConn != nil:
+		return cfg.PacketConn(ctx)
+	case cfg.Carrier == "udp":
+		return net.ListenUDP("udp", bindAddr(cfg))
+	case cfg.Carrier == "tcp-stream" && listen:
+		return ListenStream(ctx, cfg)
+	case cfg.Carrier == "tcp-stream":
+		return DialStream(ctx, cfg), nil
+	}
+	return New(ctx, cfg)
+}
+
+// bindAddr is the local address of a kernel socket carrier: the configured
+// address when only one family is set, or else any address on the port.
+func bindAddr(cfg *conf.Network) *net.UDPAddr {
+	switch {
+	case cfg.IPv4.Addr != nil && cfg.IPv6.Addr == nil:
+		return cfg.IPv4.Addr
+	case cfg.IPv6.Addr != nil && cfg.IPv4.Addr == nil:
+		return cfg.IPv6.Addr
+	}
+	return &net.UDPAddr{Port: cfg.Port}
+}
+
 // &OpError{Op: "listen", Net: network, Source: nil, Addr: nil, Err: err}
 func New(ctx context.Context, cfg *conf.Network) (*PacketConn, error) {
 	if cfg.Port == 0 {
@@ -69,9 +108,12 @@ func (c *PacketConn) ReadFrom(data []byte) (n int, addr net.Addr, err error) {
 
 	payload, addr, err := c.recvHandle.Read()
 	if err != nil {
+		c.stats.inErrors.Add(1)
 		return 0, nil, err
 	}
 	n = copy(data, payload)
+	c.stats.inPackets.Add(1)
+	c.stats.inBytes.Add(uint64(n))
 
 	return n, addr, nil
 }
@@ -100,8 +142,11 @@ func (c *PacketConn) WriteTo(data []byte, addr net.Addr) (n int, err error) {
 
 	err = c.sendHandle.Write(data, daddr)
 	if err != nil {
+		c.stats.outErrors.Add(1)
 		return 0, err
 	}
+	c.stats.outPackets.Add(1)
+	c.stats.outBytes.Add(uint64(len(data)))
 
 	return len(data), nil
 }
@@ -0,0 +1,151 @@
+package socket
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/starco76/paqet/internal/conf"
+)
+
+func loopback() *conf.Network {
+	return &conf.Network{IPv4: conf.Addr{Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}}
+}
+
+func readFrom(t *testing.T, c net.PacketConn) ([]byte, net.Addr) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 0x10000)
+	n, addr, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	return buf[:n], addr
+}
+
+// exchange sends each packet from client to server and back again.
+func exchange(t *testing.T, client, server net.PacketConn, sizes ...int) {
+	t.Helper()
+	for _, size := range sizes {
+		pkt := bytes.Repeat([]byte{byte(size)}, size)
+		if _, err := client.WriteTo(pkt, server.LocalAddr()); err != nil {
+			t.Fatalf("client WriteTo(%d bytes): %v", size, err)
+		}
+		got, from := readFrom(t, server)
+		if !bytes.Equal(got, pkt) {
+			t.Fatalf("server read %d bytes, want %d", len(got), size)
+		}
+		if _, err := server.WriteTo(pkt, from); err != nil {
+			t.Fatalf("server WriteTo(%d bytes): %v", size, err)
+		}
+		got, from = readFrom(t, client)
+		if !bytes.Equal(got, pkt) {
+			t.Fatalf("client read %d bytes, want %d", len(got), size)
+		}
+		if from.String() != server.LocalAddr().String() {
+			t.Errorf("reply came from %s, want %s", from, server.LocalAddr())
+		}
+	}
+}
+
+func TestUDPCarrier(t *testing.T) {
+	ctx := context.Background()
+	server, err := Listen(ctx, &conf.Network{Carrier: "udp", IPv4: loopback().IPv4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := Open(ctx, &conf.Network{Carrier: "udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	exchange(t, client, server, 1, 1350, 4096)
+}
+
+func listenStream(t *testing.T) *StreamConn {
+	t.Helper()
+	s, err := ListenStream(context.Background(), loopback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dialStream(t *testing.T) *StreamConn {
+	t.Helper()
+	c := DialStream(context.Background(), &conf.Network{})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func (c *StreamConn) numPeers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.peers)
+}
+
+func waitPeers(t *testing.T, c *StreamConn, want int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c.numPeers() == want {
+			return
+		}
+	}
+	t.Fatalf("carrier has %d peers, want %d", c.numPeers(), want)
+}
+
+func TestStreamCarrier(t *testing.T) {
+	server, client := listenStream(t), dialStream(t)
+	// Packets keep their boundaries, up to the 16-bit length prefix.
+	exchange(t, client, server, 1, 0, 1350, 0xffff)
+	if _, err := client.WriteTo(make([]byte, 0x10000), server.LocalAddr()); err == nil {
+		t.Errorf("WriteTo accepted a packet over 65535 bytes")
+	}
+
+	// A client whose connection is lost dials the server again.
+	server.mu.Lock()
+	for _, p := range server.peers {
+		p.conn.Close()
+	}
+	server.mu.Unlock()
+	waitPeers(t, client, 0)
+	exchange(t, client, server, 100)
+
+	// The server cannot reach a peer that has not connected.
+	if _, err := server.WriteTo([]byte("x"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); err == nil {
+		t.Errorf("server WriteTo to an unknown peer succeeded")
+	}
+}
+
+func TestStreamCarrierPeers(t *testing.T) {
+	server := listenStream(t)
+	server.mu.Lock()
+	server.maxPeers = 2
+	server.idleTimeout = 300 * time.Millisecond
+	server.mu.Unlock()
+
+	var clients []*StreamConn
+	for range 3 {
+		c := dialStream(t)
+		if _, err := c.WriteTo([]byte("hello"), server.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+	}
+	// Only the first two are accepted; the third is closed at once.
+	for range 2 {
+		readFrom(t, server)
+	}
+	waitPeers(t, clients[2], 0)
+	if n := server.numPeers(); n != 2 {
+		t.Errorf("server has %d peers, want 2", n)
+	}
+
+	// Peers that stay silent are dropped, making room for new ones.
+	waitPeers(t, server, 0)
+	exchange(t, clients[2], server, 10)
+}
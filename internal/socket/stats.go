@@ -0,0 +1,35 @@
+package socket
+
+import "sync/atomic"
+
+type stats struct {
+	inPackets, inBytes, inErrors    atomic.Uint64
+	outPackets, outBytes, outErrors atomic.Uint64
+}
+
+type Stats struct {
+	InPackets     uint64
+	InBytes       uint64
+	InErrors      uint64
+	OutPackets    uint64
+	OutBytes      uint64
+	OutErrors     uint64
+	PcapDropped   uint64
+	PcapIfDropped uint64
+}
+
+func (c *PacketConn) Stats() Stats {
+	s := Stats{
+		InPackets:  c.stats.inPackets.Load(),
+		InBytes:    c.stats.inBytes.Load(),
+		InErrors:   c.stats.inErrors.Load(),
+		OutPackets: c.stats.outPackets.Load(),
+		OutBytes:   c.stats.outBytes.Load(),
+		OutErrors:  c.stats.outErrors.Load(),
+	}
+	if ps, err := c.recvHandle.Stats(); err == nil {
+		s.PcapDropped = uint64(ps.PacketsDropped)
+		s.PcapIfDropped = uint64(ps.PacketsIfDropped)
+	}
+	return s
+}
@@ -0,0 +1,286 @@
+package socket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamConn carries packets over kernel TCP connections, each one prefixed
+// with its length. A client dials the peer on its first write and again
+// after losing the connection; a server accepts up to maxPeers peers, tells
+// them apart by their address and drops those idle for idleTimeout.
+type StreamConn struct {
+	ctx      context.Context
+	laddr    *net.TCPAddr
+	listener net.Listener
+
+	mu          sync.Mutex
+	peers       map[string]*streamPeer
+	maxPeers    int
+	idleTimeout time.Duration
+
+	in            chan streamPacket
+	done          chan struct{}
+	err           error
+	once          sync.Once
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+}
+
+type streamPeer struct {
+	conn net.Conn
+	addr net.Addr
+	mu   sync.Mutex
+	buf  []byte
+}
+
+type streamPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+const (
+	streamDialTimeout = 10 * time.Second
+	// Transports ping well within QUIC's longest idle_timeout, so a server
+	// peer silent for longer is gone.
+	streamIdleTimeout = 10 * time.Minute
+	streamMaxPeers    = 4096
+)
+
+func newStream(ctx context.Context, cfg *conf.Network) *StreamConn {
+	addr := bindAddr(cfg)
+	return &StreamConn{
+		ctx:         ctx,
+		laddr:       &net.TCPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone},
+		peers:       make(map[string]*streamPeer),
+		maxPeers:    streamMaxPeers,
+		idleTimeout: streamIdleTimeout,
+		in:          make(chan streamPacket, 256),
+		done:        make(chan struct{}),
+	}
+}
+
+// DialStream returns a client stream carrier, which connects to the server
+// once there is something to send.
+func DialStream(ctx context.Context, cfg *conf.Network) *StreamConn {
+	c := newStream(ctx, cfg)
+	if c.laddr.Port == 0 && c.laddr.IP == nil {
+		c.laddr = nil
+	}
+	return c
+}
+
+// ListenStream returns a server stream carrier listening on the configured
+// port.
+func ListenStream(ctx context.Context, cfg *conf.Network) (*StreamConn, error) {
+	c := newStream(ctx, cfg)
+	l, err := net.ListenTCP("tcp", c.laddr)
+	if err != nil {
+		return nil, err
+	}
+	c.listener = l
+	go c.accept()
+	return c, nil
+}
+
+func (c *StreamConn) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			c.close(err)
+			return
+		}
+		tcp := conn.RemoteAddr().(*net.TCPAddr)
+		p := &streamPeer{conn: conn, addr: &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone}}
+		c.mu.Lock()
+		if len(c.peers) >= c.maxPeers {
+			c.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		c.peers[p.addr.String()] = p
+		c.mu.Unlock()
+		go c.read(p)
+	}
+}
+
+// peer returns the connection to addr, dialing it on a client. The dial
+// runs unlocked, so writes to other peers and Close do not wait on it.
+func (c *StreamConn) peer(addr net.Addr) (*streamPeer, error) {
+	c.mu.Lock()
+	p, ok := c.peers[addr.String()]
+	c.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	if c.listener != nil {
+		return nil, fmt.Errorf("no stream from %s", addr)
+	}
+	d := net.Dialer{Timeout: streamDialTimeout}
+	if c.laddr != nil {
+		d.LocalAddr = c.laddr
+	}
+	conn, err := d.DialContext(c.ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		conn.Close()
+		return nil, c.err
+	default:
+	}
+	// Another write dialed the same peer meanwhile.
+	if p, ok := c.peers[addr.String()]; ok {
+		conn.Close()
+		return p, nil
+	}
+	// Packets from the server carry the address they were sent to, as a
+	// datagram reply would.
+	p = &streamPeer{conn: conn, addr: addr}
+	c.peers[addr.String()] = p
+	go c.read(p)
+	return p, nil
+}
+
+func (c *StreamConn) read(p *streamPeer) {
+	r := bufio.NewReader(p.conn)
+	c.mu.Lock()
+	idle := c.idleTimeout
+	c.mu.Unlock()
+	var hdr [2]byte
+	for {
+		if c.listener != nil {
+			p.conn.SetReadDeadline(time.Now().Add(idle))
+		}
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			c.drop(p)
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			c.drop(p)
+			return
+		}
+		select {
+		case c.in <- streamPacket{data, p.addr}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// drop forgets a connection that failed. A client dials the server again
+// on its next write, so the transport above only sees the packets lost in
+// between.
+func (c *StreamConn) drop(p *streamPeer) {
+	p.conn.Close()
+	c.mu.Lock()
+	if c.peers[p.addr.String()] == p {
+		delete(c.peers, p.addr.String())
+	}
+	c.mu.Unlock()
+}
+
+func (c *StreamConn) ReadFrom(data []byte) (n int, addr net.Addr, err error) {
+	var deadline <-chan time.Time
+	if d, ok := c.readDeadline.Load().(time.Time); ok && !d.IsZero() {
+		timer := time.NewTimer(time.Until(d))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case pkt := <-c.in:
+		return copy(data, pkt.data), pkt.addr, nil
+	case <-c.done:
+		return 0, nil, c.err
+	case <-deadline:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *StreamConn) WriteTo(data []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.done:
+		return 0, c.err
+	default:
+	}
+	if len(data) > 0xffff {
+		return 0, fmt.Errorf("packet of %d bytes is too large for a stream", len(data))
+	}
+	p, err := c.peer(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = binary.BigEndian.AppendUint16(p.buf[:0], uint16(len(data)))
+	p.buf = append(p.buf, data...)
+	if d, ok := c.writeDeadline.Load().(time.Time); ok {
+		p.conn.SetWriteDeadline(d)
+	}
+	if _, err := p.conn.Write(p.buf); err != nil {
+		c.drop(p)
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *StreamConn) close(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+func (c *StreamConn) Close() error {
+	c.close(net.ErrClosed)
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, p := range c.peers {
+		p.conn.Close()
+		delete(c.peers, addr)
+	}
+	return nil
+}
+
+func (c *StreamConn) LocalAddr() net.Addr {
+	if c.listener != nil {
+		tcp := c.listener.Addr().(*net.TCPAddr)
+		return &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone}
+	}
+	return nil
+}
+
+func (c *StreamConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	c.writeDeadline.Store(t)
+	return nil
+}
+
+func (c *StreamConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	return nil
+}
+
+func (c *StreamConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(t)
+	return nil
+}
@@ -2,7 +2,8 @@ package socks
 
 import (
 	"context"
-	"paqet/internal/client"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/metrics"
 	"sync"
 )
 
@@ -14,6 +15,8 @@ var rPool = sync.Pool{
 }
 
 type Handler struct {
-	client *client.Client
-	ctx    context.Context
+	client  *client.Client
+	ctx     context.Context
+	inbound *metrics.Inbound
+	udp     sync.Map // session key -> *metrics.Stream
 }
@@ -2,47 +2,83 @@ package socks
 
 import (
 	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/metrics"
 	"net"
-	"paqet/internal/client"
-	"paqet/internal/conf"
-	"paqet/internal/flog"
 
 	"github.com/txthinking/socks5"
 )
 
+var log = flog.New("socks")
+
 type SOCKS5 struct {
 	handle *Handler
+	done   chan struct{}
 }
 
 func New(client *client.Client) (*SOCKS5, error) {
 	return &SOCKS5{
 		handle: &Handler{client: client},
+		done:   make(chan struct{}),
 	}, nil
 }
 
 func (s *SOCKS5) Start(ctx context.Context, cfg conf.SOCKS5) error {
+	listenAddr, err := net.ResolveTCPAddr("tcp", cfg.Listen.String())
+	if err != nil {
+		return fmt.Errorf("failed to resolve SOCKS5 listen address %s: %w", cfg.Listen, err)
+	}
+	server, err := socks5.NewClassicServer(listenAddr.String(), listenAddr.IP.String(), cfg.Username, cfg.Password, 10, 10)
+	if err != nil {
+		return fmt.Errorf("SOCKS5 server failed to create on %s: %w", listenAddr, err)
+	}
+	// ListenAndServe only returns once the server stops, so a bad address
+	// is caught here instead.
+	if err := probe(listenAddr); err != nil {
+		return err
+	}
+
 	s.handle.ctx = ctx
-	go s.listen(ctx, cfg)
+	s.handle.inbound = metrics.NewInbound("socks5/" + cfg.Listen.String())
+	go func() {
+		defer close(s.done)
+		s.listen(ctx, server, listenAddr)
+	}()
 	return nil
 }
 
-func (s *SOCKS5) listen(ctx context.Context, cfg conf.SOCKS5) error {
-	listenAddr, _ := net.ResolveTCPAddr("tcp", cfg.Listen.String())
-	server, err := socks5.NewClassicServer(listenAddr.String(), listenAddr.IP.String(), cfg.Username, cfg.Password, 10, 10)
-	if err != nil {
-		flog.Fatalf("SOCKS5 server failed to create on %s: %v", listenAddr.String(), err)
-	}
+// Wait blocks until the listener has shut down after ctx is cancelled.
+func (s *SOCKS5) Wait() {
+	<-s.done
+}
 
+func (s *SOCKS5) listen(ctx context.Context, server *socks5.Server, listenAddr *net.TCPAddr) {
 	go func() {
-		if err := server.ListenAndServe(s.handle); err != nil {
-			flog.Debugf("SOCKS5 server failed to listen on %s: %v", listenAddr.String(), err)
+		if err := server.ListenAndServe(s.handle); err != nil && ctx.Err() == nil {
+			log.Errorf("SOCKS5 server failed to listen on %s: %v", listenAddr, err)
 		}
 	}()
-	flog.Infof("SOCKS5 server listening on %s", listenAddr.String())
+	log.Infof("SOCKS5 server listening on %s", listenAddr)
 
 	<-ctx.Done()
 	if err := server.Shutdown(); err != nil {
-		flog.Debugf("SOCKS5 server shutdown with: %v", err)
+		log.Debugf("SOCKS5 server shutdown with: %v", err)
 	}
-	return nil
+}
+
+// probe binds the TCP and UDP sockets the server will use and releases them.
+func probe(addr *net.TCPAddr) error {
+	l, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to bind SOCKS5 TCP socket on %s: %w", addr, err)
+	}
+	defer l.Close()
+	u, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone})
+	if err != nil {
+		return fmt.Errorf("failed to bind SOCKS5 UDP socket on %s: %w", addr, err)
+	}
+	return u.Close()
 }
@@ -1,82 +1,98 @@
 package socks
 
 import (
+	"errors"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/pkg/buffer"
 	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
 
 	"github.com/txthinking/socks5"
 )
 
 func (h *Handler) TCPHandle(server *socks5.Server, conn *net.TCPConn, r *socks5.Request) error {
 	if r.Cmd == socks5.CmdUDP {
-		flog.Debugf("SOCKS5 UDP_ASSOCIATE from %s", conn.RemoteAddr())
+		log.Debugf("SOCKS5 UDP_ASSOCIATE from %s", conn.RemoteAddr())
 		return h.handleUDPAssociate(conn)
 	}
 
 	if r.Cmd == socks5.CmdConnect {
-		flog.Debugf("SOCKS5 CONNECT from %s to %s", conn.RemoteAddr(), r.Address())
+		log.Debugf("SOCKS5 CONNECT from %s to %s", conn.RemoteAddr(), r.Address())
 		return h.handleTCPConnect(conn, r)
 	}
 
-	flog.Debugf("unsupported SOCKS5 command %d from %s", r.Cmd, conn.RemoteAddr())
+	log.Debugf("unsupported SOCKS5 command %d from %s", r.Cmd, conn.RemoteAddr())
 	return nil
 }
 
 func (h *Handler) handleTCPConnect(conn *net.TCPConn, r *socks5.Request) error {
-	flog.Infof("SOCKS5 accepted TCP connection %s -> %s", conn.RemoteAddr(), r.Address())
+	log.Infof("SOCKS5 accepted TCP connection %s -> %s", conn.RemoteAddr(), r.Address())
 
-	addr := conn.LocalAddr().(*net.TCPAddr)
-	bufp := rPool.Get().(*[]byte)
-	defer rPool.Put(bufp)
-	buf := *bufp
-	buf = append(buf, socks5.Ver)
-	buf = append(buf, socks5.RepSuccess)
-	buf = append(buf, 0x00)
-	if ip4 := addr.IP.To4(); ip4 != nil {
-		buf = append(buf, socks5.ATYPIPv4)
-		buf = append(buf, ip4...)
-	} else if ip6 := addr.IP.To16(); ip6 != nil {
-		buf = append(buf, socks5.ATYPIPv6)
-		buf = append(buf, ip6...)
-	} else {
-		host := addr.IP.String()
-		buf = append(buf, socks5.ATYPDomain)
-		buf = append(buf, byte(len(host)))
-		buf = append(buf, host...)
-	}
-	buf = append(buf, byte(addr.Port>>8), byte(addr.Port&0xff))
-	if _, err := conn.Write(buf); err != nil {
-		return err
-	}
-
-	strm, err := h.client.TCP(r.Address())
+	strm, err := h.client.TCP(h.ctx, r.Address())
 	if err != nil {
-		flog.Errorf("SOCKS5 failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), r.Address(), err)
+		log.Errorf("SOCKS5 failed to establish stream for %s -> %s: %v", conn.RemoteAddr(), r.Address(), err)
+		rep := socks5.RepHostUnreachable
+		if errors.Is(err, client.ErrDenied) {
+			rep = socks5.RepNotAllowed
+		}
+		h.writeReply(conn, rep)
+		h.inbound.Fail()
 		return err
 	}
 	defer strm.Close()
-	flog.Debugf("SOCKS5 stream %d established for %s -> %s", strm.SID(), conn.RemoteAddr(), r.Address())
+	ms := h.inbound.Open("tcp", conn.RemoteAddr().String(), r.Address(), strm.SID(), strm)
+	defer ms.Close()
+	log := log.With("stream", ms.ID, "sid", strm.SID(), "src", conn.RemoteAddr(), "dst", r.Address())
+	if err := h.writeReply(conn, socks5.RepSuccess); err != nil {
+		return err
+	}
+	log.Debugf("SOCKS5 stream established")
 
 	errCh := make(chan error, 2)
 	go func() {
-		err := buffer.CopyT(conn, strm)
+		err := buffer.CopyT(conn, ms.Down(strm))
 		errCh <- err
 	}()
 	go func() {
-		err := buffer.CopyT(strm, conn)
+		err := buffer.CopyT(strm, ms.Up(conn))
 		errCh <- err
 	}()
 
 	select {
 	case err := <-errCh:
+		ms.End(err)
 		if err != nil {
-			flog.Errorf("SOCKS5 stream %d failed for %s -> %s: %v", strm.SID(), conn.RemoteAddr(), r.Address(), err)
+			log.Errorf("SOCKS5 stream failed: %v", err)
 		}
 	case <-h.ctx.Done():
-		flog.Debugf("SOCKS5 connection %s -> %s closed due to shutdown", conn.RemoteAddr(), r.Address())
+		ms.End(h.ctx.Err())
+		log.Debugf("SOCKS5 connection closed due to shutdown")
 	}
 
-	flog.Debugf("SOCKS5 connection %s -> %s closed", conn.RemoteAddr(), r.Address())
+	log.Debugf("SOCKS5 connection closed")
 	return nil
 }
+
+func (h *Handler) writeReply(conn *net.TCPConn, rep byte) error {
+	addr := conn.LocalAddr().(*net.TCPAddr)
+	bufp := rPool.Get().(*[]byte)
+	defer rPool.Put(bufp)
+	buf := *bufp
+	buf = append(buf, socks5.Ver)
+	buf = append(buf, rep)
+	buf = append(buf, 0x00)
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		buf = append(buf, socks5.ATYPIPv4)
+		buf = append(buf, ip4...)
+	} else if ip6 := addr.IP.To16(); ip6 != nil {
+		buf = append(buf, socks5.ATYPIPv6)
+		buf = append(buf, ip6...)
+	} else {
+		host := addr.IP.String()
+		buf = append(buf, socks5.ATYPDomain)
+		buf = append(buf, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	buf = append(buf, byte(addr.Port>>8), byte(addr.Port&0xff))
+	_, err := conn.Write(buf)
+	return err
+}
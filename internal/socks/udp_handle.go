@@ -1,10 +1,10 @@
 package socks
 
 import (
+	"github.com/starco76/paqet/internal/metrics"
+	"github.com/starco76/paqet/internal/pkg/buffer"
 	"io"
 	"net"
-	"paqet/internal/flog"
-	"paqet/internal/pkg/buffer"
 	"time"
 
 	"github.com/txthinking/socks5"
@@ -14,43 +14,55 @@ func (h *Handler) UDPHandle(server *socks5.Server, addr *net.UDPAddr, d *socks5.
 	bufp := buffer.UPool.Get().(*[]byte)
 	defer buffer.UPool.Put(bufp)
 	buf := *bufp
-	strm, new, k, err := h.client.UDP(addr.String(), d.Address())
+	strm, new, k, err := h.client.UDP(h.ctx, addr.String(), d.Address())
 	if err != nil {
-		flog.Errorf("SOCKS5 failed to establish UDP stream for %s -> %s: %v", addr, d.Address(), err)
+		log.Errorf("SOCKS5 failed to establish UDP stream for %s -> %s: %v", addr, d.Address(), err)
+		h.inbound.Fail()
 		return err
 	}
+	if new {
+		h.udp.Store(k, h.inbound.Open("udp", addr.String(), d.Address(), strm.SID(), strm))
+	}
 	strm.SetWriteDeadline(time.Now().Add(8 * time.Second))
 	_, err = strm.Write(d.Data)
 	strm.SetWriteDeadline(time.Time{})
 	if err != nil {
-		flog.Errorf("SOCKS5 failed to forward %d bytes from %s -> %s: %v", len(d.Data), addr, d.Address(), err)
-		h.client.CloseUDP(k)
+		log.Errorf("SOCKS5 failed to forward %d bytes from %s -> %s: %v", len(d.Data), addr, d.Address(), err)
+		h.closeUDP(k, err)
 		return err
 	}
+	ms, ok := h.udp.Load(k)
+	if ok {
+		ms.(*metrics.Stream).AddUp(len(d.Data))
+	}
 
-	if new {
-		flog.Infof("SOCKS5 accepted UDP connection %s -> %s", addr, d.Address())
+	if new && ok {
+		log.Infof("SOCKS5 accepted UDP connection %s -> %s", addr, d.Address())
 		go func() {
+			var err error
 			defer func() {
-				flog.Debugf("SOCKS5 UDP stream %d closed for %s -> %s", strm.SID(), addr, d.Address())
-				h.client.CloseUDP(k)
+				log.Debugf("SOCKS5 UDP stream %d closed for %s -> %s", strm.SID(), addr, d.Address())
+				h.closeUDP(k, err)
 			}()
 			for {
 				select {
 				case <-h.ctx.Done():
+					err = h.ctx.Err()
 					return
 				default:
 					strm.SetDeadline(time.Now().Add(8 * time.Second))
-					n, err := strm.Read(buf)
+					var n int
+					n, err = strm.Read(buf)
 					strm.SetDeadline(time.Time{})
 					if err != nil {
-						flog.Debugf("SOCKS5 UDP stream %d read error for %s -> %s: %v", strm.SID(), addr, d.Address(), err)
+						log.Debugf("SOCKS5 UDP stream %d read error for %s -> %s: %v", strm.SID(), addr, d.Address(), err)
 						return
 					}
+					ms.(*metrics.Stream).AddDown(n)
 					dd := socks5.NewDatagram(d.Atyp, d.DstAddr, d.DstPort, buf[:n])
 					_, err = server.UDPConn.WriteToUDP(dd.Bytes(), addr)
 					if err != nil {
-						flog.Errorf("SOCKS5 failed to write UDP response %d bytes to %s: %v", len(dd.Bytes()), addr, err)
+						log.Errorf("SOCKS5 failed to write UDP response %d bytes to %s: %v", len(dd.Bytes()), addr, err)
 						return
 					}
 				}
@@ -60,36 +72,20 @@ func (h *Handler) UDPHandle(server *socks5.Server, addr *net.UDPAddr, d *socks5.
 	return nil
 }
 
-func (h *Handler) handleUDPAssociate(conn *net.TCPConn) error {
-	addr := conn.LocalAddr().(*net.TCPAddr)
-
-	bufp := rPool.Get().(*[]byte)
-	defer rPool.Put(bufp)
-	buf := *bufp
-	buf = append(buf, socks5.Ver)
-	buf = append(buf, socks5.RepSuccess)
-	buf = append(buf, 0x00) // reserved
-	if ip4 := addr.IP.To4(); ip4 != nil {
-		// IPv4
-		buf = append(buf, socks5.ATYPIPv4)
-		buf = append(buf, ip4...)
-	} else if ip6 := addr.IP.To16(); ip6 != nil {
-		// IPv6
-		buf = append(buf, socks5.ATYPIPv6)
-		buf = append(buf, ip6...)
-	} else {
-		// Domain name
-		host := addr.IP.String()
-		buf = append(buf, socks5.ATYPDomain)
-		buf = append(buf, byte(len(host)))
-		buf = append(buf, host...)
+// closeUDP ends the session, recording err as the reason it stopped.
+func (h *Handler) closeUDP(k uint64, err error) {
+	h.client.CloseUDP(k)
+	if ms, ok := h.udp.LoadAndDelete(k); ok {
+		ms.(*metrics.Stream).End(err)
+		ms.(*metrics.Stream).Close()
 	}
-	buf = append(buf, byte(addr.Port>>8), byte(addr.Port&0xff))
+}
 
-	if _, err := conn.Write(buf); err != nil {
+func (h *Handler) handleUDPAssociate(conn *net.TCPConn) error {
+	if err := h.writeReply(conn, socks5.RepSuccess); err != nil {
 		return err
 	}
-	flog.Debugf("SOCKS5 accepted UDP_ASSOCIATE from %s, waiting for TCP connection to close", conn.RemoteAddr())
+	log.Debugf("SOCKS5 accepted UDP_ASSOCIATE from %s, waiting for TCP connection to close", conn.RemoteAddr())
 
 	done := make(chan error, 1)
 	go func() {
@@ -100,14 +96,14 @@ func (h *Handler) handleUDPAssociate(conn *net.TCPConn) error {
 	select {
 	case err := <-done:
 		if err != nil && h.ctx.Err() == nil {
-			flog.Errorf("SOCKS5 TCP connection for UDP associate closed with: %v", err)
+			log.Errorf("SOCKS5 TCP connection for UDP associate closed with: %v", err)
 		}
 	case <-h.ctx.Done():
 		conn.Close() // Force close the connection to unblock io.Copy
 		<-done       // Wait for the goroutine to finish
-		flog.Debugf("SOCKS5 UDP_ASSOCIATE connection %s closed due to shutdown", conn.RemoteAddr())
+		log.Debugf("SOCKS5 UDP_ASSOCIATE connection %s closed due to shutdown", conn.RemoteAddr())
 	}
 
-	flog.Debugf("SOCKS5 UDP_ASSOCIATE TCP connection %s closed", conn.RemoteAddr())
+	log.Debugf("SOCKS5 UDP_ASSOCIATE TCP connection %s closed", conn.RemoteAddr())
 	return nil
 }
@@ -15,4 +15,21 @@ type Conn interface {
 	SetDeadline(t time.Time) error
 	SetReadDeadline(t time.Time) error
 	SetWriteDeadline(t time.Time) error
+	Stats() ConnStats
+	// Packet returns a Strm over which every Write on strm arrives as a
+	// single Read, for UDP flows.
+	Packet(strm Strm) Strm
+	// Datagram returns a Strm that sends strm's payload as unreliable
+	// datagrams for as long as strm is open, or Packet(strm) when the
+	// connection does not carry datagrams.
+	Datagram(strm Strm) Strm
+}
+
+type ConnStats struct {
+	RTT        time.Duration
+	RTTVar     time.Duration
+	RTO        time.Duration
+	SendWindow int
+	RecvWindow int
+	Streams    int
 }
@@ -0,0 +1,135 @@
+package tnet
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrDatagramTooLarge is returned by a datagram send function for payloads
+// that have to go over the stream instead.
+var ErrDatagramTooLarge = errors.New("datagram too large")
+
+const datagramQueue = 128
+
+// DatagramStrm carries a UDP flow as datagrams, for transports to return
+// from Conn.Datagram. The stream it wraps stays open for as long as the
+// flow, which ends when either side closes it, and carries the payloads too
+// large for a datagram, so it has to keep write boundaries (see Conn.Packet).
+type DatagramStrm struct {
+	Strm
+	send     func([]byte) error
+	onClose  func()
+	in       chan []byte
+	done     chan struct{}
+	err      error
+	once     sync.Once
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// NewDatagramStrm sends through send and calls onClose once the flow ends.
+func NewDatagramStrm(strm Strm, send func([]byte) error, onClose func()) *DatagramStrm {
+	s := &DatagramStrm{
+		Strm:    strm,
+		send:    send,
+		onClose: onClose,
+		in:      make(chan []byte, datagramQueue),
+		done:    make(chan struct{}),
+	}
+	go s.readStrm()
+	return s
+}
+
+// Deliver queues a received datagram, which s then owns. It is dropped when
+// the reader has fallen behind, as a congested link would.
+func (s *DatagramStrm) Deliver(b []byte) {
+	select {
+	case s.in <- b:
+	default:
+	}
+}
+
+func (s *DatagramStrm) readStrm() {
+	buf := make([]byte, 65535)
+	for {
+		n, err := s.Strm.Read(buf)
+		if n > 0 {
+			select {
+			case s.in <- append([]byte(nil), buf[:n]...):
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+func (s *DatagramStrm) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	deadline := s.deadline
+	s.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case pkt := <-s.in:
+		return copy(b, pkt), nil
+	case <-s.done:
+		return 0, s.err
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (s *DatagramStrm) Write(b []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, s.err
+	default:
+	}
+	err := s.send(b)
+	if errors.Is(err, ErrDatagramTooLarge) {
+		return s.Strm.Write(b)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *DatagramStrm) close(err error) {
+	s.once.Do(func() {
+		s.onClose()
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *DatagramStrm) Close() error {
+	s.close(net.ErrClosed)
+	return s.Strm.Close()
+}
+
+func (s *DatagramStrm) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	return s.Strm.SetWriteDeadline(t)
+}
+
+// SetReadDeadline only applies to Read; the stream underneath is read
+// until it closes.
+func (s *DatagramStrm) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.deadline = t
+	s.mu.Unlock()
+	return nil
+}
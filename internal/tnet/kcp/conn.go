@@ -2,10 +2,10 @@ package kcp
 
 import (
 	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
 	"net"
-	"paqet/internal/protocol"
-	"paqet/internal/socket"
-	"paqet/internal/tnet"
 	"time"
 
 	"github.com/xtaci/kcp-go/v5"
@@ -13,9 +13,11 @@ import (
 )
 
 type Conn struct {
-	PacketConn *socket.PacketConn
+	PacketConn net.PacketConn
 	UDPSession *kcp.UDPSession
 	Session    *smux.Session
+	cfg        *conf.KCP
+	demux      *demux
 }
 
 func (c *Conn) OpenStrm() (tnet.Strm, error) {
@@ -57,6 +59,18 @@ func (c *Conn) Ping(wait bool) error {
 	return nil
 }
 
+// Packet returns strm itself: smux hands each frame to a single Read.
+func (c *Conn) Packet(strm tnet.Strm) tnet.Strm {
+	return strm
+}
+
+func (c *Conn) Datagram(strm tnet.Strm) tnet.Strm {
+	if c.demux == nil {
+		return strm
+	}
+	return c.demux.flow(c.UDPSession.RemoteAddr(), c.UDPSession.GetConv(), strm)
+}
+
 func (c *Conn) Close() error {
 	var err error
 	if c.UDPSession != nil {
@@ -71,6 +85,17 @@ func (c *Conn) Close() error {
 	return err
 }
 
+func (c *Conn) Stats() tnet.ConnStats {
+	return tnet.ConnStats{
+		RTT:        time.Duration(c.UDPSession.GetSRTT()) * time.Millisecond,
+		RTTVar:     time.Duration(c.UDPSession.GetSRTTVar()) * time.Millisecond,
+		RTO:        time.Duration(c.UDPSession.GetRTO()) * time.Millisecond,
+		SendWindow: c.cfg.Sndwnd,
+		RecvWindow: c.cfg.Rcvwnd,
+		Streams:    c.Session.NumStreams(),
+	}
+}
+
 func (c *Conn) LocalAddr() net.Addr                { return c.Session.LocalAddr() }
 func (c *Conn) RemoteAddr() net.Addr               { return c.Session.RemoteAddr() }
 func (c *Conn) SetDeadline(t time.Time) error      { return c.Session.SetDeadline(t) }
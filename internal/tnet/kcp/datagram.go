@@ -0,0 +1,251 @@
+package kcp
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/starco76/paqet/internal/tnet"
+	"hash/crc32"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// With datagrams enabled every packet starts with a type byte. KCP packets
+// are passed on to kcp-go; datagrams skip it and go straight to the flow
+// they belong to, so a lost one is never retransmitted.
+const (
+	packetKCP      byte = 0
+	packetDatagram byte = 1
+)
+
+const (
+	nonceSize       = 16
+	cryptHeaderSize = nonceSize + 4
+	flowHeaderSize  = 16 // conversation ID, flow ID and sequence number
+)
+
+// replayWords is the size of the replay window in 64-bit words; the newest
+// word is still filling, so the window covers replayWindow sequence numbers.
+const (
+	replayWords  = 16
+	replayWindow = (replayWords - 1) * 64
+)
+
+type flowKey struct {
+	addr string
+	conv uint32
+	flow uint32
+}
+
+// replay remembers which recent sequence numbers of a flow have arrived, so
+// that a datagram captured on the wire cannot be delivered twice.
+type replay struct {
+	top  uint64
+	bits [replayWords]uint64
+}
+
+// accept reports whether seq is new and inside the window, and records it.
+func (r *replay) accept(seq uint64) bool {
+	if seq == 0 || seq+replayWindow < r.top {
+		return false
+	}
+	index := seq / 64
+	if seq > r.top {
+		cur := r.top / 64
+		for i := range min(index-cur, replayWords) {
+			r.bits[(cur+i+1)%replayWords] = 0
+		}
+		r.top = seq
+	}
+	word := &r.bits[index%replayWords]
+	bit := uint64(1) << (seq % 64)
+	if *word&bit != 0 {
+		return false
+	}
+	*word |= bit
+	return true
+}
+
+type flow struct {
+	strm   *tnet.DatagramStrm
+	replay replay
+}
+
+// demux sits between kcp-go and the packet conn. A datagram is the type
+// byte followed by the conversation ID of the KCP session, the flow ID, a
+// per-flow sequence number and the payload, encrypted the way kcp-go
+// encrypts its own packets. Without datagrams no demux is installed and
+// packets go to kcp-go unchanged.
+type demux struct {
+	net.PacketConn
+	block kcp.BlockCrypt
+	max   int
+	mu    sync.Mutex
+	flows map[flowKey]*flow
+	bufs  sync.Pool
+}
+
+func newDemux(pConn net.PacketConn, block kcp.BlockCrypt, mtu int) *demux {
+	d := &demux{PacketConn: pConn, block: block, flows: make(map[flowKey]*flow)}
+	d.max = mtu - d.header() - d.overhead() - flowHeaderSize
+	d.bufs.New = func() any {
+		b := make([]byte, 1+mtu+1)
+		return &b
+	}
+	return d
+}
+
+func (d *demux) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := d.PacketConn.ReadFrom(p)
+		if err != nil {
+			return 0, addr, err
+		}
+		if n == 0 {
+			continue
+		}
+		switch p[0] {
+		case packetKCP:
+			return copy(p, p[1:n]), addr, nil
+		case packetDatagram:
+			d.deliver(p[1:n], addr)
+		}
+	}
+}
+
+func (d *demux) WriteTo(p []byte, addr net.Addr) (int, error) {
+	bufp := d.bufs.Get().(*[]byte)
+	defer d.bufs.Put(bufp)
+	buf := append((*bufp)[:0], packetKCP)
+	buf = append(buf, p...)
+	if _, err := d.PacketConn.WriteTo(buf, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (d *demux) deliver(pkt []byte, addr net.Addr) {
+	msg, ok := d.open(pkt)
+	if !ok || len(msg) < flowHeaderSize {
+		return
+	}
+	key := flowKey{
+		addr: addr.String(),
+		conv: binary.LittleEndian.Uint32(msg),
+		flow: binary.LittleEndian.Uint32(msg[4:]),
+	}
+	seq := binary.LittleEndian.Uint64(msg[8:])
+	d.mu.Lock()
+	f := d.flows[key]
+	ok = f != nil && f.replay.accept(seq)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+	f.strm.Deliver(append([]byte(nil), msg[flowHeaderSize:]...))
+}
+
+func (d *demux) send(addr net.Addr, key flowKey, seq uint64, payload []byte) error {
+	bufp := d.bufs.Get().(*[]byte)
+	defer d.bufs.Put(bufp)
+	buf := append((*bufp)[:0], packetDatagram)
+	buf = buf[:1+d.header()]
+	buf = binary.LittleEndian.AppendUint32(buf, key.conv)
+	buf = binary.LittleEndian.AppendUint32(buf, key.flow)
+	buf = binary.LittleEndian.AppendUint64(buf, seq)
+	buf = append(buf, payload...)
+	pkt, err := d.seal(buf[1:])
+	if err != nil {
+		return err
+	}
+	_, err = d.PacketConn.WriteTo(buf[:1+len(pkt)], addr)
+	return err
+}
+
+func (d *demux) header() int {
+	switch b := d.block.(type) {
+	case nil:
+		return 0
+	case cipher.AEAD:
+		return b.NonceSize()
+	default:
+		return cryptHeaderSize
+	}
+}
+
+func (d *demux) overhead() int {
+	if b, ok := d.block.(cipher.AEAD); ok {
+		return b.Overhead()
+	}
+	return 0
+}
+
+// seal encrypts pkt in place; it starts with header() bytes of room.
+func (d *demux) seal(pkt []byte) ([]byte, error) {
+	switch b := d.block.(type) {
+	case nil:
+		return pkt, nil
+	case cipher.AEAD:
+		nonce := pkt[:b.NonceSize()]
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return b.Seal(nonce, nonce, pkt[len(nonce):], nil), nil
+	default:
+		if _, err := rand.Read(pkt[:nonceSize]); err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint32(pkt[nonceSize:], crc32.ChecksumIEEE(pkt[cryptHeaderSize:]))
+		b.Encrypt(pkt, pkt)
+		return pkt, nil
+	}
+}
+
+func (d *demux) open(pkt []byte) ([]byte, bool) {
+	switch b := d.block.(type) {
+	case nil:
+		return pkt, true
+	case cipher.AEAD:
+		ns := b.NonceSize()
+		if len(pkt) < ns+b.Overhead() {
+			return nil, false
+		}
+		msg, err := b.Open(pkt[ns:ns], pkt[:ns], pkt[ns:], nil)
+		return msg, err == nil
+	default:
+		if len(pkt) < cryptHeaderSize {
+			return nil, false
+		}
+		b.Decrypt(pkt, pkt)
+		if crc32.ChecksumIEEE(pkt[cryptHeaderSize:]) != binary.LittleEndian.Uint32(pkt[nonceSize:]) {
+			return nil, false
+		}
+		return pkt[cryptHeaderSize:], true
+	}
+}
+
+func (d *demux) flow(addr net.Addr, conv uint32, strm tnet.Strm) tnet.Strm {
+	key := flowKey{addr: addr.String(), conv: conv, flow: uint32(strm.SID())}
+	var seq atomic.Uint64
+	send := func(b []byte) error {
+		if len(b) > d.max {
+			return tnet.ErrDatagramTooLarge
+		}
+		return d.send(addr, key, seq.Add(1), b)
+	}
+	// Holding the lock keeps a flow that ends at once from being removed
+	// before it was added.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f := &flow{}
+	f.strm = tnet.NewDatagramStrm(strm, send, func() {
+		d.mu.Lock()
+		delete(d.flows, key)
+		d.mu.Unlock()
+	})
+	d.flows[key] = f
+	return f.strm
+}
@@ -2,29 +2,36 @@ package kcp
 
 import (
 	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/tnet"
 	"net"
-	"paqet/internal/conf"
-	"paqet/internal/flog"
-	"paqet/internal/socket"
-	"paqet/internal/tnet"
 
 	"github.com/xtaci/kcp-go/v5"
 	"github.com/xtaci/smux"
 )
 
-func Dial(addr *net.UDPAddr, cfg *conf.KCP, pConn *socket.PacketConn) (tnet.Conn, error) {
-	conn, err := kcp.NewConn(addr.String(), cfg.Block, cfg.Dshard, cfg.Pshard, pConn)
+var log = flog.New("kcp")
+
+func Dial(addr *net.UDPAddr, cfg *conf.KCP, pConn net.PacketConn) (tnet.Conn, error) {
+	var d *demux
+	kConn := pConn
+	if cfg.Datagram {
+		d = newDemux(pConn, cfg.Block, cfg.MTU)
+		kConn = d
+	}
+	conn, err := kcp.NewConn(addr.String(), cfg.Block, cfg.Dshard, cfg.Pshard, kConn)
 	if err != nil {
 		return nil, fmt.Errorf("connection attempt failed: %v", err)
 	}
 	aplConf(conn, cfg)
-	flog.Debugf("KCP connection established, creating smux session")
+	log.Debugf("KCP connection established, creating smux session")
 
 	sess, err := smux.Client(conn, smuxConf(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create smux session: %w", err)
 	}
 
-	flog.Debugf("smux session established successfully")
-	return &Conn{pConn, conn, sess}, nil
+	log.Debugf("smux session established successfully")
+	return &Conn{pConn, conn, sess, cfg, d}, nil
 }
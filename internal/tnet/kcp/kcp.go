@@ -1,7 +1,7 @@
 package kcp
 
 import (
-	"paqet/internal/conf"
+	"github.com/starco76/paqet/internal/conf"
 	"time"
 
 	"github.com/xtaci/kcp-go/v5"
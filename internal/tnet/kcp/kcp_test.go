@@ -0,0 +1,295 @@
+package kcp
+
+import (
+	"bytes"
+	"errors"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+)
+
+func TestReplay(t *testing.T) {
+	var r replay
+	steps := []struct {
+		seq  uint64
+		want bool
+	}{
+		{0, false},
+		{1, true},
+		{1, false},
+		{3, true},
+		{2, true},
+		{3, false},
+		{100, true},
+		{50, true},
+		{50, false},
+		{replayWindow + 100, true},
+		{100, false},
+		{99, false},
+		{101, true},
+		{101, false},
+		{10 * replayWindow, true},
+		{10*replayWindow - 1, true},
+		{9 * replayWindow, true},
+		{9*replayWindow - 1, false},
+	}
+	for i, s := range steps {
+		if got := r.accept(s.seq); got != s.want {
+			t.Errorf("step %d: accept(%d) = %v, want %v", i, s.seq, got, s.want)
+		}
+	}
+}
+
+// recorder keeps a copy of every packet written through it.
+type recorder struct {
+	net.PacketConn
+	mu   sync.Mutex
+	sent [][]byte
+}
+
+func (r *recorder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	r.mu.Lock()
+	r.sent = append(r.sent, append([]byte(nil), b...))
+	r.mu.Unlock()
+	return r.PacketConn.WriteTo(b, addr)
+}
+
+// datagrams returns the datagram packets written so far.
+func (r *recorder) datagrams() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pkts [][]byte
+	for _, b := range r.sent {
+		if b[0] == packetDatagram {
+			pkts = append(pkts, b)
+		}
+	}
+	return pkts
+}
+
+func listenUDP(t *testing.T) *recorder {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recorder{PacketConn: pc}
+}
+
+func testConf(block kcp.BlockCrypt, datagram bool) *conf.KCP {
+	return &conf.KCP{
+		Mode:      "fast3",
+		MTU:       1499,
+		Rcvwnd:    512,
+		Sndwnd:    512,
+		Block:     block,
+		Smuxbuf:   4 * 1024 * 1024,
+		Streambuf: 2 * 1024 * 1024,
+		Datagram:  datagram,
+	}
+}
+
+// pair connects a client to a server and returns a stream open between
+// them on each side.
+func pair(t *testing.T, cfg *conf.KCP) (cConn, sConn tnet.Conn, cStrm, sStrm tnet.Strm, cWire, sWire *recorder) {
+	t.Helper()
+	sWire, cWire = listenUDP(t), listenUDP(t)
+	l, err := Listen(cfg, sWire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	cConn, err = Dial(sWire.LocalAddr().(*net.UDPAddr), cfg, cWire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cConn.Close() })
+	if cStrm, err = cConn.OpenStrm(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cStrm.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if sConn, err = l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sConn.Close() })
+	if sStrm, err = sConn.AcceptStrm(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, sStrm, []byte("hello"))
+	return
+}
+
+func expect(t *testing.T, strm tnet.Strm, want []byte) {
+	t.Helper()
+	strm.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65535)
+	n, err := strm.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(buf[:n], want) {
+		t.Fatalf("Read %d bytes, want %d", n, len(want))
+	}
+}
+
+func TestDatagram(t *testing.T) {
+	aes, err := kcp.NewAESBlockCrypt(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := kcp.NewAESGCMCrypt(bytes.Repeat([]byte{1}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]kcp.BlockCrypt{"none": nil, "aes": aes, "aes-128-gcm": gcm} {
+		t.Run(name, func(t *testing.T) {
+			cConn, sConn, cStrm, sStrm, cWire, sWire := pair(t, testConf(block, true))
+			cd, sd := cConn.Datagram(cStrm), sConn.Datagram(sStrm)
+
+			if _, err := sd.Write([]byte("ready")); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, cd, []byte("ready"))
+			if n := len(sWire.datagrams()); n != 1 {
+				t.Errorf("server sent %d datagrams, want 1", n)
+			}
+
+			// The largest datagram still fits the 1500 byte link MTU
+			// together with the type byte.
+			max := cConn.(*Conn).demux.max
+			full := bytes.Repeat([]byte{2}, max)
+			if _, err := cd.Write(full); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, sd, full)
+			pkts := cWire.datagrams()
+			if len(pkts) != 1 {
+				t.Fatalf("client sent %d datagrams, want 1", len(pkts))
+			}
+			if n := len(pkts[0]); n != 1500 {
+				t.Errorf("largest datagram is %d bytes on the wire, want 1500", n)
+			}
+
+			// One byte more goes over the stream instead.
+			over := bytes.Repeat([]byte{3}, max+1)
+			if _, err := cd.Write(over); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, sd, over)
+			if n := len(cWire.datagrams()); n != 1 {
+				t.Errorf("oversize write sent a datagram")
+			}
+
+			// A datagram sent again is dropped.
+			for range 2 {
+				if _, err := cWire.PacketConn.WriteTo(pkts[0], sWire.LocalAddr()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sd.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+			if _, err := sd.Read(make([]byte, 2048)); !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Errorf("replayed datagram was delivered (err = %v)", err)
+			}
+			if _, err := cd.Write([]byte("after")); err != nil {
+				t.Fatal(err)
+			}
+			expect(t, sd, []byte("after"))
+		})
+	}
+}
+
+// Without datagrams the wire format is plain kcp-go, so either side works
+// with a peer that predates datagrams.
+func TestPlainKCP(t *testing.T) {
+	block, err := kcp.NewAESBlockCrypt(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConf(block, false)
+
+	t.Run("server", func(t *testing.T) {
+		sWire, cWire := listenUDP(t), listenUDP(t)
+		l, err := Listen(cfg, sWire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		conn, err := kcp.NewConn(sWire.LocalAddr().String(), block, 0, 0, cWire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		sess, err := smux.Client(conn, smuxConf(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		strm, err := sess.OpenStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := strm.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		sConn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sConn.Close()
+		sStrm, err := sConn.AcceptStrm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, sStrm, []byte("hello"))
+		if sConn.Datagram(sStrm) != sStrm {
+			t.Errorf("Datagram wrapped the stream without datagrams enabled")
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		sWire, cWire := listenUDP(t), listenUDP(t)
+		l, err := kcp.ServeConn(block, 0, 0, sWire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		cConn, err := Dial(sWire.LocalAddr().(*net.UDPAddr), cfg, cWire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cConn.Close()
+		cStrm, err := cConn.OpenStrm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cStrm.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := l.AcceptKCP()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		sess, err := smux.Server(conn, smuxConf(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		strm, err := sess.AcceptStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(strm, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("plain server read %q, %v", buf, err)
+		}
+	})
+}
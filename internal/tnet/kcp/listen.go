@@ -1,28 +1,34 @@
 package kcp
 
 import (
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
 	"net"
-	"paqet/internal/conf"
-	"paqet/internal/socket"
-	"paqet/internal/tnet"
 
 	"github.com/xtaci/kcp-go/v5"
 	"github.com/xtaci/smux"
 )
 
 type Listener struct {
-	packetConn *socket.PacketConn
+	packetConn net.PacketConn
 	cfg        *conf.KCP
 	listener   *kcp.Listener
+	demux      *demux
 }
 
-func Listen(cfg *conf.KCP, pConn *socket.PacketConn) (tnet.Listener, error) {
-	l, err := kcp.ServeConn(cfg.Block, cfg.Dshard, cfg.Pshard, pConn)
+func Listen(cfg *conf.KCP, pConn net.PacketConn) (tnet.Listener, error) {
+	var d *demux
+	kConn := pConn
+	if cfg.Datagram {
+		d = newDemux(pConn, cfg.Block, cfg.MTU)
+		kConn = d
+	}
+	l, err := kcp.ServeConn(cfg.Block, cfg.Dshard, cfg.Pshard, kConn)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Listener{packetConn: pConn, cfg: cfg, listener: l}, nil
+	return &Listener{packetConn: pConn, cfg: cfg, listener: l, demux: d}, nil
 }
 
 func (l *Listener) Accept() (tnet.Conn, error) {
@@ -35,7 +41,7 @@ func (l *Listener) Accept() (tnet.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Conn{nil, conn, sess}, nil
+	return &Conn{nil, conn, sess, l.cfg, l.demux}, nil
 }
 
 func (l *Listener) Close() error {
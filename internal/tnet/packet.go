@@ -0,0 +1,58 @@
+package tnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const maxPacket = 0xFFFF
+
+// PacketStrm prefixes every Write with its length so that it arrives as a
+// single Read, for transports whose streams do not keep write boundaries.
+// A packet larger than the Read buffer is truncated, as UDP would.
+type PacketStrm struct {
+	Strm
+	rmu  sync.Mutex
+	wmu  sync.Mutex
+	rhdr [2]byte
+	wbuf []byte
+}
+
+func NewPacketStrm(strm Strm) *PacketStrm {
+	return &PacketStrm{Strm: strm}
+}
+
+func (s *PacketStrm) Read(b []byte) (int, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if _, err := io.ReadFull(s.Strm, s.rhdr[:]); err != nil {
+		return 0, err
+	}
+	size := int(binary.BigEndian.Uint16(s.rhdr[:]))
+	n := min(size, len(b))
+	if _, err := io.ReadFull(s.Strm, b[:n]); err != nil {
+		return 0, err
+	}
+	if n < size {
+		if _, err := io.CopyN(io.Discard, s.Strm, int64(size-n)); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (s *PacketStrm) Write(b []byte) (int, error) {
+	if len(b) > maxPacket {
+		return 0, fmt.Errorf("packet of %d bytes exceeds %d", len(b), maxPacket)
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.wbuf = binary.BigEndian.AppendUint16(s.wbuf[:0], uint16(len(b)))
+	s.wbuf = append(s.wbuf, b...)
+	if _, err := s.Strm.Write(s.wbuf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,193 @@
+package quic
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/protocol"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+type Conn struct {
+	PacketConn net.PacketConn
+	QUICConn   *quic.Conn
+	cfg        *conf.QUIC
+	streams    atomic.Int64
+	flows      map[uint32]*tnet.DatagramStrm
+	fmu        sync.Mutex
+	// Deadlines bound OpenStrm (write) and AcceptStrm (read).
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+}
+
+func newConn(conn *quic.Conn, pConn net.PacketConn, cfg *conf.QUIC) *Conn {
+	c := &Conn{PacketConn: pConn, QUICConn: conn, cfg: cfg}
+	if cfg.Datagram {
+		c.flows = make(map[uint32]*tnet.DatagramStrm)
+		go c.receiveDatagrams()
+	}
+	return c
+}
+
+// deadline returns a context that ends at the deadline stored in v, if any.
+func deadline(v *atomic.Value) (context.Context, context.CancelFunc) {
+	if t, ok := v.Load().(time.Time); ok && !t.IsZero() {
+		return context.WithDeadline(context.Background(), t)
+	}
+	return context.Background(), func() {}
+}
+
+func (c *Conn) OpenStrm() (tnet.Strm, error) {
+	ctx, cancel := deadline(&c.writeDeadline)
+	defer cancel()
+	strm, err := c.QUICConn.OpenStreamSync(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.streams.Add(1)
+	return &Strm{Stream: strm, conn: c}, nil
+}
+
+func (c *Conn) AcceptStrm() (tnet.Strm, error) {
+	ctx, cancel := deadline(&c.readDeadline)
+	defer cancel()
+	strm, err := c.QUICConn.AcceptStream(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.streams.Add(1)
+	return &Strm{Stream: strm, conn: c}, nil
+}
+
+func (c *Conn) Ping(wait bool) error {
+	if !wait {
+		// Unlike smux, QUIC tells the peer about a stream only once data is
+		// sent on it, so a closed connection is what an idle one looks like.
+		select {
+		case <-c.QUICConn.Context().Done():
+			return fmt.Errorf("ping failed: %v", context.Cause(c.QUICConn.Context()))
+		default:
+			return nil
+		}
+	}
+	strm, err := c.OpenStrm()
+	if err != nil {
+		return fmt.Errorf("ping failed: %v", err)
+	}
+	defer strm.Close()
+	p := protocol.Proto{Type: protocol.PPING}
+	err = p.Write(strm)
+	if err != nil {
+		return fmt.Errorf("connection test failed: %v", err)
+	}
+	err = p.Read(strm)
+	if err != nil {
+		return fmt.Errorf("connection test failed: %v", err)
+	}
+	if p.Type != protocol.PPONG {
+		return fmt.Errorf("connection test failed: unexpected reply %d", p.Type)
+	}
+	return nil
+}
+
+// Packet frames strm's payload, as QUIC streams are plain byte streams.
+func (c *Conn) Packet(strm tnet.Strm) tnet.Strm {
+	return tnet.NewPacketStrm(strm)
+}
+
+// Datagram sends strm's payload as QUIC datagrams, each prefixed with the
+// stream ID as its flow ID.
+func (c *Conn) Datagram(strm tnet.Strm) tnet.Strm {
+	strm = c.Packet(strm)
+	if c.flows == nil {
+		return strm
+	}
+	flow := uint32(strm.SID())
+	send := func(b []byte) error {
+		buf := binary.LittleEndian.AppendUint32(make([]byte, 0, 4+len(b)), flow)
+		err := c.QUICConn.SendDatagram(append(buf, b...))
+		var tooLarge *quic.DatagramTooLargeError
+		if errors.As(err, &tooLarge) {
+			return tnet.ErrDatagramTooLarge
+		}
+		return err
+	}
+	c.fmu.Lock()
+	defer c.fmu.Unlock()
+	s := tnet.NewDatagramStrm(strm, send, func() {
+		c.fmu.Lock()
+		delete(c.flows, flow)
+		c.fmu.Unlock()
+	})
+	c.flows[flow] = s
+	return s
+}
+
+func (c *Conn) receiveDatagrams() {
+	for {
+		b, err := c.QUICConn.ReceiveDatagram(c.QUICConn.Context())
+		if err != nil {
+			return
+		}
+		if len(b) < 4 {
+			continue
+		}
+		c.fmu.Lock()
+		s := c.flows[binary.LittleEndian.Uint32(b)]
+		c.fmu.Unlock()
+		if s != nil {
+			s.Deliver(b[4:])
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	c.QUICConn.CloseWithError(0, "")
+	if c.PacketConn != nil {
+		c.PacketConn.Close()
+	}
+	return nil
+}
+
+func (c *Conn) Stats() tnet.ConnStats {
+	st := c.QUICConn.ConnectionStats()
+	return tnet.ConnStats{
+		RTT:     st.SmoothedRTT,
+		RTTVar:  st.MeanDeviation,
+		Streams: int(c.streams.Load()),
+	}
+}
+
+func (c *Conn) LocalAddr() net.Addr  { return c.QUICConn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr { return c.QUICConn.RemoteAddr() }
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	c.writeDeadline.Store(t)
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(t)
+	return nil
+}
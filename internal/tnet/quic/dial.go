@@ -0,0 +1,27 @@
+package quic
+
+import (
+	"context"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+var log = flog.New("quic")
+
+func Dial(addr *net.UDPAddr, cfg *conf.QUIC, pConn net.PacketConn) (tnet.Conn, error) {
+	tc, err := tlsConf(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.Dial(context.Background(), pConn, addr, tc, quicConf(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("connection attempt failed: %v", err)
+	}
+	log.Debugf("QUIC connection established to %s", addr)
+	return newConn(conn, pConn, cfg), nil
+}
@@ -0,0 +1,51 @@
+package quic
+
+import (
+	"context"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+type Listener struct {
+	packetConn net.PacketConn
+	cfg        *conf.QUIC
+	listener   *quic.Listener
+}
+
+func Listen(cfg *conf.QUIC, pConn net.PacketConn) (tnet.Listener, error) {
+	tc, err := tlsConf(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	l, err := quic.Listen(pConn, tc, quicConf(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{packetConn: pConn, cfg: cfg, listener: l}, nil
+}
+
+func (l *Listener) Accept() (tnet.Conn, error) {
+	conn, err := l.listener.Accept(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, nil, l.cfg), nil
+}
+
+func (l *Listener) Close() error {
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
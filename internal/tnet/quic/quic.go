@@ -0,0 +1,69 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"math/big"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// tlsConf authenticates both ends with the certificate derived from the
+// shared key: a peer that presents a different one does not know the key.
+func tlsConf(cfg *conf.QUIC, server bool) (*tls.Config, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+		DNSNames:     []string{"paqet"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	pub := cfg.Identity.Public().(ed25519.PublicKey)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, cfg.Identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create QUIC certificate: %w", err)
+	}
+
+	tc := &tls.Config{
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: cfg.Identity}},
+		NextProtos:         []string{cfg.ALPN},
+		MinVersion:         tls.VersionTLS13,
+		ServerName:         "paqet",
+		InsecureSkipVerify: true, // replaced by VerifyPeerCertificate
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 {
+				return fmt.Errorf("peer sent no certificate")
+			}
+			cert, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			if key, ok := cert.PublicKey.(ed25519.PublicKey); !ok || !bytes.Equal(key, pub) {
+				return fmt.Errorf("peer does not use the same key")
+			}
+			return nil
+		},
+	}
+	if server {
+		tc.ClientAuth = tls.RequireAnyClientCert
+	}
+	return tc, nil
+}
+
+func quicConf(cfg *conf.QUIC) *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:  5 * time.Second,
+		MaxIdleTimeout:        time.Duration(cfg.IdleTimeout) * time.Second,
+		KeepAlivePeriod:       time.Duration(cfg.KeepAlive) * time.Second,
+		MaxIncomingStreams:    int64(cfg.MaxStreams),
+		MaxIncomingUniStreams: -1,
+		EnableDatagrams:       cfg.Datagram,
+	}
+}
@@ -0,0 +1,181 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
+)
+
+func testConf(key string) *conf.QUIC {
+	seed := sha256.Sum256([]byte(key))
+	return &conf.QUIC{
+		Key:         key,
+		ALPN:        "paqet",
+		IdleTimeout: 30,
+		KeepAlive:   10,
+		MaxStreams:  1024,
+		Identity:    ed25519.NewKeyFromSeed(seed[:]),
+	}
+}
+
+func listen(t *testing.T, cfg *conf.QUIC) tnet.Listener {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen(cfg, pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func dial(t *testing.T, l tnet.Listener, cfg *conf.QUIC) (tnet.Conn, error) {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Dial(l.Addr().(*net.UDPAddr), cfg, pc)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, nil
+}
+
+// pair returns a stream opened by a client and accepted by the server.
+func pair(t *testing.T) (cConn, sConn tnet.Conn, cStrm, sStrm tnet.Strm) {
+	t.Helper()
+	cfg := testConf("secret")
+	l := listen(t, cfg)
+	cConn, err := dial(t, l, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sConn, err = l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sConn.Close() })
+	if cStrm, err = cConn.OpenStrm(); err != nil {
+		t.Fatal(err)
+	}
+	// The server learns of a stream once data is sent on it.
+	if _, err := cStrm.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if sStrm, err = sConn.AcceptStrm(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(sStrm, buf); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestHandshake(t *testing.T) {
+	cConn, sConn, cStrm, sStrm := pair(t)
+	if _, err := sStrm.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	cStrm.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(cStrm, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("client read %q, %v", buf, err)
+	}
+	if err := sConn.Ping(false); err != nil {
+		t.Errorf("Ping(false) = %v", err)
+	}
+	cConn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if err := sConn.Ping(false); err == nil {
+		t.Errorf("Ping(false) succeeded after the client closed")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	l := listen(t, testConf("secret"))
+	accepted := make(chan tnet.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	if _, err := dial(t, l, testConf("other")); err == nil {
+		t.Errorf("Dial succeeded with a different key")
+	}
+	select {
+	case conn := <-accepted:
+		conn.Close()
+		t.Errorf("server accepted a client with a different key")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestPacketStrm(t *testing.T) {
+	cConn, sConn, cStrm, sStrm := pair(t)
+	cp, sp := cConn.Packet(cStrm), sConn.Packet(sStrm)
+
+	// Writes sent back to back still arrive one per Read.
+	sizes := []int{1, 0, 1000, 3000, 0xffff}
+	go func() {
+		for _, size := range sizes {
+			cp.Write(bytes.Repeat([]byte{byte(size)}, size))
+		}
+	}()
+	buf := make([]byte, 0x10000)
+	sp.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, size := range sizes {
+		n, err := sp.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != size || !bytes.Equal(buf[:n], bytes.Repeat([]byte{byte(size)}, size)) {
+			t.Fatalf("Read %d bytes, want %d", n, size)
+		}
+	}
+
+	// A packet larger than the buffer is truncated, as UDP would, and the
+	// next one is intact.
+	if _, err := cp.Write(bytes.Repeat([]byte{1}, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Write([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := sp.Read(buf[:10]); err != nil || n != 10 {
+		t.Fatalf("truncated Read = %d, %v", n, err)
+	}
+	if n, err := sp.Read(buf); err != nil || string(buf[:n]) != "next" {
+		t.Fatalf("Read after truncation = %q, %v", buf[:n], err)
+	}
+
+	if _, err := cp.Write(make([]byte, 0x10000)); err == nil {
+		t.Errorf("Write accepted a packet over 65535 bytes")
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	_, sConn, _, _ := pair(t)
+	sConn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := sConn.AcceptStrm(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("AcceptStrm past the deadline = %v", err)
+	}
+	sConn.SetDeadline(time.Time{})
+	if _, err := sConn.OpenStrm(); err != nil {
+		t.Errorf("OpenStrm without a deadline = %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package quic
+
+import (
+	"net"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+type Strm struct {
+	*quic.Stream
+	conn *Conn
+	once sync.Once
+}
+
+func (s *Strm) SID() int {
+	return int(s.StreamID())
+}
+
+// Close ends both directions, as closing a stream does on the other
+// transports; a QUIC stream's own Close only ends the sending side.
+func (s *Strm) Close() error {
+	s.once.Do(func() { s.conn.streams.Add(-1) })
+	s.CancelRead(0)
+	return s.Stream.Close()
+}
+
+func (s *Strm) LocalAddr() net.Addr  { return s.conn.LocalAddr() }
+func (s *Strm) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
@@ -0,0 +1,32 @@
+// Package transport opens connections with the tnet implementation the
+// configuration selects.
+package transport
+
+import (
+	"fmt"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/tnet"
+	"github.com/starco76/paqet/internal/tnet/kcp"
+	"github.com/starco76/paqet/internal/tnet/quic"
+	"net"
+)
+
+func Dial(addr *net.UDPAddr, cfg *conf.Transport, pConn net.PacketConn) (tnet.Conn, error) {
+	switch cfg.Protocol {
+	case "kcp":
+		return kcp.Dial(addr, cfg.KCP, pConn)
+	case "quic":
+		return quic.Dial(addr, cfg.QUIC, pConn)
+	}
+	return nil, fmt.Errorf("unsupported transport protocol: %s", cfg.Protocol)
+}
+
+func Listen(cfg *conf.Transport, pConn net.PacketConn) (tnet.Listener, error) {
+	switch cfg.Protocol {
+	case "kcp":
+		return kcp.Listen(cfg.KCP, pConn)
+	case "quic":
+		return quic.Listen(cfg.QUIC, pConn)
+	}
+	return nil, fmt.Errorf("unsupported transport protocol: %s", cfg.Protocol)
+}
@@ -0,0 +1,135 @@
+// Package paqet embeds a paqet client or server in another Go program.
+//
+// A Dialer opens TCP and UDP connections through a paqet server, and a
+// Server accepts them, with hooks for deciding who may connect and where to.
+// A Server can also run named services in process, which a Dialer opens
+// with DialService instead of an address. Both are configured with Options,
+// which stays stable when the YAML file format changes.
+package paqet
+
+import (
+	"context"
+	"github.com/starco76/paqet/internal/client"
+	"github.com/starco76/paqet/internal/conf"
+	"github.com/starco76/paqet/internal/flog"
+	"github.com/starco76/paqet/internal/pkg/buffer"
+	"io"
+	"net"
+	"sync"
+)
+
+// Options configures a client or a server.
+type Options struct {
+	// Carrier is how packets reach the peer: "pcap-raw", the default, sends
+	// raw packets on Interface; "udp" and "tcp-stream" use kernel sockets
+	// and need no interface, router or flag settings, nor root.
+	Carrier string
+
+	// Interface is the network interface packets are captured and sent on.
+	// GUID is its Npcap device name, required on Windows.
+	Interface string
+	GUID      string
+
+	// IPv4 and IPv6 are the local addresses as "ip:port", each with the MAC
+	// address of the router on that family. At least one is required. A
+	// client may use port 0 for a random one; a server listens on the port.
+	IPv4, IPv4Router string
+	IPv6, IPv6Router string
+
+	// LocalFlags are the TCP flag combinations, such as "PA", set on
+	// outgoing packets and RemoteFlags those the peer is asked to use.
+	LocalFlags, RemoteFlags []string
+
+	// Server is the address of the server a client connects to.
+	Server string
+	// Conns is the number of connections a client keeps open, 1 by default.
+	Conns int
+
+	// Transport is "kcp", the default, or "quic". Key is the secret shared
+	// with the peer. Block is the cipher, "aes" by default, Mode the KCP
+	// mode, "fast" by default, and MTU the KCP MTU; QUIC ignores all three.
+	Transport string
+	Key       string
+	Block     string
+	Mode      string
+	MTU       int
+	// Datagram sends UDP payloads as unreliable datagrams, so lost packets
+	// are dropped rather than retransmitted. It must match the peer's
+	// setting.
+	Datagram bool
+
+	// PacketConn, when set, carries the packets instead of a raw socket on
+	// Interface, which lets the caller supply its own packet I/O. The
+	// interface, address and flag fields are then ignored.
+	PacketConn func(ctx context.Context) (net.PacketConn, error)
+
+	// AllowPrivate lets a Server reach loopback, private and link-local
+	// destinations, which it refuses by default.
+	AllowPrivate bool
+}
+
+// ErrDenied is wrapped by dial errors when the server refused the request.
+var ErrDenied = client.ErrDenied
+
+func (o *Options) conf(role string) (*conf.Conf, error) {
+	c := &conf.Conf{
+		Role: role,
+		Network: conf.Network{
+			Carrier:    o.Carrier,
+			Interface_: o.Interface,
+			GUID:       o.GUID,
+			IPv4:       conf.Addr{Addr_: o.IPv4, RouterMac_: o.IPv4Router},
+			IPv6:       conf.Addr{Addr_: o.IPv6, RouterMac_: o.IPv6Router},
+			TCP:        conf.TCP{LF_: o.LocalFlags, RF_: o.RemoteFlags},
+			PacketConn: o.PacketConn,
+		},
+		Server: conf.Server{Addr_: o.Server},
+		Transport: conf.Transport{
+			Protocol: o.Transport,
+			Conn:     o.Conns,
+		},
+	}
+	switch o.Transport {
+	case "", "kcp":
+		c.Transport.Protocol = "kcp"
+		c.Transport.KCP = &conf.KCP{Mode: o.Mode, MTU: o.MTU, Block_: o.Block, Key: o.Key, Datagram: o.Datagram}
+	case "quic":
+		c.Transport.QUIC = &conf.QUIC{Key: o.Key, Datagram: o.Datagram}
+	}
+	if o.AllowPrivate {
+		c.ACL.BlockPrivate = new(bool)
+	}
+	if role == "server" {
+		for _, addr := range []string{o.IPv4, o.IPv6} {
+			if _, port, err := net.SplitHostPort(addr); err == nil {
+				c.Listen.Addr_ = ":" + port
+			}
+		}
+	}
+	if err := c.Prepare(); err != nil {
+		return nil, err
+	}
+	initBuffers.Do(func() {
+		buffer.Initialize(c.Transport.TCPBuf, c.Transport.UDPBuf)
+	})
+	return c, nil
+}
+
+var initBuffers sync.Once
+
+// Logging is off in programs embedding paqet until SetLog turns it on.
+func init() {
+	flog.SetLevel(int(flog.None))
+}
+
+// SetLog sends log lines to w from the given level on: debug, info, warn,
+// error, fatal or none. Nothing is logged until it is called.
+func SetLog(w io.Writer, level string) error {
+	l, err := flog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	flog.SetOutput(w)
+	flog.SetLevel(int(l))
+	return nil
+}
@@ -0,0 +1,182 @@
+package paqet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/starco76/paqet/internal/flog"
+)
+
+func udpSocket(t *testing.T) *net.UDPConn {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+func clientOptions(server string) Options {
+	return Options{
+		Server: server,
+		Key:    "secret",
+		PacketConn: func(ctx context.Context) (net.PacketConn, error) {
+			return net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		},
+	}
+}
+
+// startServer serves on a loopback socket and returns its address.
+func startServer(t *testing.T, hooks Hooks) string {
+	t.Helper()
+	pc := udpSocket(t)
+	addr := pc.LocalAddr().String()
+	s, err := NewServer(Options{
+		IPv4:         addr,
+		Key:          "secret",
+		AllowPrivate: true,
+		PacketConn:   func(ctx context.Context) (net.PacketConn, error) { return pc, nil },
+	}, hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Handle("echo", func(ctx context.Context, conn net.Conn) error {
+		_, err := io.Copy(conn, conn)
+		return err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return addr
+}
+
+func echoServers(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], from)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != msg {
+		t.Errorf("read %q, want %q", buf, msg)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	if flog.GetLevel() != flog.None {
+		t.Errorf("log level = %d before SetLog, want none", flog.GetLevel())
+	}
+	echo := echoServers(t)
+	_, port, _ := net.SplitHostPort(echo)
+	denied := net.JoinHostPort("127.0.0.2", port)
+	addr := startServer(t, Hooks{
+		Authorize: func(ctx context.Context, client net.Addr, network, addr string) error {
+			if addr == denied {
+				return errors.New("not this one")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+	d, err := NewDialer(ctx, clientOptions(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, network := range []string{"tcp", "udp"} {
+		conn, err := d.DialContext(ctx, network, echo)
+		if err != nil {
+			t.Fatalf("DialContext(%s) error = %v", network, err)
+		}
+		roundTrip(t, conn, "hello over "+network)
+	}
+	conn, err := d.DialService(ctx, "echo")
+	if err != nil {
+		t.Fatalf("DialService error = %v", err)
+	}
+	roundTrip(t, conn, "hello service")
+
+	if _, err := d.DialContext(ctx, "tcp", denied); !errors.Is(err, ErrDenied) {
+		t.Errorf("DialContext(%s) error = %v, want ErrDenied", denied, err)
+	}
+	if _, err := d.DialService(ctx, "missing"); err == nil {
+		t.Errorf("DialService(missing) succeeded")
+	}
+}
+
+func TestDialContextCancel(t *testing.T) {
+	// Nothing answers on this socket, so requests wait for a reply.
+	silent := udpSocket(t)
+	d, err := NewDialer(context.Background(), clientOptions(silent.LocalAddr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, network := range []string{"tcp", "udp"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		_, err := d.DialContext(ctx, network, "192.0.2.1:80")
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("DialContext(%s) error = %v, want deadline exceeded", network, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("DialContext(%s) returned after %s", network, elapsed)
+		}
+	}
+}
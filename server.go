@@ -0,0 +1,52 @@
+package paqet
+
+import (
+	"context"
+	"github.com/starco76/paqet/internal/server"
+	"net"
+)
+
+// Hooks let the embedding program decide what a Server allows. Nil fields
+// allow everything but private destinations, see Options.AllowPrivate, and
+// dial directly.
+type Hooks struct {
+	// Accept is called for each new client connection; an error drops it.
+	Accept func(remote net.Addr) error
+	// Authorize is called before the server dials addr for a client; an
+	// error is returned to the client as a denial.
+	Authorize func(ctx context.Context, client net.Addr, network, addr string) error
+	// Dial connects to the destination in place of a direct dial. Private
+	// destinations are refused before it is called, names by the addresses
+	// they resolve to.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Server accepts paqet clients and relays their connections.
+type Server struct {
+	server *server.Server
+}
+
+func NewServer(opts Options, hooks Hooks) (*Server, error) {
+	cfg, err := opts.conf("server")
+	if err != nil {
+		return nil, err
+	}
+	s, err := server.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.SetHooks(server.Hooks{Accept: hooks.Accept, Authorize: hooks.Authorize, Dial: hooks.Dial})
+	return &Server{server: s}, nil
+}
+
+// Handle makes h available to clients under name; a Dialer reaches it with
+// DialService. conn is the client's stream and its RemoteAddr the client.
+// Handle must be called before Serve.
+func (s *Server) Handle(name string, h func(ctx context.Context, conn net.Conn) error) {
+	s.server.Handle(name, h)
+}
+
+// Serve runs until ctx is done.
+func (s *Server) Serve(ctx context.Context) error {
+	return s.server.Start(ctx)
+}